@@ -1,7 +1,6 @@
 package albums
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -18,6 +17,9 @@ const (
 	ListAlbumsPath  = "albums"
 	GetAlbumPath    = "albums"
 	CreateAlbumPath = "albums"
+
+	BatchAddMediaItemsPath   = "albums"
+	batchAddMediaItemsMethod = ":batchAddMediaItems"
 )
 
 type Album struct {
@@ -59,7 +61,7 @@ type ListAlbumsResponse struct {
 // List https://developers.google.com/photos/library/reference/rest/v1/albums/list
 func List(ctx context.Context, client *http.Client, listAlbumsRequest ListAlbumsRequest) (<-chan Album, <-chan error) {
 	albumCh := make(chan Album)
-	errCh := make(chan error)
+	errCh := make(chan error, 1)
 
 	go func(req ListAlbumsRequest) {
 		defer close(albumCh)
@@ -141,6 +143,10 @@ func list(ctx context.Context, client *http.Client, listAlbumsRequest ListAlbums
 		return listAlbumsResponse, err
 	}
 
+	if err := api.CheckResponse(resp); err != nil {
+		return listAlbumsResponse, err
+	}
+
 	slog.DebugContext(ctx, "received response from client", "response_headers", resp.Header, "request_headers", resp.Request.Header)
 
 	if err := json.NewDecoder(resp.Body).Decode(&listAlbumsResponse); err != nil {
@@ -189,7 +195,12 @@ func Get(ctx context.Context, client *http.Client, getAlbumRequest GetAlbumReque
 		return getAlbumResponse.Album, err
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&getAlbumResponse); err != nil {
+	if err := api.CheckResponse(resp); err != nil {
+		return getAlbumResponse.Album, err
+	}
+
+	// the album is returned as the response body, not wrapped
+	if err := json.NewDecoder(resp.Body).Decode(&getAlbumResponse.Album); err != nil {
 		return getAlbumResponse.Album, err
 	}
 
@@ -220,22 +231,74 @@ func Create(ctx context.Context, client *http.Client, createAlbumRequest CreateA
 	}
 
 	buf := bytes.NewBuffer(nil)
-	w := bufio.NewWriter(buf)
-	json.NewEncoder(w).Encode(&createAlbumRequest)
+	if err := json.NewEncoder(buf).Encode(&createAlbumRequest); err != nil {
+		return createAlbumResponse.Album, err
+	}
 
-	req, err := http.NewRequest(http.MethodPost, rawURL.String(), buf)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL.String(), buf)
 	if err != nil {
 		return createAlbumResponse.Album, err
 	}
+	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := client.Do(req)
 	if err != nil {
 		return createAlbumResponse.Album, err
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&createAlbumResponse); err != nil {
+	if err := api.CheckResponse(resp); err != nil {
+		return createAlbumResponse.Album, err
+	}
+
+	// the album is returned as the response body, not wrapped
+	if err := json.NewDecoder(resp.Body).Decode(&createAlbumResponse.Album); err != nil {
 		return createAlbumResponse.Album, err
 	}
 
 	return createAlbumResponse.Album, resp.Body.Close()
 }
+
+type BatchAddMediaItemsRequest struct {
+	AlbumID      string   `json:"-"`
+	MediaItemIDs []string `json:"mediaItemIds"`
+}
+
+// BatchAddMediaItems https://developers.google.com/photos/library/reference/rest/v1/albums/batchAddMediaItems
+// at most api.MaxBatchAddMediaItemsSize items can be added per request, only
+// app created media items can be added to app created albums.
+func BatchAddMediaItems(ctx context.Context, client *http.Client, batchAddRequest BatchAddMediaItemsRequest) error {
+	urlPath, err := url.JoinPath(api.PhotosLibraryVersion, BatchAddMediaItemsPath, batchAddRequest.AlbumID+batchAddMediaItemsMethod)
+	if err != nil {
+		return err
+	}
+
+	rawURL := url.URL{
+		Scheme: api.PhotosLibraryScheme,
+		Host:   api.PhotosLibraryHost,
+		Path:   urlPath,
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := json.NewEncoder(buf).Encode(&batchAddRequest); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL.String(), buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if err := api.CheckResponse(resp); err != nil {
+		return err
+	}
+
+	slog.DebugContext(ctx, "added media items to album", "albumId", batchAddRequest.AlbumID, "mediaItemIds", len(batchAddRequest.MediaItemIDs))
+
+	return resp.Body.Close()
+}
@@ -101,9 +101,7 @@ func TestGet(t *testing.T) {
 	client := &http.Client{
 		Transport: mockRoundTripper{
 			roundTripperFn: func(req *http.Request) (*http.Response, error) {
-				resp := GetAlbumResponse{
-					Album: Album{ID: "1"},
-				}
+				resp := Album{ID: "1"}
 
 				data, err := json.Marshal(&resp)
 				if err != nil {
@@ -149,10 +147,16 @@ func TestCreate(t *testing.T) {
 	client := &http.Client{
 		Transport: mockRoundTripper{
 			roundTripperFn: func(req *http.Request) (*http.Response, error) {
-				resp := CreateAlbumResponse{
-					Album: Album{ID: "1"},
+				var createReq CreateAlbumRequest
+				if err := json.NewDecoder(req.Body).Decode(&createReq); err != nil {
+					t.Errorf("request body: %v", err)
+				}
+				if createReq.Album.Title != "Trip" || req.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("request %+v with content type %q not expected", createReq, req.Header.Get("Content-Type"))
 				}
 
+				resp := Album{ID: "1"}
+
 				data, err := json.Marshal(&resp)
 				if err != nil {
 					// TODO: respond badly?
@@ -181,7 +185,7 @@ func TestCreate(t *testing.T) {
 		},
 	}
 
-	album, err := Create(ctx, client, CreateAlbumRequest{Album: Album{ID: "12"}})
+	album, err := Create(ctx, client, CreateAlbumRequest{Album: Album{Title: "Trip"}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -189,3 +193,40 @@ func TestCreate(t *testing.T) {
 		t.Errorf("album id %s not expected %s", album.ID, "1")
 	}
 }
+
+func TestBatchAddMediaItems(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var gotPath string
+	var gotReq BatchAddMediaItemsRequest
+	client := &http.Client{
+		Transport: mockRoundTripper{
+			roundTripperFn: func(req *http.Request) (*http.Response, error) {
+				gotPath = req.URL.Path
+				if err := json.NewDecoder(req.Body).Decode(&gotReq); err != nil {
+					return nil, err
+				}
+
+				return &http.Response{
+					Status:     http.StatusText(http.StatusOK),
+					StatusCode: http.StatusOK,
+					Header:     map[string][]string{},
+					Body:       io.NopCloser(bytes.NewBufferString("{}")),
+					Request:    req,
+				}, nil
+			},
+		},
+	}
+
+	err := BatchAddMediaItems(ctx, client, BatchAddMediaItemsRequest{AlbumID: "1", MediaItemIDs: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/v1/albums/1:batchAddMediaItems" {
+		t.Errorf("path %s not expected", gotPath)
+	}
+	if len(gotReq.MediaItemIDs) != 2 {
+		t.Errorf("media item ids %v not expected", gotReq.MediaItemIDs)
+	}
+}
@@ -8,6 +8,9 @@ const (
 	DefaultPageSize = 20
 	MaxPageSize     = 50
 
+	MaxBatchCreateSize        = 50
+	MaxBatchAddMediaItemsSize = 50
+
 	PageSizeQueryKey                 = "pageSize"
 	PageTokenQueryKey                = "pageToken"
 	ExcludeNonAppCreatedDataQueryKey = "excludeNonAppCreatedData"
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// InsufficientScopeReason is the ErrorInfo reason for calls made with too few scopes.
+	InsufficientScopeReason = "ACCESS_TOKEN_SCOPE_INSUFFICIENT"
+
+	wwwAuthenticateHeader   = "WWW-Authenticate"
+	insufficientScopeError  = "insufficient_scope"
+	maxErrorBodySize        = 1 << 20
+	permissionDeniedStatus  = "PERMISSION_DENIED"
+	unauthenticatedStatus   = "UNAUTHENTICATED"
+	resourceExhaustedStatus = "RESOURCE_EXHAUSTED"
+)
+
+// Error is a non 2xx response from the Photos Library API.
+// https://cloud.google.com/apis/design/errors
+type Error struct {
+	StatusCode int            `json:"-"`
+	Code       int            `json:"code"`
+	Message    string         `json:"message"`
+	Status     string         `json:"status"`
+	Details    []ErrorDetails `json:"details,omitempty"`
+
+	// RequiredScopes are the scopes named by the WWW-Authenticate header, if any.
+	RequiredScopes []string `json:"-"`
+}
+
+type ErrorDetails struct {
+	Type     string            `json:"@type"`
+	Reason   string            `json:"reason,omitempty"`
+	Domain   string            `json:"domain,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("photoslibrary: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("photoslibrary: %d %s: %s", e.StatusCode, e.Status, e.Message)
+}
+
+// InsufficientScope reports whether the request failed because the token lacks a scope.
+func (e *Error) InsufficientScope() bool {
+	if len(e.RequiredScopes) > 0 {
+		return true
+	}
+	for _, details := range e.Details {
+		if details.Reason == InsufficientScopeReason {
+			return true
+		}
+	}
+	return e.StatusCode == http.StatusForbidden && e.Status == permissionDeniedStatus &&
+		strings.Contains(strings.ToLower(e.Message), "insufficient authentication scopes")
+}
+
+// CheckResponse returns an *Error for non 2xx responses, consuming and closing the body.
+func CheckResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &Error{StatusCode: resp.StatusCode}
+
+	var body struct {
+		Error *Error `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err := json.Unmarshal(data, &body); err == nil && body.Error != nil {
+		apiErr = body.Error
+		apiErr.StatusCode = resp.StatusCode
+	} else {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+
+	apiErr.RequiredScopes = requiredScopes(resp.Header.Get(wwwAuthenticateHeader))
+
+	return apiErr
+}
+
+// requiredScopes parses the scope parameter of an insufficient_scope challenge
+// e.g. Bearer realm="https://accounts.google.com/", error="insufficient_scope", scope="a b"
+func requiredScopes(challenge string) []string {
+	params := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(challenge, "Bearer"), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		params[strings.ToLower(key)] = strings.Trim(value, `"`)
+	}
+
+	if params["error"] != insufficientScopeError {
+		return nil
+	}
+
+	return strings.Fields(params["scope"])
+}
+
+// IsInsufficientScope reports whether err is an *Error caused by missing scopes.
+func IsInsufficientScope(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.InsufficientScope()
+}
+
+// IsNotFound reports whether err is an *Error with status 404.
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsUnauthenticated reports whether err is an *Error caused by a missing or invalid token.
+func IsUnauthenticated(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.Status == unauthenticatedStatus)
+}
+
+// IsRateLimited reports whether err is an *Error caused by exhausted quota.
+func IsRateLimited(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusTooManyRequests || apiErr.Status == resourceExhaustedStatus)
+}
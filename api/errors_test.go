@@ -0,0 +1,41 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckResponse(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusForbidden,
+		Header: http.Header{
+			"Www-Authenticate": []string{`Bearer realm="https://accounts.google.com/", error="insufficient_scope", scope="https://www.googleapis.com/auth/photoslibrary.appendonly"`},
+		},
+		Body: io.NopCloser(strings.NewReader(`{"error":{"code":403,"message":"Request had insufficient authentication scopes.","status":"PERMISSION_DENIED","details":[{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"ACCESS_TOKEN_SCOPE_INSUFFICIENT"}]}}`)),
+	}
+
+	err := CheckResponse(resp)
+	if !IsInsufficientScope(err) {
+		t.Fatalf("error %v not insufficient scope", err)
+	}
+
+	apiErr := err.(*Error)
+	if want := []string{"https://www.googleapis.com/auth/photoslibrary.appendonly"}; !reflect.DeepEqual(apiErr.RequiredScopes, want) {
+		t.Errorf("required scopes %v not expected %v", apiErr.RequiredScopes, want)
+	}
+	if apiErr.Status != "PERMISSION_DENIED" || apiErr.Code != http.StatusForbidden {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+
+	notFound := CheckResponse(&http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader("not found"))})
+	if !IsNotFound(notFound) || IsInsufficientScope(notFound) {
+		t.Errorf("error %v not expected not found", notFound)
+	}
+
+	if err := CheckResponse(&http.Response{StatusCode: http.StatusOK}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"strconv"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/api"
+)
+
+func init() {
+	register(&command{
+		name:  "albums",
+		usage: "albums ls [-exclude-non-app] [-limit n] | get <id> | create <title>",
+		run:   runAlbums,
+	})
+}
+
+var albumHeader = []string{"ID", "TITLE", "ITEMS", "WRITEABLE"}
+
+func albumRow(album albums.Album) []string {
+	return []string{album.ID, album.Title, album.MediaItemsCount, strconv.FormatBool(album.IsWriteable)}
+}
+
+func runAlbums(ctx context.Context, a *app, args []string) error {
+	return runSubcommand(ctx, a, "albums", map[string]func(context.Context, *app, []string) error{
+		"ls":     runAlbumsList,
+		"get":    runAlbumsGet,
+		"create": runAlbumsCreate,
+	}, args)
+}
+
+func runAlbumsList(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("albums ls", flag.ContinueOnError)
+	excludeNonApp := fs.Bool("exclude-non-app", false, "only list albums created by this app")
+	limit := fs.Int("limit", 0, "maximum number of albums, 0 for all")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.newOutput(albumHeader...)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	albumCh, errCh := albums.List(ctx, client, albums.ListAlbumsRequest{
+		PageSize:                 api.MaxPageSize,
+		ExcludeNonAppCreatedData: *excludeNonApp,
+	})
+
+	n := 0
+	for album := range albumCh {
+		if err := out.write(album, albumRow(album)...); err != nil {
+			return err
+		}
+		if n++; *limit > 0 && n >= *limit {
+			cancel()
+			return out.flush()
+		}
+	}
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return err
+		}
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return out.flush()
+}
+
+func runAlbumsGet(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return usagef("albums get: want exactly one album id")
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	album, err := albums.Get(ctx, client, albums.GetAlbumRequest{AlbumID: args[0]})
+	if err != nil {
+		return err
+	}
+
+	out, err := a.newOutput(albumHeader...)
+	if err != nil {
+		return err
+	}
+	if err := out.write(album, albumRow(album)...); err != nil {
+		return err
+	}
+	return out.flush()
+}
+
+func runAlbumsCreate(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 || args[0] == "" {
+		return usagef("albums create: want exactly one album title")
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	album, err := albums.Create(ctx, client, albums.CreateAlbumRequest{Album: albums.Album{Title: args[0]}})
+	if err != nil {
+		return err
+	}
+
+	out, err := a.newOutput(albumHeader...)
+	if err != nil {
+		return err
+	}
+	if err := out.write(album, albumRow(album)...); err != nil {
+		return err
+	}
+	return out.flush()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/oauth2"
+)
+
+func init() {
+	register(&command{
+		name:  "auth",
+		usage: "auth [login [-timeout d] | ls | logout]  authorize, list or revoke accounts",
+		run:   runAuth,
+	})
+}
+
+func runAuth(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		args = []string{"login"}
+	}
+
+	return runSubcommand(ctx, a, "auth", map[string]func(context.Context, *app, []string) error{
+		"login":  runAuthLogin,
+		"ls":     runAuthList,
+		"logout": runAuthLogout,
+	}, args)
+}
+
+// runSubcommand dispatches args[0] of a command group.
+func runSubcommand(ctx context.Context, a *app, group string, subcommands map[string]func(context.Context, *app, []string) error, args []string) error {
+	if len(args) == 0 {
+		return usagef("%s: missing subcommand", group)
+	}
+
+	run, ok := subcommands[args[0]]
+	if !ok {
+		return usagef("%s: unknown subcommand %q", group, args[0])
+	}
+
+	return run(ctx, a, args[1:])
+}
+
+func runAuthLogin(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("auth login", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", oauth2.DefaultAuthorizationTimeout, "time to wait for the browser consent")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	accounts, err := a.accounts(oauth2.WithAuthorizationTimeout(*timeout))
+	if err != nil {
+		return err
+	}
+
+	label, err := accounts.Add(ctx, a.account)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.newOutput("ACCOUNT", "AUTHORIZED")
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := out.write(accountRecord{Account: label, Authorized: &now}, label, now.Format(time.RFC3339)); err != nil {
+		return err
+	}
+	return out.flush()
+}
+
+type accountRecord struct {
+	Account        string     `json:"account"`
+	Authorized     *time.Time `json:"authorized,omitempty"`
+	Expiry         *time.Time `json:"expiry,omitempty"`
+	AlreadyInvalid bool       `json:"alreadyInvalid,omitempty"`
+}
+
+func runAuthList(ctx context.Context, a *app, args []string) error {
+	accounts, err := a.accounts()
+	if err != nil {
+		return err
+	}
+
+	labels, err := accounts.List()
+	if err != nil {
+		return err
+	}
+
+	out, err := a.newOutput("ACCOUNT", "EXPIRY")
+	if err != nil {
+		return err
+	}
+	for _, label := range labels {
+		record := accountRecord{Account: label}
+		expiry := ""
+		if token, err := accounts.Token(label); err == nil && !token.Expiry.IsZero() {
+			record.Expiry = &token.Expiry
+			expiry = token.Expiry.Format(time.RFC3339)
+		}
+		if err := out.write(record, label, expiry); err != nil {
+			return err
+		}
+	}
+	return out.flush()
+}
+
+func runAuthLogout(ctx context.Context, a *app, args []string) error {
+	if a.account == "" {
+		return usagef("auth logout: select the account with -account")
+	}
+
+	accounts, err := a.accounts()
+	if err != nil {
+		return err
+	}
+
+	alreadyInvalid, err := accounts.Revoke(ctx, a.account)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.newOutput("ACCOUNT", "REVOKED")
+	if err != nil {
+		return err
+	}
+	status := "revoked"
+	if alreadyInvalid {
+		status = "already invalid"
+	}
+	if err := out.write(accountRecord{Account: a.account, AlreadyInvalid: alreadyInvalid}, a.account, status); err != nil {
+		return err
+	}
+	return out.flush()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/dlph/go-photoslibrary/export"
+)
+
+func init() {
+	register(&command{
+		name:  "export",
+		usage: "export [-format jsonl|csv] [-columns c,...] [-file f] [-list-columns]  export media item metadata for analytics",
+		run:   runExport,
+	})
+}
+
+type columnRecord struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func runExport(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", string(export.JSONL), "jsonl or csv")
+	columnNames := fs.String("columns", strings.Join(export.DefaultColumns, ","), "comma separated columns, in output order")
+	file := fs.String("file", "", "write to the file instead of stdout")
+	listColumns := fs.Bool("list-columns", false, "list the available columns")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *listColumns {
+		out, err := a.newOutput("COLUMN", "DESCRIPTION")
+		if err != nil {
+			return err
+		}
+		for _, c := range export.Columns {
+			if err := out.write(columnRecord{Name: c.Name, Description: c.Description}, c.Name, c.Description); err != nil {
+				return err
+			}
+		}
+		return out.flush()
+	}
+
+	exportFormat, err := export.ParseFormat(*format)
+	if err != nil {
+		return usagef("export: %v", err)
+	}
+	columns, err := export.LookupColumns(strings.Split(*columnNames, ","))
+	if err != nil {
+		return usagef("export: %v", err)
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts := []export.Option{export.WithFormat(exportFormat), export.WithColumns(columns)}
+
+	if *file == "" {
+		_, err := export.Export(ctx, client, a.stdout, opts...)
+		return err
+	}
+
+	f, err := os.Create(*file)
+	if err != nil {
+		return err
+	}
+	if _, err := export.Export(ctx, client, f, opts...); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"strconv"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/gallery"
+)
+
+func init() {
+	register(&command{
+		name:  "gallery",
+		usage: "gallery -dir d [-title t] [-thumb-size n] [-image-size n] [-concurrency n] <album id>...  render albums as a static HTML site",
+		run:   runGallery,
+	})
+}
+
+type galleryRecord struct {
+	Dir    string `json:"dir"`
+	Albums int    `json:"albums"`
+	Items  int    `json:"items"`
+	Bytes  int64  `json:"bytes"`
+}
+
+func runGallery(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("gallery", flag.ContinueOnError)
+	dir := fs.String("dir", "", "site directory")
+	title := fs.String("title", gallery.DefaultTitle, "title of the site index")
+	thumbSize := fs.Int("thumb-size", gallery.DefaultThumbnailSize, "thumbnail bounding box in pixels")
+	imageSize := fs.Int("image-size", gallery.DefaultImageSize, "image bounding box in pixels")
+	concurrency := fs.Int("concurrency", gallery.DefaultConcurrency, "parallel downloads")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return usagef("gallery: -dir is required")
+	}
+	if fs.NArg() == 0 {
+		return usagef("gallery: want at least one album id")
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	var albumList []albums.Album
+	for _, id := range fs.Args() {
+		album, err := albums.Get(ctx, client, albums.GetAlbumRequest{AlbumID: id})
+		if err != nil {
+			return err
+		}
+		albumList = append(albumList, album)
+	}
+
+	report, err := gallery.Generate(ctx, client, *dir, albumList,
+		gallery.WithTitle(*title),
+		gallery.WithThumbnailSize(*thumbSize),
+		gallery.WithImageSize(*imageSize),
+		gallery.WithConcurrency(*concurrency),
+	)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.newOutput("DIR", "ALBUMS", "ITEMS", "BYTES")
+	if err != nil {
+		return err
+	}
+	record := galleryRecord{Dir: *dir, Albums: report.Albums, Items: report.Items, Bytes: report.Bytes}
+	if err := out.write(record, record.Dir, strconv.Itoa(record.Albums), strconv.Itoa(record.Items), strconv.FormatInt(record.Bytes, 10)); err != nil {
+		return err
+	}
+	return out.flush()
+}
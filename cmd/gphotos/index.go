@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/index"
+	"github.com/dlph/go-photoslibrary/match"
+	"github.com/dlph/go-photoslibrary/snapshot"
+)
+
+func init() {
+	register(&command{
+		name:  "index",
+		usage: "index refresh [-full] [-file f] [-lookback d] | query [-file f] [-after d] [-before d] [-album id] [-camera m] [-mime t] [-filename p] [-limit n]",
+		run:   runIndex,
+	})
+}
+
+func runIndex(ctx context.Context, a *app, args []string) error {
+	return runSubcommand(ctx, a, "index", map[string]func(context.Context, *app, []string) error{
+		"refresh": runIndexRefresh,
+		"query":   runIndexQuery,
+	}, args)
+}
+
+// defaultIndexFile is the index of the selected account in the user cache
+// directory.
+func (a *app) defaultIndexFile() string {
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		userCacheDir = os.TempDir()
+	}
+	base := "index"
+	if a.account != "" {
+		base += "-" + url.PathEscape(a.account)
+	}
+	return filepath.Join(userCacheDir, configDirName, base+snapshot.FileExt)
+}
+
+func runIndexRefresh(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("index refresh", flag.ContinueOnError)
+	full := fs.Bool("full", false, "list the whole library again, catching deletions")
+	file := fs.String("file", a.defaultIndexFile(), "index file")
+	lookback := fs.Duration("lookback", index.DefaultLookback, "how far before the newest item new items are looked for")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*file), 0o700); err != nil {
+		return err
+	}
+	x, err := index.Open(*file, index.WithLookback(*lookback))
+	if err != nil {
+		return err
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	var report index.Report
+	if *full {
+		report, err = x.Rebuild(ctx, client)
+	} else {
+		report, err = x.Refresh(ctx, client)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.stderr, "%d added, %d updated, %d removed, %d albums walked, %d media items indexed\n",
+		report.Added, report.Updated, report.Removed, report.AlbumsWalked, x.Len())
+	return nil
+}
+
+func runIndexQuery(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("index query", flag.ContinueOnError)
+	file := fs.String("file", a.defaultIndexFile(), "index file")
+	after := fs.String("after", "", "only items created on the YYYY-MM-DD date or later")
+	before := fs.String("before", "", "only items created before the YYYY-MM-DD date")
+	albumID := fs.String("album", "", "only items in the album")
+	camera := fs.String("camera", "", "only items of the camera model, e.g. \"Apple iPhone 12\"")
+	mimeTypes := fs.String("mime", "", "only items of the comma separated MIME types, e.g. image/*")
+	filename := fs.String("filename", "", "only items whose filename matches the pattern, e.g. img_*.jpg")
+	limit := fs.Int("limit", 0, "maximum number of items, 0 for all")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	start, err := parseDay(*after)
+	if err != nil {
+		return usagef("index query: -after: %v", err)
+	}
+	end, err := parseDay(*before)
+	if err != nil {
+		return usagef("index query: -before: %v", err)
+	}
+
+	x, err := index.Open(*file)
+	if err != nil {
+		return err
+	}
+	if x.UpdatedAt().IsZero() {
+		return fmt.Errorf("index %s is empty, run gphotos index refresh", *file)
+	}
+
+	scope := index.Scope{Start: start, End: end, AlbumID: *albumID}
+	if *albumID != "" && !x.HasAlbum(*albumID) {
+		return fmt.Errorf("album %s is not indexed", *albumID)
+	}
+	if *mimeTypes != "" {
+		scope.MimeTypes = strings.Split(*mimeTypes, ",")
+	}
+
+	var predicates []match.Predicate
+	if *camera != "" {
+		predicates = append(predicates, match.CameraModel(*camera))
+	}
+	if *filename != "" {
+		p, err := match.FilenameGlob(*filename)
+		if err != nil {
+			return usagef("index query: -filename: %v", err)
+		}
+		predicates = append(predicates, p)
+	}
+
+	out, err := a.newOutput(itemHeader...)
+	if err != nil {
+		return err
+	}
+	for i, item := range x.Select(scope, match.And(predicates...)) {
+		if *limit > 0 && i >= *limit {
+			break
+		}
+		if err := out.write(item, itemRow(item)...); err != nil {
+			return err
+		}
+	}
+	return out.flush()
+}
+
+// parseDay parses a YYYY-MM-DD date as midnight UTC, the empty string as
+// the zero time.
+func parseDay(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("want YYYY-MM-DD, got %q", s)
+	}
+	return t, nil
+}
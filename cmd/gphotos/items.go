@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+	"github.com/dlph/go-photoslibrary/query"
+)
+
+func init() {
+	register(&command{
+		name:  "items",
+		usage: "items ls [-limit n] | get <id> | search [-album id] [-limit n] [query]",
+		run:   runItems,
+	})
+}
+
+var itemHeader = []string{"ID", "FILENAME", "MIME TYPE", "CREATED"}
+
+func itemRow(item mediaitems.MediaItem) []string {
+	created := ""
+	if item.MediaMetadata != nil && !item.MediaMetadata.CreationTime.IsZero() {
+		created = item.MediaMetadata.CreationTime.Format(time.RFC3339)
+	}
+	return []string{item.ID, item.Filename, item.MimeType, created}
+}
+
+func runItems(ctx context.Context, a *app, args []string) error {
+	return runSubcommand(ctx, a, "items", map[string]func(context.Context, *app, []string) error{
+		"ls":     runItemsList,
+		"get":    runItemsGet,
+		"search": runItemsSearch,
+	}, args)
+}
+
+func runItemsList(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("items ls", flag.ContinueOnError)
+	limit := fs.Int("limit", 0, "maximum number of items, 0 for all")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	itemCh, errCh := mediaitems.List(ctx, client, mediaitems.ListMediaItemsRequest{PageSize: api.MaxPageSize})
+
+	return a.writeItems(ctx, cancel, itemCh, errCh, *limit)
+}
+
+func runItemsSearch(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("items search", flag.ContinueOnError)
+	albumID := fs.String("album", "", "only items in the album")
+	limit := fs.Int("limit", 0, "maximum number of items, 0 for all")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	q := strings.Join(fs.Args(), " ")
+	req, err := query.Parse(q)
+	var syntaxErr *query.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		fmt.Fprintf(a.stderr, "  %s\n  %s^\n", q, strings.Repeat(" ", syntaxErr.Column()-1))
+		return usagef("items search: %v", err)
+	} else if err != nil {
+		return err
+	}
+	if *albumID != "" {
+		if req.Filters != nil || req.AlbumID != "" {
+			return usagef("items search: -album cannot be combined with filters")
+		}
+		req.AlbumID = *albumID
+	}
+	req.PageSize = api.MaxPageSize
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	itemCh, errCh := mediaitems.Search(ctx, client, req)
+
+	return a.writeItems(ctx, cancel, itemCh, errCh, *limit)
+}
+
+// writeItems outputs up to limit items, cancelling the stream once the limit
+// is reached. A stream which ended because ctx was cancelled is an error.
+func (a *app) writeItems(ctx context.Context, cancel context.CancelFunc, itemCh <-chan mediaitems.MediaItem, errCh <-chan error, limit int) error {
+	out, err := a.newOutput(itemHeader...)
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	for item := range itemCh {
+		if err := out.write(item, itemRow(item)...); err != nil {
+			return err
+		}
+		if n++; limit > 0 && n >= limit {
+			cancel()
+			return out.flush()
+		}
+	}
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return err
+		}
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return out.flush()
+}
+
+func runItemsGet(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return usagef("items get: want exactly one media item id")
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	item, err := mediaitems.Get(ctx, client, mediaitems.GetMediaItemRequest{MediaItemID: args[0]})
+	if err != nil {
+		return err
+	}
+
+	out, err := a.newOutput(itemHeader...)
+	if err != nil {
+		return err
+	}
+	if err := out.write(item, itemRow(item)...); err != nil {
+		return err
+	}
+	return out.flush()
+}
@@ -0,0 +1,279 @@
+// Command gphotos is a command-line client for the Google Photos Library API.
+//
+// Usage:
+//
+//	gphotos [flags] <command> [command flags] [args]
+//
+// Run gphotos -h for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/oauth2"
+
+	"golang.org/x/exp/slog"
+	xoauth2 "golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// Exit codes shared by all commands.
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2
+	exitAuth        = 3
+	exitNotFound    = 4
+	exitRateLimited = 5
+	exitAPIError    = 6
+)
+
+const (
+	configDirName       = "gphotos"
+	credentialsFileName = "credentials.json"
+	tokensDirName       = "tokens"
+
+	credentialsEnvKey = "GPHOTOS_CREDENTIALS"
+	accountEnvKey     = "GPHOTOS_ACCOUNT"
+)
+
+// scopes requested by auth, enough for every command.
+var scopes = []oauth2.Scope{
+	oauth2.ScopePhotosLibraryReadonly,
+	oauth2.ScopePhotosLibraryAppendOnly,
+	oauth2.ScopePhotosLibraryEditAppCreatedData,
+	oauth2.ScopeOpenID,
+	oauth2.ScopeEmail,
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, app *app, args []string) error
+}
+
+// commands is populated by the init functions of the command files.
+var commands = make(map[string]*command)
+
+func register(cmd *command) {
+	commands[cmd.name] = cmd
+}
+
+// usageError is reported with exit code exitUsage.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+type app struct {
+	configDir   string
+	credentials string
+	account     string
+	output      string
+
+	stdout io.Writer
+	stderr io.Writer
+
+	// httpClient overrides the account client, used in tests.
+	httpClient *http.Client
+}
+
+func (a *app) oauth2Config() (*xoauth2.Config, error) {
+	data, err := os.ReadFile(a.credentials)
+	if err != nil {
+		return nil, fmt.Errorf("reading client credentials, download them from the Google Developer Console: %w", err)
+	}
+
+	return google.ConfigFromJSON(data, oauth2.Scopes(scopes...)...)
+}
+
+func (a *app) accounts(opts ...oauth2.Option) (*oauth2.Accounts, error) {
+	config, err := a.oauth2Config()
+	if err != nil {
+		return nil, err
+	}
+
+	store := oauth2.NewFileTokenStore(filepath.Join(a.configDir, tokensDirName))
+
+	opts = append([]oauth2.Option{
+		oauth2.WithEphemeralPort(),
+		oauth2.WithBrowser(oauth2.SystemBrowser),
+	}, opts...)
+
+	return oauth2.NewAccounts(config, store, opts...), nil
+}
+
+// client returns the http client of the selected account. Without -account
+// the only stored account is used.
+func (a *app) client(ctx context.Context) (*http.Client, error) {
+	return a.accountClient(ctx, a.account)
+}
+
+// accountClient returns the http client of the account, of the only stored
+// account when empty.
+func (a *app) accountClient(ctx context.Context, account string) (*http.Client, error) {
+	if a.httpClient != nil {
+		return a.httpClient, nil
+	}
+
+	accounts, err := a.accounts()
+	if err != nil {
+		return nil, err
+	}
+
+	if account == "" {
+		labels, err := accounts.List()
+		if err != nil {
+			return nil, err
+		}
+		switch len(labels) {
+		case 0:
+			return nil, fmt.Errorf("no authorized account, run gphotos auth: %w", oauth2.ErrTokenNotFound)
+		case 1:
+			account = labels[0]
+		default:
+			return nil, usagef("multiple accounts %s, select one with -account", strings.Join(labels, ", "))
+		}
+	}
+
+	return accounts.Client(ctx, account)
+}
+
+func (a *app) newOutput(header ...string) (*output, error) {
+	return newOutput(a.output, a.stdout, header...)
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	a := &app{stdout: stdout, stderr: stderr}
+	return a.run(ctx, args)
+}
+
+func (a *app) run(ctx context.Context, args []string) int {
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		userConfigDir = "."
+	}
+
+	fs := flag.NewFlagSet("gphotos", flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.StringVar(&a.configDir, "config-dir", filepath.Join(userConfigDir, configDirName), "directory holding credentials and tokens")
+	fs.StringVar(&a.credentials, "credentials", os.Getenv(credentialsEnvKey), "OAuth client credentials JSON, defaults to <config-dir>/"+credentialsFileName)
+	fs.StringVar(&a.account, "account", os.Getenv(accountEnvKey), "account label, required when several accounts are authorized")
+	fs.StringVar(&a.output, "o", formatTable, "output format: table, json or jsonl")
+	verbose := fs.Bool("v", false, "debug logging")
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: gphotos [flags] <command> [args]\n\nCommands:\n")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(a.stderr, "  %s\n", commands[name].usage)
+		}
+		fmt.Fprintf(a.stderr, "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if *verbose {
+		slog.SetDefault(slog.New(slog.NewTextHandler(a.stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	}
+
+	if a.credentials == "" {
+		a.credentials = filepath.Join(a.configDir, credentialsFileName)
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(a.stderr, "gphotos: unknown command %q\n", fs.Arg(0))
+		fs.Usage()
+		return exitUsage
+	}
+
+	if err := cmd.run(ctx, a, fs.Args()[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		fmt.Fprintf(a.stderr, "gphotos %s: %v\n", cmd.name, err)
+		return exitCode(err)
+	}
+
+	return exitOK
+}
+
+// exitCode maps an error to the exit code documented for all commands.
+func exitCode(err error) int {
+	var usageErr *usageError
+	var authErr *oauth2.AuthorizationError
+	var apiErr *api.Error
+
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.As(err, &authErr),
+		errors.Is(err, oauth2.ErrTokenNotFound),
+		errors.Is(err, oauth2.ErrAuthorizationTimeout),
+		api.IsUnauthenticated(err),
+		api.IsInsufficientScope(err):
+		return exitAuth
+	case api.IsNotFound(err):
+		return exitNotFound
+	case api.IsRateLimited(err):
+		return exitRateLimited
+	case errors.As(err, &apiErr):
+		return exitAPIError
+	default:
+		return exitError
+	}
+}
+
+// parseFlags parses command flags, treating a bad flag as a usage error.
+func (a *app) parseFlags(fs *flag.FlagSet, args []string) error {
+	fs.SetOutput(a.stderr)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usagef("%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+var _ http.RoundTripper = mockRoundTripper{}
+
+type mockRoundTripper struct {
+	roundTripperFn func(*http.Request) (*http.Response, error)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (mock mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return mock.roundTripperFn(req)
+}
+
+func jsonResponse(req *http.Request, statusCode int, v any) (*http.Response, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(data)),
+		Request:    req,
+	}, nil
+}
+
+// newTestApp returns an app whose requests are answered by routes keyed by method and path.
+func newTestApp(t *testing.T, routes map[string]func(*http.Request) (*http.Response, error)) (*app, *bytes.Buffer, *bytes.Buffer) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	return &app{
+		stdout: stdout,
+		stderr: stderr,
+		httpClient: &http.Client{Transport: mockRoundTripper{
+			roundTripperFn: func(req *http.Request) (*http.Response, error) {
+				route, ok := routes[req.Method+" "+req.URL.Path]
+				if !ok {
+					return jsonResponse(req, http.StatusNotFound, map[string]any{
+						"error": map[string]any{"code": 404, "message": "not found", "status": "NOT_FOUND"},
+					})
+				}
+				return route(req)
+			},
+		}},
+	}, stdout, stderr
+}
+
+func TestAlbumsList(t *testing.T) {
+	a, stdout, stderr := newTestApp(t, map[string]func(*http.Request) (*http.Response, error){
+		"GET /v1/albums": func(req *http.Request) (*http.Response, error) {
+			return jsonResponse(req, http.StatusOK, albums.ListAlbumsResponse{
+				Albums: []albums.Album{{ID: "a1", Title: "Holidays", MediaItemsCount: "3"}, {ID: "a2", Title: "Pets"}},
+			})
+		},
+	})
+
+	if code := a.run(context.Background(), []string{"-o", "jsonl", "albums", "ls"}); code != exitOK {
+		t.Fatalf("exit code %d not expected %d: %s", code, exitOK, stderr)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines %d not expected %d: %s", len(lines), 2, stdout)
+	}
+	var album albums.Album
+	if err := json.Unmarshal([]byte(lines[0]), &album); err != nil {
+		t.Fatal(err)
+	}
+	if album.ID != "a1" || album.Title != "Holidays" {
+		t.Errorf("album %+v not expected", album)
+	}
+}
+
+func TestItemsGetTable(t *testing.T) {
+	a, stdout, stderr := newTestApp(t, map[string]func(*http.Request) (*http.Response, error){
+		"GET /v1/mediaItems/m1": func(req *http.Request) (*http.Response, error) {
+			return jsonResponse(req, http.StatusOK, mediaitems.MediaItem{ID: "m1", Filename: "IMG_0001.JPG", MimeType: "image/jpeg"})
+		},
+	})
+
+	if code := a.run(context.Background(), []string{"items", "get", "m1"}); code != exitOK {
+		t.Fatalf("exit code %d not expected %d: %s", code, exitOK, stderr)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[1], "IMG_0001.JPG") {
+		t.Errorf("unexpected table output:\n%s", stdout)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	a, _, _ := newTestApp(t, nil)
+
+	for args, want := range map[string]int{
+		"items get missing":                exitNotFound,
+		"items get":                        exitUsage,
+		"albums rm x":                      exitUsage,
+		"unknown":                          exitUsage,
+		"-o yaml albums ls":                exitUsage,
+		"items search type:audio":          exitUsage,
+		"items search -album a type:photo": exitUsage,
+	} {
+		if code := a.run(context.Background(), strings.Fields(args)); code != want {
+			t.Errorf("%q exit code %d not expected %d", args, code, want)
+		}
+	}
+}
+
+func TestUpload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.jpg")
+	if err := os.WriteFile(file, []byte("jpeg"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, stdout, stderr := newTestApp(t, map[string]func(*http.Request) (*http.Response, error){
+		"POST /v1/uploads": func(req *http.Request) (*http.Response, error) {
+			if got := req.Header.Get(mediaitems.UploadContentTypeHeader); got != "image/jpeg" {
+				t.Errorf("upload content type %q not expected %q", got, "image/jpeg")
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("token-a")), Request: req}, nil
+		},
+		"POST /v1/mediaItems:batchCreate": func(req *http.Request) (*http.Response, error) {
+			var batchReq mediaitems.BatchCreateMediaItemsRequest
+			if err := json.NewDecoder(req.Body).Decode(&batchReq); err != nil {
+				return nil, err
+			}
+			results := make([]mediaitems.NewMediaItemResult, 0, len(batchReq.NewMediaItems))
+			for _, newItem := range batchReq.NewMediaItems {
+				results = append(results, mediaitems.NewMediaItemResult{
+					UploadToken: newItem.SimpleMediaItem.UploadToken,
+					MediaItem:   mediaitems.MediaItem{ID: "m-" + newItem.SimpleMediaItem.FileName},
+				})
+			}
+			return jsonResponse(req, http.StatusOK, mediaitems.BatchCreateMediaItemsResponse{NewMediaItemResults: results})
+		},
+	})
+
+	code := a.run(context.Background(), []string{"-o", "json", "upload", file, filepath.Join(dir, "missing.jpg")})
+	if code != exitError {
+		t.Fatalf("exit code %d not expected %d: %s", code, exitError, stderr)
+	}
+
+	var records []uploadRecord
+	if err := json.Unmarshal(stdout.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("records %d not expected %d", len(records), 2)
+	}
+	if records[0].Status != "failed" || records[1].ID != "m-a.jpg" || records[1].Status != "created" {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
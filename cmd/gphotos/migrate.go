@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/dlph/go-photoslibrary/migrate"
+	"github.com/dlph/go-photoslibrary/upload"
+)
+
+func init() {
+	register(&command{
+		name:  "migrate",
+		usage: "migrate -from account -to account [-dry-run] [-concurrency n] [-mapping file] [-report file]  copy a library to another account",
+		run:   runMigrate,
+	})
+}
+
+func runMigrate(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	from := fs.String("from", "", "account label of the source library")
+	to := fs.String("to", "", "account label of the destination library")
+	dryRun := fs.Bool("dry-run", false, "list the media items which would be copied and the albums which would be created")
+	concurrency := fs.Int("concurrency", migrate.DefaultConcurrency, "parallel transfers")
+	mappingFile := fs.String("mapping", "", "mapping of copied ids which resumes the migration, defaults to migrate-<from>-<to>.jsonl in -config-dir")
+	reportFile := fs.String("report", "", "write the full report as JSON to the file")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	switch {
+	case *from == "" || *to == "":
+		return usagef("migrate: want the -from and -to accounts")
+	case *from == *to:
+		return usagef("migrate: -from and -to are the same account")
+	}
+	if *mappingFile == "" {
+		// labels such as family/archive hold separators
+		*mappingFile = filepath.Join(a.configDir, fmt.Sprintf("migrate-%s-%s.jsonl", url.PathEscape(*from), url.PathEscape(*to)))
+	}
+
+	source, err := a.accountClient(ctx, *from)
+	if err != nil {
+		return err
+	}
+	destination, err := a.accountClient(ctx, *to)
+	if err != nil {
+		return err
+	}
+
+	mapping, err := migrate.OpenMapping(*mappingFile)
+	if err != nil {
+		return err
+	}
+	defer mapping.Close()
+
+	opts := []migrate.Option{migrate.WithConcurrency(*concurrency), migrate.WithMapping(mapping)}
+	if *dryRun {
+		opts = append(opts, migrate.WithDryRun())
+	}
+
+	report, migrateErr := migrate.Run(ctx, source, destination, opts...)
+
+	if *reportFile != "" {
+		data, err := json.MarshalIndent(&report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*reportFile, append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+
+	out, err := a.newOutput("SOURCE ID", "FILENAME", "DESTINATION ID", "STATUS")
+	if err != nil {
+		return err
+	}
+	for _, r := range report.Results {
+		status := string(r.Status)
+		if r.Message != "" {
+			status = fmt.Sprintf("%s: %s", status, r.Message)
+		}
+		if err := out.write(r, r.SourceID, r.Filename, r.DestinationID, status); err != nil {
+			return err
+		}
+	}
+	if err := out.flush(); err != nil {
+		return err
+	}
+
+	failedAlbums := 0
+	for _, r := range report.Albums {
+		if r.Status == upload.StatusFailed {
+			failedAlbums++
+			fmt.Fprintf(a.stderr, "album %q: %s\n", r.Title, r.Message)
+		}
+	}
+	fmt.Fprintf(a.stderr, "%d created, %d copied before, %d failed, %d albums created\n",
+		report.Created, report.Duplicates, report.Failed, len(report.AlbumsCreated))
+
+	if migrateErr == nil && report.Failed+failedAlbums > 0 {
+		return errPartialFailure
+	}
+	return migrateErr
+}
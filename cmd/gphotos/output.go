@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatJSONL = "jsonl"
+)
+
+// output writes command results as an aligned table, a JSON array or JSON Lines.
+type output struct {
+	format string
+	w      io.Writer
+	tw     *tabwriter.Writer
+	values []any
+}
+
+func newOutput(format string, w io.Writer, header ...string) (*output, error) {
+	o := &output{format: format, w: w}
+
+	switch format {
+	case formatTable:
+		o.tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		if len(header) > 0 {
+			if _, err := fmt.Fprintln(o.tw, strings.Join(header, "\t")); err != nil {
+				return nil, err
+			}
+		}
+	case formatJSON:
+		o.values = make([]any, 0)
+	case formatJSONL:
+	default:
+		return nil, usagef("unknown output format %q, want %s, %s or %s", format, formatTable, formatJSON, formatJSONL)
+	}
+
+	return o, nil
+}
+
+// write outputs v, using row as the table columns.
+func (o *output) write(v any, row ...string) error {
+	switch o.format {
+	case formatTable:
+		_, err := fmt.Fprintln(o.tw, strings.Join(row, "\t"))
+		return err
+	case formatJSON:
+		o.values = append(o.values, v)
+		return nil
+	default:
+		return json.NewEncoder(o.w).Encode(v)
+	}
+}
+
+// flush must be called once all values are written.
+func (o *output) flush() error {
+	switch o.format {
+	case formatTable:
+		return o.tw.Flush()
+	case formatJSON:
+		enc := json.NewEncoder(o.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(o.values)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/serve"
+)
+
+func init() {
+	register(&command{
+		name:  "serve",
+		usage: "serve [-addr a] [-cache d] [-cache-size mb] [-max-age d]  serve media items under stable urls",
+		run:   runServe,
+	})
+}
+
+// shutdownTimeout bounds how long requests in flight are waited for on exit.
+const shutdownTimeout = 5 * time.Second
+
+func runServe(ctx context.Context, a *app, args []string) error {
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		userCacheDir = os.TempDir()
+	}
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:8080", "listen address")
+	cacheDir := fs.String("cache", filepath.Join(userCacheDir, configDirName, "serve"), "response cache directory")
+	cacheSize := fs.Int64("cache-size", 1024, "response cache bound in MiB, 0 disables the cache")
+	maxAge := fs.Duration("max-age", serve.DefaultMaxAge, "how long clients may cache responses")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *cacheSize < 0 {
+		return usagef("serve: -cache-size must not be negative")
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts := []serve.Option{serve.WithMaxAge(*maxAge)}
+	if *cacheSize > 0 {
+		cache, err := serve.OpenCache(*cacheDir, *cacheSize<<20)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, serve.WithCache(cache))
+	}
+
+	return listenAndServe(ctx, a, *addr, serve.New(client, opts...))
+}
+
+// listenAndServe serves handler on addr until ctx is done, then waits for
+// requests in flight.
+func listenAndServe(ctx context.Context, a *app, addr string, handler http.Handler) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "serving on http://%s\n", ln.Addr())
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dlph/go-photoslibrary/snapshot"
+)
+
+func init() {
+	register(&command{
+		name:  "snapshot",
+		usage: "snapshot take <file> | diff <old file> <new file>  record the library and report changes",
+		run:   runSnapshot,
+	})
+}
+
+func runSnapshot(ctx context.Context, a *app, args []string) error {
+	return runSubcommand(ctx, a, "snapshot", map[string]func(context.Context, *app, []string) error{
+		"take": runSnapshotTake,
+		"diff": runSnapshotDiff,
+	}, args)
+}
+
+func runSnapshotTake(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return usagef("snapshot take: want exactly one file, e.g. library%s", snapshot.FileExt)
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	s, err := snapshot.Take(ctx, client)
+	if err != nil {
+		return err
+	}
+	if err := snapshot.WriteFile(args[0], s); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.stderr, "%d albums, %d media items\n", len(s.Albums), len(s.MediaItems))
+	return nil
+}
+
+// runSnapshotDiff writes the report as text, or as a JSON object with -o json or jsonl.
+func runSnapshotDiff(ctx context.Context, a *app, args []string) error {
+	if len(args) != 2 {
+		return usagef("snapshot diff: want the old and the new snapshot file")
+	}
+
+	from, err := snapshot.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	to, err := snapshot.ReadFile(args[1])
+	if err != nil {
+		return err
+	}
+
+	report := snapshot.Diff(from, to)
+
+	switch a.output {
+	case formatTable:
+		return report.WriteText(a.stdout)
+	case formatJSON:
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(&report)
+	case formatJSONL:
+		return json.NewEncoder(a.stdout).Encode(&report)
+	default:
+		_, err := a.newOutput() // reports the unknown format
+		return err
+	}
+}
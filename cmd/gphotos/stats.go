@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+	"github.com/dlph/go-photoslibrary/stats"
+)
+
+func init() {
+	register(&command{
+		name:  "stats",
+		usage: "stats [-album id] [-top n]  count media items by year, month, camera, type and resolution",
+		run:   runStats,
+	})
+}
+
+// runStats writes the stats as text, or as a JSON object with -o json or jsonl.
+func runStats(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	albumID := fs.String("album", "", "only items in the album")
+	top := fs.Int("top", 10, "entries listed per ranking in text output, 0 for all")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		itemCh <-chan mediaitems.MediaItem
+		errCh  <-chan error
+	)
+	if *albumID != "" {
+		itemCh, errCh = mediaitems.Search(ctx, client, mediaitems.SearchMediaItemRequest{AlbumID: *albumID, PageSize: api.MaxPageSize})
+	} else {
+		itemCh, errCh = mediaitems.List(ctx, client, mediaitems.ListMediaItemsRequest{PageSize: api.MaxPageSize})
+	}
+
+	s, err := stats.Compute(ctx, itemCh, errCh)
+	if err != nil {
+		return err
+	}
+
+	switch a.output {
+	case formatTable:
+		return s.WriteText(a.stdout, *top)
+	case formatJSON:
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	case formatJSONL:
+		return json.NewEncoder(a.stdout).Encode(s)
+	default:
+		_, err := a.newOutput() // reports the unknown format
+		return err
+	}
+}
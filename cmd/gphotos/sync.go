@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"strconv"
+
+	"github.com/dlph/go-photoslibrary/layout"
+	"github.com/dlph/go-photoslibrary/sync"
+)
+
+func init() {
+	register(&command{
+		name:  "sync",
+		usage: "sync -dir d [-layout t] [-collision p] [-album-links symlink|hardlink] [-xmp] [-embed-metadata] [-dry-run] [-concurrency n]  mirror new media items to a local directory",
+		run:   runSync,
+	})
+}
+
+type syncRecord struct {
+	Listed     int          `json:"listed"`
+	Skipped    int          `json:"skipped"`
+	Downloaded int          `json:"downloaded"`
+	Duplicates int          `json:"duplicates"`
+	Conflicts  int          `json:"conflicts"`
+	Failed     int          `json:"failed"`
+	Bytes      int64        `json:"bytes"`
+	Linked     int          `json:"linked"`
+	Unlinked   int          `json:"unlinked"`
+	Planned    []sync.Entry `json:"planned,omitempty"`
+	Errors     []string     `json:"errors,omitempty"`
+}
+
+func runSync(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	dir := fs.String("dir", "", "local mirror directory")
+	dryRun := fs.Bool("dry-run", false, "list the media items which would be downloaded")
+	concurrency := fs.Int("concurrency", sync.DefaultConcurrency, "parallel downloads")
+	layoutText := fs.String("layout", layout.Default.String(), "path template, e.g. {{album}}/{{date}}_{{id}}.{{ext}}")
+	collision := fs.String("collision", string(layout.Suffix), "collision policy: suffix, skip, overwrite or hash")
+	albumLinks := fs.String("album-links", "", "mirror albums as directories of symlink or hardlink links")
+	sidecars := fs.Bool("xmp", false, "write an XMP sidecar next to every downloaded file")
+	embed := fs.Bool("embed-metadata", false, "embed description, creation time and albums into downloaded JPEGs")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return usagef("sync: -dir is required")
+	}
+
+	tmpl, err := layout.Parse(*layoutText)
+	if err != nil {
+		return usagef("sync: %v", err)
+	}
+	policy, err := layout.ParseCollisionPolicy(*collision)
+	if err != nil {
+		return usagef("sync: %v", err)
+	}
+
+	opts := []sync.Option{
+		sync.WithConcurrency(*concurrency),
+		sync.WithLayout(tmpl),
+		sync.WithCollisionPolicy(policy),
+	}
+	if *albumLinks != "" {
+		mode, err := sync.ParseLinkMode(*albumLinks)
+		if err != nil {
+			return usagef("sync: %v", err)
+		}
+		opts = append(opts, sync.WithAlbumLinks(mode))
+	}
+
+	if *sidecars {
+		opts = append(opts, sync.WithXMPSidecars())
+	}
+	if *embed {
+		opts = append(opts, sync.WithEmbeddedMetadata())
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		opts = append(opts, sync.WithDryRun())
+	}
+
+	report, syncErr := sync.Run(ctx, client, *dir, opts...)
+
+	if *dryRun {
+		out, err := a.newOutput("ID", "PATH")
+		if err != nil {
+			return err
+		}
+		for _, entry := range report.Planned {
+			if err := out.write(entry, entry.ID, entry.Path); err != nil {
+				return err
+			}
+		}
+		if err := out.flush(); err != nil {
+			return err
+		}
+		return syncErr
+	}
+
+	record := syncRecord{
+		Listed:     report.Listed,
+		Skipped:    report.Skipped,
+		Downloaded: report.Downloaded,
+		Duplicates: report.Duplicates,
+		Conflicts:  report.Conflicts,
+		Failed:     report.Failed,
+		Bytes:      report.Bytes,
+		Linked:     report.Linked,
+		Unlinked:   report.Unlinked,
+	}
+	for _, itemErr := range report.Errors {
+		record.Errors = append(record.Errors, itemErr.Error())
+	}
+
+	out, err := a.newOutput("LISTED", "SKIPPED", "DOWNLOADED", "FAILED", "BYTES")
+	if err != nil {
+		return err
+	}
+	if err := out.write(record,
+		strconv.Itoa(record.Listed),
+		strconv.Itoa(record.Skipped),
+		strconv.Itoa(record.Downloaded),
+		strconv.Itoa(record.Failed),
+		strconv.FormatInt(record.Bytes, 10),
+	); err != nil {
+		return err
+	}
+	if err := out.flush(); err != nil {
+		return err
+	}
+
+	if syncErr == nil && report.Failed > 0 {
+		return errPartialFailure
+	}
+	return syncErr
+}
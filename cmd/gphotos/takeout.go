@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dlph/go-photoslibrary/takeout"
+	"github.com/dlph/go-photoslibrary/upload"
+)
+
+func init() {
+	register(&command{
+		name:  "takeout",
+		usage: "takeout [-dry-run] [-concurrency n] [-ledger file] [-report file] <zip or folder>...  import a Google Takeout export",
+		run:   runTakeout,
+	})
+}
+
+func runTakeout(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("takeout", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "list the files which would be uploaded and the albums which would be created")
+	concurrency := fs.Int("concurrency", takeout.DefaultConcurrency, "parallel uploads")
+	ledgerFile := fs.String("ledger", "", "upload ledger, makes repeated imports skip uploaded files")
+	reportFile := fs.String("report", "", "write the full report as JSON to the file")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return usagef("takeout: want at least one zip archive or folder")
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	archive, err := takeout.Open(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	opts := []takeout.Option{takeout.WithConcurrency(*concurrency)}
+	if *dryRun {
+		opts = append(opts, takeout.WithDryRun())
+	}
+	if *ledgerFile != "" {
+		ledger, err := upload.OpenLedger(*ledgerFile)
+		if err != nil {
+			return err
+		}
+		defer ledger.Close()
+
+		opts = append(opts, takeout.WithLedger(ledger))
+	}
+
+	report, importErr := takeout.Import(ctx, client, archive, opts...)
+
+	if *reportFile != "" {
+		data, err := json.MarshalIndent(&report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*reportFile, append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+
+	out, err := a.newOutput("PATH", "ALBUMS", "ID", "STATUS")
+	if err != nil {
+		return err
+	}
+	for _, r := range report.Results {
+		status := string(r.Status)
+		if r.Message != "" {
+			status = fmt.Sprintf("%s: %s", status, r.Message)
+		}
+		if err := out.write(r, r.Path, strings.Join(r.Albums, ", "), r.MediaItemID, status); err != nil {
+			return err
+		}
+	}
+	if err := out.flush(); err != nil {
+		return err
+	}
+
+	if importErr == nil && report.Failed > 0 {
+		return errPartialFailure
+	}
+	return importErr
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+	"github.com/dlph/go-photoslibrary/xmp"
+)
+
+func init() {
+	register(&command{
+		name:  "download",
+		usage: "download [-dir d] [-xmp] [-embed-metadata] <id>...  download original media items",
+		run:   runDownload,
+	})
+	register(&command{
+		name:  "upload",
+		usage: "upload [-album id] [-description text] <file>...  upload files as new media items",
+		run:   runUpload,
+	})
+}
+
+// errPartialFailure is returned when some files of a transfer failed.
+var errPartialFailure = errors.New("some transfers failed")
+
+type downloadRecord struct {
+	ID    string `json:"id"`
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+func runDownload(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("download", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "destination directory")
+	sidecars := fs.Bool("xmp", false, "write an XMP sidecar next to every downloaded file")
+	embed := fs.Bool("embed-metadata", false, "embed description and creation time into downloaded JPEGs")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return usagef("download: want at least one media item id")
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+
+	out, err := a.newOutput("ID", "PATH", "BYTES")
+	if err != nil {
+		return err
+	}
+
+	for _, id := range fs.Args() {
+		// fetch the item for a fresh base url
+		item, err := mediaitems.Get(ctx, client, mediaitems.GetMediaItemRequest{MediaItemID: id})
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(*dir, filepath.Base(item.Filename))
+		n, err := downloadFile(ctx, client, item, path)
+		if err != nil {
+			return err
+		}
+
+		// album titles are left out, finding them means searching every album
+		metadata := xmp.FromMediaItem(item, nil)
+		if *embed && xmp.EmbedsJPEG(item.MimeType) {
+			if err := xmp.EmbedFile(path, metadata); err != nil {
+				return fmt.Errorf("embedding metadata into %s: %w", path, err)
+			}
+			if info, err := os.Stat(path); err == nil {
+				n = info.Size()
+			}
+		}
+		if *sidecars {
+			if err := xmp.WriteSidecar(path, metadata); err != nil {
+				return err
+			}
+		}
+
+		if err := out.write(downloadRecord{ID: id, Path: path, Bytes: n}, id, path, strconv.FormatInt(n, 10)); err != nil {
+			return err
+		}
+	}
+
+	return out.flush()
+}
+
+func downloadFile(ctx context.Context, client *http.Client, item mediaitems.MediaItem, path string) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := mediaitems.Download(ctx, client, item, f)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return n, err
+	}
+
+	return n, f.Close()
+}
+
+type uploadRecord struct {
+	File    string `json:"file"`
+	ID      string `json:"id,omitempty"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+func runUpload(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("upload", flag.ContinueOnError)
+	albumID := fs.String("album", "", "add the new media items to the album")
+	description := fs.String("description", "", "description of every new media item")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return usagef("upload: want at least one file")
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.newOutput("FILE", "ID", "STATUS")
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	files := fs.Args()
+	for start := 0; start < len(files); start += api.MaxBatchCreateSize {
+		end := start + api.MaxBatchCreateSize
+		if end > len(files) {
+			end = len(files)
+		}
+
+		batch := make([]mediaitems.NewMediaItem, 0, end-start)
+		batchFiles := make(map[string]string, end-start) // upload token to file
+		for _, file := range files[start:end] {
+			uploadToken, err := uploadFile(ctx, client, file)
+			if err != nil {
+				var apiErr *api.Error
+				if !errors.As(err, &apiErr) && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+				failed = true
+				if err := out.write(uploadRecord{File: file, Status: "failed", Message: err.Error()}, file, "", "failed: "+err.Error()); err != nil {
+					return err
+				}
+				continue
+			}
+
+			batch = append(batch, mediaitems.NewMediaItem{
+				Description: *description,
+				SimpleMediaItem: mediaitems.SimpleMediaItem{
+					UploadToken: uploadToken,
+					FileName:    filepath.Base(file),
+				},
+			})
+			batchFiles[uploadToken] = file
+		}
+
+		if len(batch) == 0 {
+			continue
+		}
+
+		resp, err := mediaitems.BatchCreate(ctx, client, mediaitems.BatchCreateMediaItemsRequest{
+			AlbumID:       *albumID,
+			NewMediaItems: batch,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, result := range resp.NewMediaItemResults {
+			file := batchFiles[result.UploadToken]
+			record := uploadRecord{File: file, ID: result.MediaItem.ID, Status: "created"}
+			if !result.Succeeded() {
+				failed = true
+				record.Status = "failed"
+				record.Message = result.Status.Message
+			}
+
+			status := record.Status
+			if record.Message != "" {
+				status = fmt.Sprintf("%s: %s", status, record.Message)
+			}
+			if err := out.write(record, file, record.ID, status); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := out.flush(); err != nil {
+		return err
+	}
+
+	if failed {
+		return errPartialFailure
+	}
+	return nil
+}
+
+// uploadFile uploads the bytes of file, returning the upload token.
+func uploadFile(ctx context.Context, client *http.Client, file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return mediaitems.Upload(ctx, client, mediaitems.UploadRequest{
+		Filename: filepath.Base(file),
+		MimeType: mime.TypeByExtension(filepath.Ext(file)),
+		Content:  f,
+	})
+}
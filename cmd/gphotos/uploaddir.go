@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dlph/go-photoslibrary/upload"
+)
+
+func init() {
+	register(&command{
+		name:  "upload-dir",
+		usage: "upload-dir -dir d [-dry-run] [-concurrency n] [-max-photo-size b] [-max-video-size b] [-ledger file] [-no-ledger] [-report file]  upload a directory tree, one album per folder",
+		run:   runUploadDir,
+	})
+	register(&command{
+		name:  "reconcile",
+		usage: "reconcile -ledger file [-prune]  verify the media items recorded in an upload ledger still exist",
+		run:   runReconcile,
+	})
+}
+
+func runUploadDir(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("upload-dir", flag.ContinueOnError)
+	dir := fs.String("dir", "", "directory to upload")
+	dryRun := fs.Bool("dry-run", false, "list the files which would be uploaded and the albums which would be created")
+	concurrency := fs.Int("concurrency", upload.DefaultConcurrency, "parallel uploads")
+	maxPhotoSize := fs.Int64("max-photo-size", upload.MaxPhotoSize, "skip larger photos, in bytes")
+	maxVideoSize := fs.Int64("max-video-size", upload.MaxVideoSize, "skip larger videos, in bytes")
+	reportFile := fs.String("report", "", "write the full report as JSON to the file")
+	ledgerFile := fs.String("ledger", "", "upload ledger, "+upload.LedgerFileName+" in -dir by default")
+	noLedger := fs.Bool("no-ledger", false, "upload every file, even when it was uploaded before")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return usagef("upload-dir: -dir is required")
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts := []upload.Option{
+		upload.WithConcurrency(*concurrency),
+		upload.WithMaxSize(*maxPhotoSize, *maxVideoSize),
+	}
+	if *dryRun {
+		opts = append(opts, upload.WithDryRun())
+	}
+	if !*noLedger {
+		if *ledgerFile == "" {
+			*ledgerFile = filepath.Join(*dir, upload.LedgerFileName)
+		}
+		ledger, err := upload.OpenLedger(*ledgerFile)
+		if err != nil {
+			return err
+		}
+		defer ledger.Close()
+
+		opts = append(opts, upload.WithLedger(ledger))
+	}
+
+	report, uploadErr := upload.Run(ctx, client, *dir, opts...)
+
+	if *reportFile != "" {
+		data, err := json.MarshalIndent(&report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*reportFile, append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+
+	out, err := a.newOutput("PATH", "ALBUM", "ID", "STATUS")
+	if err != nil {
+		return err
+	}
+	for _, r := range report.Results {
+		status := string(r.Status)
+		if r.Message != "" {
+			status = fmt.Sprintf("%s: %s", status, r.Message)
+		}
+		if err := out.write(r, r.Path, r.Album, r.MediaItemID, status); err != nil {
+			return err
+		}
+	}
+	if err := out.flush(); err != nil {
+		return err
+	}
+
+	if uploadErr == nil && report.Failed > 0 {
+		return errPartialFailure
+	}
+	return uploadErr
+}
+
+type reconcileRecord struct {
+	SHA256      string `json:"sha256"`
+	Path        string `json:"path"`
+	MediaItemID string `json:"mediaItemId"`
+	Status      string `json:"status"`
+}
+
+func runReconcile(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	ledgerFile := fs.String("ledger", "", "upload ledger")
+	prune := fs.Bool("prune", false, "remove entries of deleted media items, so their files are uploaded again")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *ledgerFile == "" {
+		return usagef("reconcile: -ledger is required")
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	ledger, err := upload.OpenLedger(*ledgerFile)
+	if err != nil {
+		return err
+	}
+	defer ledger.Close()
+
+	var opts []upload.ReconcileOption
+	if *prune {
+		opts = append(opts, upload.WithPrune())
+	}
+
+	report, reconcileErr := upload.Reconcile(ctx, client, ledger, opts...)
+
+	status := "missing"
+	if *prune {
+		status = "pruned"
+	}
+
+	out, err := a.newOutput("PATH", "ID", "STATUS")
+	if err != nil {
+		return err
+	}
+	for _, entry := range report.Missing {
+		record := reconcileRecord{SHA256: entry.SHA256, Path: entry.Path, MediaItemID: entry.MediaItemID, Status: status}
+		if err := out.write(record, record.Path, record.MediaItemID, record.Status); err != nil {
+			return err
+		}
+	}
+	if err := out.flush(); err != nil {
+		return err
+	}
+
+	if reconcileErr != nil {
+		return reconcileErr
+	}
+	fmt.Fprintf(a.stderr, "checked %d ledger entries, %d verified, %d missing\n", report.Checked, report.Verified, len(report.Missing))
+	return nil
+}
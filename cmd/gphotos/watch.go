@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/watch"
+)
+
+func init() {
+	register(&command{
+		name:  "watch",
+		usage: "watch [-interval d] [-lookback d] [-since t] [-state file]  print media items as they are added",
+		run:   runWatch,
+	})
+}
+
+func runWatch(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	interval := fs.Duration("interval", watch.DefaultInterval, "time between polls")
+	lookback := fs.Duration("lookback", watch.DefaultLookback, "how far before the newest item late items are looked for")
+	since := fs.String("since", "", "also print the items created since the RFC 3339 time")
+	stateFile := fs.String("state", "", "file keeping the watch state across runs")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if a.output == formatJSON {
+		return usagef("watch: -o json cannot stream, use jsonl")
+	}
+
+	opts := []watch.Option{watch.WithInterval(*interval), watch.WithLookback(*lookback)}
+	if *since != "" {
+		t, err := time.Parse(time.RFC3339, *since)
+		if err != nil {
+			return usagef("watch: -since: %v", err)
+		}
+		opts = append(opts, watch.WithSince(t))
+	}
+	if *stateFile != "" {
+		data, err := os.ReadFile(*stateFile)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return err
+		default:
+			var state watch.State
+			if err := json.Unmarshal(data, &state); err != nil {
+				return fmt.Errorf("watch state %s: %w", *stateFile, err)
+			}
+			opts = append(opts, watch.WithState(state))
+		}
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	out, err := a.newOutput(itemHeader...)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var outErr error // stops the watch, callbacks cannot return it
+	opts = append(opts, watch.WithErrorHandler(func(err error) {
+		fmt.Fprintf(a.stderr, "gphotos watch: %v\n", err) // retried on the next poll
+	}))
+	w := watch.New(client, opts...)
+	w.OnNewItem(func(_ context.Context, item watch.NewItem) {
+		if outErr != nil {
+			return
+		}
+		if outErr = out.write(item.Item, itemRow(item.Item)...); outErr == nil {
+			outErr = out.flush()
+		}
+		if outErr != nil {
+			cancel()
+		}
+	})
+	if *stateFile != "" {
+		// saved once the items of a poll were printed, an interrupted run
+		// prints them again rather than missing them
+		w.OnPolled(func(context.Context) {
+			if outErr != nil {
+				return
+			}
+			if outErr = saveWatchState(*stateFile, w.State()); outErr != nil {
+				cancel()
+			}
+		})
+	}
+
+	err = w.Run(ctx)
+	if outErr != nil {
+		return outErr
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// saveWatchState replaces the state file, never leaving it half written.
+func saveWatchState(name string, state watch.State) error {
+	data, err := json.Marshal(&state)
+	if err != nil {
+		return err
+	}
+
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
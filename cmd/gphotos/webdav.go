@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/dav"
+)
+
+func init() {
+	register(&command{
+		name:  "webdav",
+		usage: "webdav [-addr a] [-refresh d]  browse the library read-only over WebDAV",
+		run:   runWebDAV,
+	})
+}
+
+func runWebDAV(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("webdav", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:8081", "listen address")
+	refresh := fs.Duration("refresh", dav.DefaultRefreshInterval, "how long directory listings are reused")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *refresh >= time.Hour {
+		return usagef("webdav: -refresh must be shorter than the hour base urls are valid")
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	return listenAndServe(ctx, a, *addr, dav.Handler(dav.New(client, dav.WithRefreshInterval(*refresh))))
+}
@@ -0,0 +1,217 @@
+// Package dav presents a Photos library as a read-only WebDAV file system,
+// so it can be browsed with file managers:
+//
+//	/albums/<title>/<filename>
+//	/by-date/<yyyy>/<mm>/<filename>
+//
+// Directories are listed when they are first visited and listed again once
+// older than the refresh interval, concurrent visits share one listing. The
+// by-date tree spans the months from the oldest to the newest media item, a
+// month is only searched when it is visited. Sizes are looked up with HEAD requests
+// on the base urls and kept for the life of the file system, the content is
+// only downloaded when a file is read. Files are dated by their creation time.
+package dav
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	gosync "sync"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/webdav"
+)
+
+const (
+	AlbumsDirName = "albums"
+	ByDateDirName = "by-date"
+
+	DefaultRefreshInterval = 5 * time.Minute
+	DefaultConcurrency     = 8
+)
+
+type Config struct {
+	refreshInterval time.Duration
+	concurrency     int
+}
+
+type Option func(*Config)
+
+// WithRefreshInterval sets how long directory listings are used before
+// they are listed again, DefaultRefreshInterval when unset. Base urls
+// expire after about an hour, which bounds the interval.
+func WithRefreshInterval(d time.Duration) Option {
+	return func(c *Config) {
+		if d > 0 {
+			c.refreshInterval = d
+		}
+	}
+}
+
+// WithConcurrency sets the number of parallel size lookups when listing a directory.
+func WithConcurrency(n int) Option {
+	return func(c *Config) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// FS is a read-only webdav.FileSystem of the library client has access to.
+type FS struct {
+	client *http.Client
+	cfg    *Config
+
+	mu         gosync.Mutex
+	albumIndex *albumIndex
+	albumDirs  map[string]*listing // album id to its files
+	dateRange  *dateRange
+	monthDirs  map[string]*listing // by-date/yyyy/mm to its files
+	sizes      map[string]int64    // media item id to size
+	loads      loads
+}
+
+var _ webdav.FileSystem = (*FS)(nil)
+
+// New returns the file system of the library of client.
+func New(client *http.Client, opts ...Option) *FS {
+	cfg := &Config{
+		refreshInterval: DefaultRefreshInterval,
+		concurrency:     DefaultConcurrency,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return &FS{
+		client:    client,
+		cfg:       cfg,
+		albumDirs: make(map[string]*listing),
+		monthDirs: make(map[string]*listing),
+		sizes:     make(map[string]int64),
+	}
+}
+
+// Handler returns a WebDAV handler of fsys which rejects methods that
+// would modify it. PROPFIND requests of infinite depth, which would list
+// the whole library, are rejected as RFC 4918 allows.
+func Handler(fsys *FS) http.Handler {
+	h := &webdav.Handler{
+		FileSystem: fsys,
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				slog.DebugContext(r.Context(), "webdav request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+			}
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PROPFIND":
+			// a missing Depth header means infinity
+			if depth := r.Header.Get("Depth"); depth != "0" && depth != "1" {
+				w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+				w.WriteHeader(http.StatusForbidden)
+				io.WriteString(w, propfindFiniteDepth)
+				return
+			}
+			h.ServeHTTP(w, r)
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			h.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// propfindFiniteDepth is the precondition a PROPFIND of infinite depth fails.
+const propfindFiniteDepth = `<?xml version="1.0" encoding="utf-8"?>
+<D:error xmlns:D="DAV:"><D:propfind-finite-depth/></D:error>
+`
+
+// Mkdir implements webdav.FileSystem, the file system is read-only.
+func (fsys *FS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+// RemoveAll implements webdav.FileSystem, the file system is read-only.
+func (fsys *FS) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+
+// Rename implements webdav.FileSystem, the file system is read-only.
+func (fsys *FS) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+// Stat implements webdav.FileSystem.
+func (fsys *FS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	n, err := fsys.lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.info(ctx, n)
+}
+
+// OpenFile implements webdav.FileSystem, only opening for reading.
+func (fsys *FS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+
+	n, err := fsys.lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := fsys.info(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.dir {
+		return &dirFile{ctx: ctx, fsys: fsys, node: n, info: info}, nil
+	}
+	return &file{ctx: ctx, fsys: fsys, item: n.item, info: info}, nil
+}
+
+// listAlbums lists the albums of the library.
+func (fsys *FS) listAlbums(ctx context.Context) ([]albums.Album, error) {
+	var albumList []albums.Album
+
+	albumCh, errCh := albums.List(ctx, fsys.client, albums.ListAlbumsRequest{PageSize: api.MaxPageSize})
+	for album := range albumCh {
+		albumList = append(albumList, album)
+	}
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+
+	return albumList, ctx.Err()
+}
+
+// collect drains the channels of a media item listing.
+func collect(itemCh <-chan mediaitems.MediaItem, errCh <-chan error) ([]mediaitems.MediaItem, error) {
+	var items []mediaitems.MediaItem
+	for item := range itemCh {
+		items = append(items, item)
+	}
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+
+	return items, nil
+}
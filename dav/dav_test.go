@@ -0,0 +1,249 @@
+package dav
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+var _ http.RoundTripper = mockRoundTripper{}
+
+type mockRoundTripper struct {
+	roundTripperFn func(*http.Request) (*http.Response, error)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (mock mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return mock.roundTripperFn(req)
+}
+
+func newTestClient(downloads *int) *http.Client {
+	items := []mediaitems.MediaItem{
+		{ID: "a", Filename: "IMG.JPG", MimeType: "image/jpeg", BaseURL: "https://lh3.example.com/a",
+			MediaMetadata: &mediaitems.MediaMetadata{CreationTime: time.Date(2023, time.January, 5, 10, 0, 0, 0, time.UTC)}},
+		{ID: "b", Filename: "IMG.JPG", MimeType: "image/jpeg", BaseURL: "https://lh3.example.com/b",
+			MediaMetadata: &mediaitems.MediaMetadata{CreationTime: time.Date(2023, time.January, 6, 10, 0, 0, 0, time.UTC)}},
+		{ID: "c", Filename: "clip.mp4", MimeType: "video/mp4", BaseURL: "https://lh3.example.com/c",
+			MediaMetadata: &mediaitems.MediaMetadata{CreationTime: time.Date(2022, time.December, 24, 18, 0, 0, 0, time.UTC)}},
+	}
+	content := map[string]string{
+		"/a=d":  "content of a",
+		"/b=d":  "content of b",
+		"/c=dv": "content of the video c",
+	}
+
+	return &http.Client{Transport: mockRoundTripper{roundTripperFn: func(req *http.Request) (*http.Response, error) {
+		status := http.StatusOK
+		header := http.Header{}
+		var body []byte
+
+		switch {
+		case req.URL.Host == "lh3.example.com":
+			data := content[req.URL.Path]
+			header.Set("Content-Length", strconv.Itoa(len(data)))
+			if req.Method == http.MethodGet {
+				*downloads++
+				if r := req.Header.Get("Range"); r != "" {
+					offset, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r, "bytes="), "-"))
+					status, data = http.StatusPartialContent, data[offset:]
+				}
+				body = []byte(data)
+			}
+		case req.URL.Path == "/v1/albums":
+			body, _ = json.Marshal(albums.ListAlbumsResponse{Albums: []albums.Album{{ID: "1", Title: "Trip"}, {ID: "2", Title: "Trip"}}})
+		case req.URL.Path == "/v1/mediaItems:search":
+			var search mediaitems.SearchMediaItemRequest
+			json.NewDecoder(req.Body).Decode(&search)
+			var members []mediaitems.MediaItem
+			switch {
+			case search.Filters != nil:
+				members = searchDates(items, search)
+			case search.AlbumID == "2":
+				members = items[2:]
+			default:
+				members = items[:2]
+			}
+			body, _ = json.Marshal(mediaitems.SearchMediaItemResponse{MediaItems: members})
+		default:
+			// the by-date tree only searches
+			status = http.StatusNotFound
+		}
+
+		resp := &http.Response{
+			StatusCode: status,
+			Header:     header,
+			Body:       io.NopCloser(bytes.NewReader(body)),
+			Request:    req,
+		}
+		if n := header.Get("Content-Length"); n != "" {
+			resp.ContentLength, _ = strconv.ParseInt(n, 10, 64)
+		} else {
+			resp.ContentLength = int64(len(body))
+		}
+		return resp, nil
+	}}}
+}
+
+// searchDates matches the items in the date range of the search, in its order.
+func searchDates(items []mediaitems.MediaItem, search mediaitems.SearchMediaItemRequest) []mediaitems.MediaItem {
+	date := func(d mediaitems.Date) string {
+		return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+	}
+	r := search.Filters.DateFilter.Ranges[0]
+
+	var matched []mediaitems.MediaItem
+	for _, item := range items {
+		if d := date(mediaitems.NewDate(item.MediaMetadata.CreationTime)); d >= date(r.StartDate) && d <= date(r.EndDate) {
+			matched = append(matched, item)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		less := matched[i].MediaMetadata.CreationTime.Before(matched[j].MediaMetadata.CreationTime)
+		if search.OrderBy == mediaitems.OrderByCreationTimeDesc {
+			return !less
+		}
+		return less
+	})
+	if search.PageSize > 0 && int64(len(matched)) > search.PageSize {
+		matched = matched[:search.PageSize]
+	}
+	return matched
+}
+
+func TestHandler(t *testing.T) {
+	downloads := 0
+	h := Handler(New(newTestClient(&downloads)))
+
+	do := func(method, target string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, tt := range []struct {
+		target string
+		wants  []string
+	}{
+		{"/", []string{"<D:href>/albums/</D:href>", "<D:href>/by-date/</D:href>"}},
+		{"/albums/", []string{"<D:href>/albums/Trip/</D:href>", "<D:href>/albums/Trip%202/</D:href>"}},
+		{"/albums/Trip/", []string{
+			"<D:href>/albums/Trip/IMG.JPG</D:href>",
+			"<D:href>/albums/Trip/IMG_1.JPG</D:href>",
+			"<D:getcontentlength>12</D:getcontentlength>",
+			"<D:getlastmodified>Thu, 05 Jan 2023 10:00:00 GMT</D:getlastmodified>",
+			"<D:getcontenttype>image/jpeg</D:getcontenttype>",
+		}},
+		{"/by-date/", []string{"<D:href>/by-date/2022/</D:href>", "<D:href>/by-date/2023/</D:href>"}},
+		{"/by-date/2023/", []string{"<D:href>/by-date/2023/01/</D:href>"}},
+		{"/by-date/2022/12/", []string{
+			"<D:href>/by-date/2022/12/clip.mp4</D:href>",
+			"<D:getcontentlength>22</D:getcontentlength>",
+			"<D:getcontenttype>video/mp4</D:getcontenttype>",
+		}},
+	} {
+		rec := do("PROPFIND", tt.target, map[string]string{"Depth": "1"})
+		if rec.Code != http.StatusMultiStatus {
+			t.Errorf("PROPFIND %s status %d", tt.target, rec.Code)
+			continue
+		}
+		for _, want := range tt.wants {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("PROPFIND %s lacks %s:\n%s", tt.target, want, rec.Body)
+			}
+		}
+	}
+	if downloads != 0 {
+		t.Errorf("listing downloaded %d files", downloads)
+	}
+
+	if rec := do(http.MethodGet, "/by-date/2023/01/IMG_1.JPG", nil); rec.Code != http.StatusOK || rec.Body.String() != "content of b" {
+		t.Errorf("GET status %d body %q", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/albums/Trip%202/clip.mp4", map[string]string{"Range": "bytes=11-"}); rec.Code != http.StatusPartialContent || rec.Body.String() != "the video c" {
+		t.Errorf("ranged GET status %d body %q", rec.Code, rec.Body)
+	}
+
+	for _, depth := range []string{"infinity", ""} {
+		rec := do("PROPFIND", "/", map[string]string{"Depth": depth})
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "<D:propfind-finite-depth/>") {
+			t.Errorf("PROPFIND of depth %q status %d body %q", depth, rec.Code, rec.Body)
+		}
+	}
+	if rec := do("PROPFIND", "/albums/Trip/IMG.JPG", map[string]string{"Depth": "0"}); rec.Code != http.StatusMultiStatus {
+		t.Errorf("PROPFIND of depth 0 status %d", rec.Code)
+	}
+
+	for _, tt := range []struct {
+		method, target string
+		status         int
+	}{
+		{http.MethodGet, "/albums/Other/IMG.JPG", http.StatusNotFound},
+		{http.MethodGet, "/by-date/2023/02/IMG.JPG", http.StatusNotFound},
+		{http.MethodGet, "/by-date/2023/13/IMG.JPG", http.StatusNotFound},
+		{http.MethodPut, "/albums/Trip/new.jpg", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/albums/Trip/IMG.JPG", http.StatusMethodNotAllowed},
+		{"MKCOL", "/albums/New/", http.StatusMethodNotAllowed},
+	} {
+		if rec := do(tt.method, tt.target, nil); rec.Code != tt.status {
+			t.Errorf("%s %s status %d, want %d", tt.method, tt.target, rec.Code, tt.status)
+		}
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	var (
+		l       loads
+		calls   atomic.Int32
+		release = make(chan struct{})
+		ready   gosync.WaitGroup
+		wg      gosync.WaitGroup
+	)
+
+	results := make([]int, 4)
+	for i := range results {
+		ready.Add(1)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ready.Done()
+			results[i], _ = coalesce(context.Background(), &l, "key", func() (int, error) {
+				calls.Add(1)
+				<-release
+				return 42, nil
+			})
+		}(i)
+	}
+
+	// one caller loads while the others wait for it
+	ready.Wait()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("loaded %d times, want once", n)
+	}
+	for i, v := range results {
+		if v != 42 {
+			t.Errorf("caller %d got %d", i, v)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package dav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	gosync "sync"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/webdav"
+)
+
+// fileInfo implements fs.FileInfo and webdav.ContentTyper, so listing a
+// directory does not read its files to sniff their type.
+type fileInfo struct {
+	name     string
+	size     int64
+	modTime  time.Time
+	dir      bool
+	mimeType string
+}
+
+var _ webdav.ContentTyper = (*fileInfo)(nil)
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.dir }
+func (fi *fileInfo) Sys() any           { return nil }
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+// ContentType implements webdav.ContentTyper.
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.dir || fi.mimeType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.mimeType, nil
+}
+
+// info returns the file info of the node, looking up the size of files.
+func (fsys *FS) info(ctx context.Context, n node) (*fileInfo, error) {
+	fi := &fileInfo{name: n.name, modTime: n.modTime, dir: n.dir}
+	if n.dir {
+		return fi, nil
+	}
+
+	size, err := fsys.size(ctx, n.item)
+	if err != nil {
+		return nil, err
+	}
+	fi.size, fi.mimeType = size, n.item.MimeType
+	return fi, nil
+}
+
+// infos returns the file infos of the nodes, looking up unknown sizes in parallel.
+func (fsys *FS) infos(ctx context.Context, nodes []node) ([]fs.FileInfo, error) {
+	infos := make([]fs.FileInfo, len(nodes))
+	errs := make([]error, len(nodes))
+
+	sem := make(chan struct{}, fsys.cfg.concurrency)
+	var wg gosync.WaitGroup
+	for i, n := range nodes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, n node) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fi, err := fsys.info(ctx, n)
+			infos[i], errs[i] = fi, err
+		}(i, n)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// size returns the size of the item's bytes, from the Content-Length of a
+// HEAD request as the API does not tell it.
+func (fsys *FS) size(ctx context.Context, item mediaitems.MediaItem) (int64, error) {
+	fsys.mu.Lock()
+	size, ok := fsys.sizes[item.ID]
+	fsys.mu.Unlock()
+	if ok {
+		return size, nil
+	}
+
+	resp, err := fsys.request(ctx, http.MethodHead, &item, 0)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	size = resp.ContentLength
+	if size < 0 {
+		// no length, count the bytes
+		if resp, err = fsys.request(ctx, http.MethodGet, &item, 0); err != nil {
+			return 0, err
+		}
+		size, err = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	fsys.mu.Lock()
+	fsys.sizes[item.ID] = size
+	fsys.mu.Unlock()
+
+	return size, nil
+}
+
+// request requests the item's bytes from offset, refreshing the item once
+// when its base url was rejected.
+func (fsys *FS) request(ctx context.Context, method string, item *mediaitems.MediaItem, offset int64) (*http.Response, error) {
+	resp, err := fsys.do(ctx, method, *item, offset)
+
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) {
+		slog.DebugContext(ctx, "refreshing media item base url", "id", item.ID, "error", err)
+		refreshed, getErr := mediaitems.Get(ctx, fsys.client, mediaitems.GetMediaItemRequest{MediaItemID: item.ID})
+		if getErr != nil {
+			return nil, getErr
+		}
+		*item = refreshed
+		resp, err = fsys.do(ctx, method, *item, offset)
+	}
+	return resp, err
+}
+
+func (fsys *FS) do(ctx context.Context, method string, item mediaitems.MediaItem, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, mediaitems.DownloadURL(item), nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := fsys.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := api.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+
+	if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		// ranges are not supported, skip to the offset
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// dirFile is an opened directory.
+type dirFile struct {
+	ctx  context.Context
+	fsys *FS
+	node node
+	info *fileInfo
+
+	pos int // of the next entry of Readdir
+}
+
+func (d *dirFile) Close() error                { return nil }
+func (d *dirFile) Stat() (fs.FileInfo, error)  { return d.info, nil }
+func (d *dirFile) Write(p []byte) (int, error) { return 0, os.ErrPermission }
+func (d *dirFile) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: errors.New("is a directory")}
+}
+func (d *dirFile) Seek(int64, int) (int64, error) {
+	return 0, &fs.PathError{Op: "seek", Path: d.node.name, Err: errors.New("is a directory")}
+}
+
+// Readdir implements http.File, count limits the entries like os.File.Readdir.
+func (d *dirFile) Readdir(count int) ([]fs.FileInfo, error) {
+	rest := d.node.children[d.pos:]
+	if count > 0 {
+		if len(rest) == 0 {
+			return nil, io.EOF
+		}
+		if count < len(rest) {
+			rest = rest[:count]
+		}
+	}
+
+	infos, err := d.fsys.infos(d.ctx, rest)
+	if err != nil {
+		return nil, err
+	}
+	d.pos += len(rest)
+	return infos, nil
+}
+
+// file is an opened media item, its content is requested from the
+// current offset on the first read after opening or seeking.
+type file struct {
+	ctx  context.Context
+	fsys *FS
+	item mediaitems.MediaItem
+	info *fileInfo
+
+	offset int64
+	body   io.ReadCloser
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.info.name, Err: errors.New("not a directory")}
+}
+func (f *file) Write(p []byte) (int, error) { return 0, os.ErrPermission }
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.offset >= f.info.size {
+		return 0, io.EOF
+	}
+
+	if f.body == nil {
+		resp, err := f.fsys.request(f.ctx, http.MethodGet, &f.item, f.offset)
+		if err != nil {
+			return 0, err
+		}
+		f.body = resp.Body
+	}
+
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.name, Err: fs.ErrInvalid}
+	}
+
+	if offset != f.offset && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *file) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	err := f.body.Close()
+	f.body = nil
+	return err
+}
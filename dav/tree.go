@@ -0,0 +1,413 @@
+package dav
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/layout"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+// node is a directory or a file of the tree.
+type node struct {
+	name    string
+	dir     bool
+	modTime time.Time
+
+	item     mediaitems.MediaItem // of files
+	children []node               // of directories
+}
+
+// albumIndex is the listing of the albums directory.
+type albumIndex struct {
+	loadedAt time.Time
+	dirs     []node
+	byName   map[string]albums.Album
+}
+
+// listing is a directory of media items.
+type listing struct {
+	loadedAt time.Time
+	files    []node
+}
+
+// dateRange spans the months from the oldest to the newest media item,
+// the directories of the by-date tree.
+type dateRange struct {
+	loadedAt time.Time
+	years    []node // directories of months
+}
+
+// dateSlack widens the date filter, the API matches dates in an unknown
+// time zone.
+const dateSlack = 24 * time.Hour
+
+// loads coalesces concurrent loads of the same directory, callers which
+// arrive while it is loading wait for its result.
+type loads struct {
+	mu      gosync.Mutex
+	pending map[string]*load
+}
+
+type load struct {
+	done chan struct{}
+	v    any
+	err  error
+}
+
+// coalesce calls fn unless a load of key is in progress, then it waits for
+// that load instead.
+func coalesce[T any](ctx context.Context, l *loads, key string, fn func() (T, error)) (T, error) {
+	l.mu.Lock()
+	if c, ok := l.pending[key]; ok {
+		l.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.v.(T), c.err
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+	if l.pending == nil {
+		l.pending = make(map[string]*load)
+	}
+	c := &load{done: make(chan struct{})}
+	l.pending[key] = c
+	l.mu.Unlock()
+
+	v, err := fn()
+	c.v, c.err = v, err
+
+	l.mu.Lock()
+	delete(l.pending, key)
+	l.mu.Unlock()
+	close(c.done)
+
+	return v, err
+}
+
+func (fsys *FS) fresh(loadedAt time.Time) bool {
+	return time.Since(loadedAt) < fsys.cfg.refreshInterval
+}
+
+// lookup returns the node of the slash separated name, listing the
+// directories on its path as needed.
+func (fsys *FS) lookup(ctx context.Context, name string) (node, error) {
+	p := path.Clean("/" + name)
+	var parts []string
+	if p != "/" {
+		parts = strings.Split(p[1:], "/")
+	}
+
+	notExist := &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+
+	switch {
+	case len(parts) == 0:
+		return node{name: "/", dir: true, children: []node{
+			{name: AlbumsDirName, dir: true},
+			{name: ByDateDirName, dir: true},
+		}}, nil
+
+	case parts[0] == AlbumsDirName && len(parts) <= 3:
+		index, err := fsys.loadAlbumIndex(ctx)
+		if err != nil {
+			return node{}, err
+		}
+		if len(parts) == 1 {
+			return node{name: AlbumsDirName, dir: true, modTime: index.loadedAt, children: index.dirs}, nil
+		}
+
+		album, ok := index.byName[parts[1]]
+		if !ok {
+			return node{}, notExist
+		}
+		l, err := fsys.loadAlbum(ctx, album.ID)
+		if err != nil {
+			return node{}, err
+		}
+		if len(parts) == 2 {
+			return node{name: parts[1], dir: true, modTime: l.loadedAt, children: l.files}, nil
+		}
+		return findFile(l, parts[2], notExist)
+
+	case parts[0] == ByDateDirName && len(parts) <= 4:
+		r, err := fsys.loadDateRange(ctx)
+		if err != nil {
+			return node{}, err
+		}
+		if len(parts) == 1 {
+			return node{name: ByDateDirName, dir: true, modTime: r.loadedAt, children: r.years}, nil
+		}
+
+		year := findDir(r.years, parts[1])
+		if year == nil {
+			return node{}, notExist
+		}
+		if len(parts) == 2 {
+			return *year, nil
+		}
+
+		month := findDir(year.children, parts[2])
+		if month == nil {
+			return node{}, notExist
+		}
+		l, err := fsys.loadMonth(ctx, month.modTime)
+		if err != nil {
+			return node{}, err
+		}
+		if len(parts) == 3 {
+			dir := *month
+			dir.children = l.files
+			return dir, nil
+		}
+		return findFile(l, parts[3], notExist)
+	}
+
+	return node{}, notExist
+}
+
+func findDir(dirs []node, name string) *node {
+	for i := range dirs {
+		if dirs[i].name == name {
+			return &dirs[i]
+		}
+	}
+	return nil
+}
+
+func findFile(l *listing, name string, notExist error) (node, error) {
+	for _, n := range l.files {
+		if n.name == name {
+			return n, nil
+		}
+	}
+	return node{}, notExist
+}
+
+// loadAlbumIndex lists the albums once the index is stale.
+func (fsys *FS) loadAlbumIndex(ctx context.Context) (*albumIndex, error) {
+	fsys.mu.Lock()
+	index := fsys.albumIndex
+	fsys.mu.Unlock()
+	if index != nil && fsys.fresh(index.loadedAt) {
+		return index, nil
+	}
+
+	return coalesce(ctx, &fsys.loads, AlbumsDirName, func() (*albumIndex, error) {
+		return fsys.listAlbumIndex(ctx)
+	})
+}
+
+// listAlbumIndex lists the albums, naming their directories.
+func (fsys *FS) listAlbumIndex(ctx context.Context) (*albumIndex, error) {
+	albumList, err := fsys.listAlbums(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &albumIndex{loadedAt: time.Now(), byName: make(map[string]albums.Album)}
+	dirs := layout.NewAlbumDirs(true) // WebDAV clients run on any filesystem
+	for _, album := range albumList {
+		name := dirs.Name(album.Title, album.ID)
+
+		index.byName[name] = album
+		index.dirs = append(index.dirs, node{name: name, dir: true, modTime: index.loadedAt})
+	}
+
+	fsys.mu.Lock()
+	fsys.albumIndex = index
+	fsys.mu.Unlock()
+
+	return index, nil
+}
+
+// loadAlbum lists the media items of the album once its listing is stale.
+func (fsys *FS) loadAlbum(ctx context.Context, albumID string) (*listing, error) {
+	fsys.mu.Lock()
+	l := fsys.albumDirs[albumID]
+	fsys.mu.Unlock()
+	if l != nil && fsys.fresh(l.loadedAt) {
+		return l, nil
+	}
+
+	return coalesce(ctx, &fsys.loads, path.Join(AlbumsDirName, albumID), func() (*listing, error) {
+		items, err := collect(mediaitems.Search(ctx, fsys.client, mediaitems.SearchMediaItemRequest{
+			AlbumID:  albumID,
+			PageSize: api.MaxPageSize,
+		}))
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		l := newListing(items)
+
+		fsys.mu.Lock()
+		fsys.albumDirs[albumID] = l
+		fsys.mu.Unlock()
+
+		return l, nil
+	})
+}
+
+// loadDateRange searches the oldest and the newest media item once the
+// range is stale.
+func (fsys *FS) loadDateRange(ctx context.Context) (*dateRange, error) {
+	fsys.mu.Lock()
+	r := fsys.dateRange
+	fsys.mu.Unlock()
+	if r != nil && fsys.fresh(r.loadedAt) {
+		return r, nil
+	}
+
+	return coalesce(ctx, &fsys.loads, ByDateDirName, func() (*dateRange, error) {
+		oldest, ok, err := fsys.searchFirst(ctx, mediaitems.OrderByCreationTime)
+		if err != nil {
+			return nil, err
+		}
+		newest, _, err := fsys.searchFirst(ctx, mediaitems.OrderByCreationTimeDesc)
+		if err != nil {
+			return nil, err
+		}
+
+		r := &dateRange{loadedAt: time.Now()}
+		if ok {
+			last := startOfMonth(creationTime(newest))
+			for start := startOfMonth(creationTime(oldest)); !start.After(last); start = start.AddDate(0, 1, 0) {
+				year := start.Format("2006")
+				if len(r.years) == 0 || r.years[len(r.years)-1].name != year {
+					r.years = append(r.years, node{name: year, dir: true, modTime: start})
+				}
+				yearDir := &r.years[len(r.years)-1]
+				yearDir.children = append(yearDir.children, node{name: start.Format("01"), dir: true, modTime: start})
+			}
+		}
+
+		fsys.mu.Lock()
+		fsys.dateRange = r
+		fsys.mu.Unlock()
+
+		return r, nil
+	})
+}
+
+// loadMonth searches the media items created in the month starting at
+// start once its listing is stale.
+func (fsys *FS) loadMonth(ctx context.Context, start time.Time) (*listing, error) {
+	key := path.Join(ByDateDirName, start.Format("2006/01"))
+
+	fsys.mu.Lock()
+	l := fsys.monthDirs[key]
+	fsys.mu.Unlock()
+	if l != nil && fsys.fresh(l.loadedAt) {
+		return l, nil
+	}
+
+	return coalesce(ctx, &fsys.loads, key, func() (*listing, error) {
+		end := start.AddDate(0, 1, 0)
+		items, err := collect(mediaitems.Search(ctx, fsys.client, mediaitems.SearchMediaItemRequest{
+			PageSize: api.MaxPageSize,
+			Filters: &mediaitems.Filters{DateFilter: &mediaitems.DateFilter{Ranges: []mediaitems.DateRange{{
+				StartDate: mediaitems.NewDate(start.Add(-dateSlack)),
+				EndDate:   mediaitems.NewDate(end.Add(dateSlack)),
+			}}}},
+			OrderBy: mediaitems.OrderByCreationTime,
+		}))
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// the slack matches items of the neighbouring months
+		var inMonth []mediaitems.MediaItem
+		for _, item := range items {
+			if created := creationTime(item); !created.Before(start) && created.Before(end) {
+				inMonth = append(inMonth, item)
+			}
+		}
+		l := newListing(inMonth)
+
+		fsys.mu.Lock()
+		fsys.monthDirs[key] = l
+		fsys.mu.Unlock()
+
+		return l, nil
+	})
+}
+
+// searchFirst returns the first media item of the library in order, false
+// when the library is empty.
+func (fsys *FS) searchFirst(ctx context.Context, orderBy string) (mediaitems.MediaItem, bool, error) {
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	itemCh, errCh := mediaitems.Search(searchCtx, fsys.client, mediaitems.SearchMediaItemRequest{
+		PageSize: 1,
+		Filters: &mediaitems.Filters{DateFilter: &mediaitems.DateFilter{Ranges: []mediaitems.DateRange{{
+			StartDate: mediaitems.Date{Year: 1, Month: 1, Day: 1},
+			EndDate:   mediaitems.Date{Year: 9999, Month: 12, Day: 31},
+		}}}},
+		OrderBy: orderBy,
+	})
+	item, ok := <-itemCh
+	cancel()
+	for range itemCh {
+	}
+	if ok {
+		return item, true, nil
+	}
+
+	select {
+	case err := <-errCh:
+		return item, false, err
+	default:
+	}
+	return item, false, ctx.Err()
+}
+
+// newListing names the files of the items, numbering names which repeat.
+func newListing(items []mediaitems.MediaItem) *listing {
+	l := &listing{loadedAt: time.Now()}
+
+	names := make(map[string]bool)
+	for _, item := range items {
+		base := layout.Sanitize(item.Filename)
+		if item.Filename == "" {
+			base = layout.Sanitize(item.ID)
+		}
+		ext := path.Ext(base)
+
+		name := base
+		for n := 1; names[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(base, ext), n, ext)
+		}
+		names[strings.ToLower(name)] = true
+
+		l.files = append(l.files, node{name: name, modTime: creationTime(item), item: item})
+	}
+
+	return l
+}
+
+func creationTime(item mediaitems.MediaItem) time.Time {
+	if item.MediaMetadata == nil {
+		return time.Time{}
+	}
+	return item.MediaMetadata.CreationTime.UTC()
+}
+
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,157 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+// Record is a media item with the albums it is in.
+type Record struct {
+	Item   mediaitems.MediaItem
+	Albums []AlbumRef
+}
+
+// AlbumRef identifies an album a media item is in.
+type AlbumRef struct {
+	ID    string
+	Title string
+}
+
+// Column is a flattened field of a record, named after its JSON path in the
+// API with dots separating the levels.
+type Column struct {
+	Name        string
+	Description string
+
+	value    func(Record) any // string, int64, float64, time.Time or []string
+	expiring bool             // a base url, left out of DefaultColumns
+}
+
+// Columns lists every column in the stable order of exports.
+var Columns = []Column{
+	{Name: "id", Description: "media item id", value: func(r Record) any { return r.Item.ID }},
+	{Name: "filename", Description: "filename", value: func(r Record) any { return r.Item.Filename }},
+	{Name: "description", Description: "description", value: func(r Record) any { return r.Item.Description }},
+	{Name: "mimeType", Description: "mime type", value: func(r Record) any { return r.Item.MimeType }},
+	{Name: "productUrl", Description: "url of the media item in Google Photos", value: func(r Record) any { return r.Item.ProductURL }},
+	{Name: "baseUrl", Description: "base url of the bytes, expires after about an hour", value: func(r Record) any { return r.Item.BaseURL }, expiring: true},
+	{Name: "mediaMetadata.creationTime", Description: "creation time", value: metadata(func(m *mediaitems.MediaMetadata) any { return m.CreationTime })},
+	{Name: "mediaMetadata.width", Description: "width in pixels", value: metadata(func(m *mediaitems.MediaMetadata) any { return m.Width })},
+	{Name: "mediaMetadata.height", Description: "height in pixels", value: metadata(func(m *mediaitems.MediaMetadata) any { return m.Height })},
+	{Name: "mediaMetadata.photo.cameraMake", Description: "camera make of a photo", value: photo(func(p *mediaitems.Photo) any { return p.CameraMake })},
+	{Name: "mediaMetadata.photo.cameraModel", Description: "camera model of a photo", value: photo(func(p *mediaitems.Photo) any { return p.CameraModel })},
+	{Name: "mediaMetadata.photo.focalLength", Description: "focal length in millimeters", value: photo(func(p *mediaitems.Photo) any { return p.FocalLength })},
+	{Name: "mediaMetadata.photo.apertureFNumber", Description: "aperture f number", value: photo(func(p *mediaitems.Photo) any { return p.AperatureFNumber })},
+	{Name: "mediaMetadata.photo.isoEquivalent", Description: "ISO", value: photo(func(p *mediaitems.Photo) any { return p.ISOEquivalent })},
+	{Name: "mediaMetadata.photo.exposureTime", Description: "exposure time", value: photo(func(p *mediaitems.Photo) any { return p.ExposureTime })},
+	{Name: "mediaMetadata.video.cameraMake", Description: "camera make of a video", value: video(func(v *mediaitems.Video) any { return v.CameraMake })},
+	{Name: "mediaMetadata.video.cameraModel", Description: "camera model of a video", value: video(func(v *mediaitems.Video) any { return v.CameraModel })},
+	{Name: "mediaMetadata.video.fps", Description: "frames per second", value: video(func(v *mediaitems.Video) any { return v.FPS })},
+	{Name: "mediaMetadata.video.status", Description: "video processing status", value: video(func(v *mediaitems.Video) any { return string(v.Status) })},
+	{Name: "contributorInfo.displayName", Description: "contributor of a shared album item", value: contributor(func(c *mediaitems.ContributorInfo) any { return c.DisplayName })},
+	{Name: "contributorInfo.profilePictureBaseUrl", Description: "base url of the contributor's profile picture", value: contributor(func(c *mediaitems.ContributorInfo) any { return c.ProfilePictureBaseUrl }), expiring: true},
+	{Name: "albums.id", Description: "ids of the albums the media item is in", value: albumValues(func(a AlbumRef) string { return a.ID })},
+	{Name: "albums.title", Description: "titles of the albums the media item is in", value: albumValues(func(a AlbumRef) string { return a.Title })},
+}
+
+// DefaultColumns are all columns but the expiring base urls.
+var DefaultColumns = func() []string {
+	var names []string
+	for _, c := range Columns {
+		if !c.expiring {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}()
+
+// LookupColumns returns the named columns, in the given order.
+func LookupColumns(names []string) ([]Column, error) {
+	columns := make([]Column, 0, len(names))
+	for _, name := range names {
+		c, ok := lookupColumn(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+func lookupColumn(name string) (Column, bool) {
+	for _, c := range Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Column{}, false
+}
+
+// usesAlbums reports whether the columns need album membership.
+func usesAlbums(columns []Column) bool {
+	for _, c := range columns {
+		if strings.HasPrefix(c.Name, "albums.") {
+			return true
+		}
+	}
+	return false
+}
+
+// the helpers return nil when the nested object is missing, exported as empty
+
+func metadata(fn func(*mediaitems.MediaMetadata) any) func(Record) any {
+	return func(r Record) any {
+		if r.Item.MediaMetadata == nil {
+			return nil
+		}
+		return fn(r.Item.MediaMetadata)
+	}
+}
+
+func photo(fn func(*mediaitems.Photo) any) func(Record) any {
+	return metadata(func(m *mediaitems.MediaMetadata) any {
+		if m.Photo == nil {
+			return nil
+		}
+		return fn(m.Photo)
+	})
+}
+
+func video(fn func(*mediaitems.Video) any) func(Record) any {
+	return metadata(func(m *mediaitems.MediaMetadata) any {
+		if m.Video == nil {
+			return nil
+		}
+		return fn(m.Video)
+	})
+}
+
+func contributor(fn func(*mediaitems.ContributorInfo) any) func(Record) any {
+	return func(r Record) any {
+		if r.Item.ContributorInfo == nil {
+			return nil
+		}
+		return fn(r.Item.ContributorInfo)
+	}
+}
+
+func albumValues(fn func(AlbumRef) string) func(Record) any {
+	return func(r Record) any {
+		values := make([]string, 0, len(r.Albums))
+		for _, a := range r.Albums {
+			values = append(values, fn(a))
+		}
+		return values
+	}
+}
+
+// formatTime formats times for CSV, empty for the zero time.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
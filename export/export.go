@@ -0,0 +1,134 @@
+// Package export streams library metadata into files for analytics.
+//
+// Media items are written as they are listed, one record each, so memory
+// does not grow with the library. Only album membership is held in memory,
+// and only when an album column is exported.
+package export
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+type Config struct {
+	format      Format
+	columns     []Column
+	listRequest mediaitems.ListMediaItemsRequest
+}
+
+type Option func(*Config)
+
+// WithFormat sets the format, JSONL when unset.
+func WithFormat(format Format) Option {
+	return func(c *Config) {
+		c.format = format
+	}
+}
+
+// WithColumns sets the columns and their order, DefaultColumns when unset.
+func WithColumns(columns []Column) Option {
+	return func(c *Config) {
+		c.columns = columns
+	}
+}
+
+// WithListRequest sets the request used to walk the library, e.g. to exclude
+// media items not created by the app.
+func WithListRequest(listRequest mediaitems.ListMediaItemsRequest) Option {
+	return func(c *Config) {
+		c.listRequest = listRequest
+	}
+}
+
+// Export writes a record of every media item to w, returning the number of
+// records written.
+func Export(ctx context.Context, client *http.Client, w io.Writer, opts ...Option) (int, error) {
+	columns, err := LookupColumns(DefaultColumns)
+	if err != nil {
+		return 0, err
+	}
+
+	cfg := &Config{
+		format:      JSONL,
+		columns:     columns,
+		listRequest: mediaitems.ListMediaItemsRequest{PageSize: api.MaxPageSize},
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var membership map[string][]AlbumRef
+	if usesAlbums(cfg.columns) {
+		if membership, err = albumMembership(ctx, client); err != nil {
+			return 0, err
+		}
+	}
+
+	ew := NewWriter(w, cfg.format, cfg.columns)
+
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	n := 0
+	itemCh, errCh := mediaitems.List(listCtx, client, cfg.listRequest)
+	for item := range itemCh {
+		if err := ew.Write(Record{Item: item, Albums: membership[item.ID]}); err != nil {
+			cancel() // stop listing, the list goroutine exits once drained
+			for range itemCh {
+			}
+			return n, err
+		}
+		n++
+	}
+
+	select {
+	case err := <-errCh:
+		return n, err
+	default:
+	}
+
+	if err := ew.Flush(); err != nil {
+		return n, err
+	}
+
+	return n, ctx.Err()
+}
+
+// albumMembership returns the albums of each media item, in album list order.
+func albumMembership(ctx context.Context, client *http.Client) (map[string][]AlbumRef, error) {
+	var albumList []albums.Album
+
+	albumCh, errCh := albums.List(ctx, client, albums.ListAlbumsRequest{PageSize: api.MaxPageSize})
+	for album := range albumCh {
+		albumList = append(albumList, album)
+	}
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+
+	membership := make(map[string][]AlbumRef)
+	for _, album := range albumList {
+		itemCh, errCh := mediaitems.Search(ctx, client, mediaitems.SearchMediaItemRequest{
+			AlbumID:  album.ID,
+			PageSize: api.MaxPageSize,
+		})
+		for item := range itemCh {
+			membership[item.ID] = append(membership[item.ID], AlbumRef{ID: album.ID, Title: album.Title})
+		}
+		select {
+		case err := <-errCh:
+			return nil, err
+		default:
+		}
+	}
+
+	return membership, ctx.Err()
+}
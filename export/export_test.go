@@ -0,0 +1,112 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+var _ http.RoundTripper = mockRoundTripper{}
+
+type mockRoundTripper struct {
+	roundTripperFn func(*http.Request) (*http.Response, error)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (mock mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return mock.roundTripperFn(req)
+}
+
+func newTestClient() *http.Client {
+	items := []mediaitems.MediaItem{
+		{
+			ID:       "a",
+			Filename: "IMG.JPG",
+			MimeType: "image/jpeg",
+			MediaMetadata: &mediaitems.MediaMetadata{
+				CreationTime: time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC),
+				Width:        4000,
+				Height:       3000,
+				Photo:        &mediaitems.Photo{CameraMake: "Canon", FocalLength: 3.5},
+			},
+		},
+		{
+			ID:            "b",
+			Filename:      "clip, \"one\".mp4",
+			MimeType:      "video/mp4",
+			MediaMetadata: &mediaitems.MediaMetadata{Video: &mediaitems.Video{FPS: 29.97}},
+		},
+	}
+
+	return &http.Client{Transport: mockRoundTripper{roundTripperFn: func(req *http.Request) (*http.Response, error) {
+		var resp any
+		switch req.URL.Path {
+		case "/v1/albums":
+			resp = &albums.ListAlbumsResponse{Albums: []albums.Album{{ID: "1", Title: "Trip"}, {ID: "2", Title: "Best"}}}
+		case "/v1/mediaItems:search":
+			resp = &mediaitems.SearchMediaItemResponse{MediaItems: items[:1]}
+		default:
+			resp = &mediaitems.ListMediaItemsResponse{MediaItems: items}
+		}
+
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     map[string][]string{},
+			Body:       io.NopCloser(bytes.NewReader(data)),
+			Request:    req,
+		}, nil
+	}}}
+}
+
+func TestExport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	columns, err := LookupColumns([]string{"id", "filename", "mediaMetadata.creationTime", "mediaMetadata.width", "mediaMetadata.photo.focalLength", "mediaMetadata.video.fps", "albums.title"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	n, err := Export(ctx, newTestClient(), buf, WithColumns(columns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("exported %d records not expected %d", n, 2)
+	}
+	want := `{"id":"a","filename":"IMG.JPG","mediaMetadata.creationTime":"2023-05-01T12:00:00Z","mediaMetadata.width":4000,"mediaMetadata.photo.focalLength":3.5,"mediaMetadata.video.fps":null,"albums.title":["Trip","Best"]}
+{"id":"b","filename":"clip, \"one\".mp4","mediaMetadata.creationTime":null,"mediaMetadata.width":0,"mediaMetadata.photo.focalLength":null,"mediaMetadata.video.fps":29.97,"albums.title":[]}
+`
+	if buf.String() != want {
+		t.Errorf("jsonl export\n%s\nnot expected\n%s", buf, want)
+	}
+
+	buf.Reset()
+	if _, err := Export(ctx, newTestClient(), buf, WithColumns(columns), WithFormat(CSV)); err != nil {
+		t.Fatal(err)
+	}
+	want = `id,filename,mediaMetadata.creationTime,mediaMetadata.width,mediaMetadata.photo.focalLength,mediaMetadata.video.fps,albums.title
+a,IMG.JPG,2023-05-01T12:00:00Z,4000,3.5,,Trip;Best
+b,"clip, ""one"".mp4",,0,,29.97,
+`
+	if buf.String() != want {
+		t.Errorf("csv export\n%s\nnot expected\n%s", buf, want)
+	}
+
+	if _, err := LookupColumns([]string{"id", "nope"}); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("unknown column error %v not expected", err)
+	}
+}
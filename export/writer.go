@@ -0,0 +1,146 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is an export file format.
+type Format string
+
+const (
+	// JSONL writes a JSON object per record with the columns as keys, in column order.
+	JSONL Format = "jsonl"
+	// CSV writes a header row and a row per record.
+	CSV Format = "csv"
+)
+
+// ListSeparator joins the values of multi-valued columns in CSV.
+const ListSeparator = ";"
+
+// ParseFormat parses the name of a format.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case JSONL, CSV:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown export format %q, want %s or %s", name, JSONL, CSV)
+}
+
+// Writer writes records one at a time.
+type Writer struct {
+	format  Format
+	columns []Column
+
+	w      io.Writer
+	csv    *csv.Writer
+	header bool // written
+	buf    bytes.Buffer
+}
+
+// NewWriter returns a writer of the columns of records in the format.
+func NewWriter(w io.Writer, format Format, columns []Column) *Writer {
+	ew := &Writer{format: format, columns: columns, w: w}
+	if format == CSV {
+		ew.csv = csv.NewWriter(w)
+	}
+	return ew
+}
+
+// Write writes the record.
+func (w *Writer) Write(r Record) error {
+	if w.format == CSV {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+
+		row := make([]string, len(w.columns))
+		for i, c := range w.columns {
+			row[i] = csvValue(c.value(r))
+		}
+		return w.csv.Write(row)
+	}
+
+	w.buf.Reset()
+	w.buf.WriteByte('{')
+	for i, c := range w.columns {
+		if i > 0 {
+			w.buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(c.Name)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(jsonValue(c.value(r)))
+		if err != nil {
+			return err
+		}
+
+		w.buf.Write(key)
+		w.buf.WriteByte(':')
+		w.buf.Write(value)
+	}
+	w.buf.WriteString("}\n")
+
+	_, err := w.w.Write(w.buf.Bytes())
+	return err
+}
+
+// Flush writes buffered data, and the CSV header when no record was written.
+func (w *Writer) Flush() error {
+	if w.format != CSV {
+		return nil
+	}
+
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+func (w *Writer) writeHeader() error {
+	if w.header {
+		return nil
+	}
+	w.header = true
+
+	names := make([]string, len(w.columns))
+	for i, c := range w.columns {
+		names[i] = c.Name
+	}
+	return w.csv.Write(names)
+}
+
+func csvValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return formatTime(v)
+	case []string:
+		return strings.Join(v, ListSeparator)
+	}
+	return ""
+}
+
+func jsonValue(v any) any {
+	if t, ok := v.(time.Time); ok {
+		if t.IsZero() {
+			return nil
+		}
+		return formatTime(t)
+	}
+	return v
+}
@@ -0,0 +1,259 @@
+// Package gallery renders albums as a self-contained static HTML site.
+//
+// Images are downloaded resized, once as thumbnails and once for viewing,
+// so the site keeps working after the base urls of the media items expired
+// and never links to Google. Every album gets an index page of thumbnails
+// and a page per media item, which the site index links to. Videos are
+// shown as their poster frame.
+package gallery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	gosync "sync"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/layout"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	DefaultThumbnailSize = 320
+	DefaultImageSize     = 1600
+	DefaultConcurrency   = 4
+	DefaultTitle         = "Albums"
+
+	// IndexFileName is the name of the site index and of every album index.
+	IndexFileName = "index.html"
+)
+
+type Config struct {
+	title         string
+	thumbnailSize int
+	imageSize     int
+	concurrency   int
+}
+
+type Option func(*Config)
+
+// WithTitle sets the title of the site index, DefaultTitle when unset.
+func WithTitle(title string) Option {
+	return func(c *Config) {
+		c.title = title
+	}
+}
+
+// WithThumbnailSize sets the bounding box of thumbnails in pixels.
+func WithThumbnailSize(size int) Option {
+	return func(c *Config) {
+		if size > 0 {
+			c.thumbnailSize = size
+		}
+	}
+}
+
+// WithImageSize sets the bounding box of the images of media item pages in pixels.
+func WithImageSize(size int) Option {
+	return func(c *Config) {
+		if size > 0 {
+			c.imageSize = size
+		}
+	}
+}
+
+// WithConcurrency sets the number of parallel downloads.
+func WithConcurrency(n int) Option {
+	return func(c *Config) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// Report summarizes a generated site.
+type Report struct {
+	Albums int
+	Items  int
+	Bytes  int64
+}
+
+// Generate writes the site of the albums to dir, overwriting the pages and
+// images of earlier runs.
+func Generate(ctx context.Context, client *http.Client, dir string, albumList []albums.Album, opts ...Option) (Report, error) {
+	cfg := &Config{
+		title:         DefaultTitle,
+		thumbnailSize: DefaultThumbnailSize,
+		imageSize:     DefaultImageSize,
+		concurrency:   DefaultConcurrency,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var report Report
+
+	site := sitePage{Title: cfg.title}
+	dirs := layout.NewAlbumDirs(true) // sites are copied to any filesystem
+	for _, album := range albumList {
+		items, err := albumItems(ctx, client, album.ID)
+		if err != nil {
+			return report, err
+		}
+
+		dirName := dirs.Name(album.Title, album.ID)
+
+		page := newAlbumPage(album, dirName, items)
+		n, err := writeAlbum(ctx, client, filepath.Join(dir, dirName), page, cfg)
+		report.Bytes += n
+		if err != nil {
+			return report, err
+		}
+
+		report.Albums++
+		report.Items += len(items)
+		site.Albums = append(site.Albums, page)
+	}
+
+	if err := writePage(filepath.Join(dir, IndexFileName), siteTemplate, site); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// albumItems returns the media items of the album in album order.
+func albumItems(ctx context.Context, client *http.Client, albumID string) ([]mediaitems.MediaItem, error) {
+	var items []mediaitems.MediaItem
+
+	itemCh, errCh := mediaitems.Search(ctx, client, mediaitems.SearchMediaItemRequest{
+		AlbumID:  albumID,
+		PageSize: api.MaxPageSize,
+	})
+	for item := range itemCh {
+		items = append(items, item)
+	}
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+
+	return items, ctx.Err()
+}
+
+// writeAlbum downloads the images of the album and writes its pages,
+// returning the number of bytes downloaded.
+func writeAlbum(ctx context.Context, client *http.Client, dir string, page *albumPage, cfg *Config) (int64, error) {
+	for _, sub := range []string{thumbsDirName, imagesDirName} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return 0, err
+		}
+	}
+
+	type download struct {
+		url  string
+		path string
+	}
+
+	var downloads []download
+	for _, p := range page.Items {
+		downloads = append(downloads,
+			download{url: mediaitems.SizedURL(p.item, cfg.thumbnailSize, cfg.thumbnailSize), path: filepath.Join(dir, filepath.FromSlash(p.Thumbnail))},
+			download{url: mediaitems.SizedURL(p.item, cfg.imageSize, cfg.imageSize), path: filepath.Join(dir, filepath.FromSlash(p.Image))},
+		)
+	}
+
+	var (
+		mu    gosync.Mutex
+		total int64
+		errs  []error
+		wg    gosync.WaitGroup
+	)
+
+	downloadCh := make(chan download)
+	for i := 0; i < cfg.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range downloadCh {
+				n, err := fetch(ctx, client, d.url, d.path)
+				if err != nil {
+					slog.DebugContext(ctx, "failed downloading image", "path", d.path, "error", err)
+				}
+
+				mu.Lock()
+				total += n
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", d.path, err))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, d := range downloads {
+		select {
+		case downloadCh <- d:
+		case <-ctx.Done():
+		}
+	}
+	close(downloadCh)
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return total, err
+	}
+	if err := ctx.Err(); err != nil {
+		return total, err
+	}
+
+	for i := range page.Items {
+		name := filepath.Join(dir, page.Items[i].Page)
+		if err := writePage(name, itemTemplate, itemView{Album: page, Index: i}); err != nil {
+			return total, err
+		}
+	}
+
+	return total, writePage(filepath.Join(dir, IndexFileName), albumTemplate, page)
+}
+
+// fetch downloads the url to the file at name.
+func fetch(ctx context.Context, client *http.Client, rawURL, name string) (int64, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := mediaitems.Fetch(ctx, client, rawURL, f)
+	if err != nil {
+		f.Close()
+		os.Remove(name)
+		return n, err
+	}
+
+	return n, f.Close()
+}
+
+// writePage renders the template into the file at name.
+func writePage(name string, tmpl *template.Template, data any) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if err := tmpl.Execute(f, data); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,133 @@
+package gallery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+var _ http.RoundTripper = mockRoundTripper{}
+
+type mockRoundTripper struct {
+	roundTripperFn func(*http.Request) (*http.Response, error)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (mock mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return mock.roundTripperFn(req)
+}
+
+func TestGenerate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	members := map[string][]mediaitems.MediaItem{
+		"1": {
+			{ID: "a", Filename: "a.jpg", MimeType: "image/jpeg", BaseURL: "https://lh3.example.com/a", Description: "Sunset <3"},
+			{ID: "b", Filename: "b.mp4", MimeType: "video/mp4", BaseURL: "https://lh3.example.com/b"},
+		},
+		"2": {
+			{ID: "c", Filename: "c.jpg", MimeType: "image/jpeg", BaseURL: "https://lh3.example.com/c"},
+		},
+	}
+
+	client := &http.Client{Transport: mockRoundTripper{roundTripperFn: func(req *http.Request) (*http.Response, error) {
+		var body []byte
+		if req.URL.Host == "lh3.example.com" {
+			body = []byte("image " + req.URL.Path)
+		} else {
+			var search mediaitems.SearchMediaItemRequest
+			if err := json.NewDecoder(req.Body).Decode(&search); err != nil {
+				return nil, err
+			}
+
+			var err error
+			if body, err = json.Marshal(&mediaitems.SearchMediaItemResponse{MediaItems: members[search.AlbumID]}); err != nil {
+				return nil, err
+			}
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     map[string][]string{},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+			Request:    req,
+		}, nil
+	}}}
+
+	dir := t.TempDir()
+	report, err := Generate(ctx, client, dir, []albums.Album{{ID: "1", Title: "Trip"}, {ID: "2", Title: "Trip"}, {ID: "3", Title: "#1 at 100%"}},
+		WithTitle("Team"), WithThumbnailSize(100), WithImageSize(800))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Albums != 3 || report.Items != 3 {
+		t.Errorf("report %+v not expected", report)
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	for name, want := range map[string]string{
+		"Trip/thumbs/0001.jpg":   "image /a=w100-h100",
+		"Trip/images/0001.jpg":   "image /a=w800-h800",
+		"Trip/images/0002.jpg":   "image /b=w800-h800",
+		"Trip 2/thumbs/0001.jpg": "image /c=w100-h100",
+	} {
+		if got := read(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	for name, wants := range map[string][]string{
+		"index.html": {
+			"<title>Team</title>",
+			`<a href="Trip/index.html"><img src="Trip/thumbs/0001.jpg"`,
+			`<a href="Trip%202/index.html">`,
+			`<a href="%231%20at%20100%25/index.html">`,
+			"Trip (2)",
+		},
+		"Trip/index.html": {
+			`<a href="0001.html"><img src="thumbs/0001.jpg" alt="a.jpg" title="Sunset &lt;3"`,
+			`<a href="0002.html" class="video">`,
+		},
+		"Trip/0001.html": {
+			`<a href="0002.html" rel="next">`,
+			`<img src="images/0001.jpg" alt="a.jpg">`,
+			"<figcaption>Sunset &lt;3</figcaption>",
+		},
+		"Trip/0002.html": {
+			`<a href="0001.html" rel="prev">`,
+			"Trip 2/2",
+		},
+	} {
+		got := read(name)
+		for _, want := range wants {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s lacks %s:\n%s", name, want, got)
+			}
+		}
+	}
+
+	if strings.Contains(read("Trip/0002.html"), "<figcaption>") || strings.Contains(read("Trip/0002.html"), `rel="next"`) {
+		t.Error("last item without description has a caption or next link")
+	}
+	if strings.Contains(read("index.html"), "lh3.example.com") {
+		t.Error("site links to base urls")
+	}
+}
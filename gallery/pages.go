@@ -0,0 +1,193 @@
+package gallery
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"path"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+// Directories of an album directory holding its images.
+const (
+	thumbsDirName = "thumbs"
+	imagesDirName = "images"
+)
+
+type sitePage struct {
+	Title  string
+	Albums []*albumPage
+}
+
+type albumPage struct {
+	Title string
+	// Dir is the album directory relative to the site index.
+	Dir   string
+	Items []itemPage
+}
+
+// Index returns the URL of the album index relative to the site index.
+func (a *albumPage) Index() string {
+	return url.PathEscape(a.Dir) + "/" + IndexFileName
+}
+
+// Cover returns the URL of the thumbnail of the album's first media item
+// relative to the site index, empty for empty albums.
+func (a *albumPage) Cover() string {
+	if len(a.Items) == 0 {
+		return ""
+	}
+	// sanitized titles may hold # and %, which would end or break the URL
+	return url.PathEscape(a.Dir) + "/" + a.Items[0].Thumbnail
+}
+
+// itemPage is a media item of an album, its paths relative to the album directory.
+type itemPage struct {
+	Page      string
+	Thumbnail string
+	Image     string
+	Caption   string
+	Alt       string
+	Video     bool
+
+	item mediaitems.MediaItem
+}
+
+// newAlbumPage names the pages and images of the items by position, so
+// the names stay short and a regenerated site overwrites the previous one.
+func newAlbumPage(album albums.Album, dir string, items []mediaitems.MediaItem) *albumPage {
+	page := &albumPage{Title: album.Title, Dir: dir}
+	if page.Title == "" {
+		page.Title = "Untitled"
+	}
+
+	for i, item := range items {
+		name := fmt.Sprintf("%04d", i+1)
+		page.Items = append(page.Items, itemPage{
+			Page:      name + ".html",
+			Thumbnail: path.Join(thumbsDirName, name+".jpg"),
+			Image:     path.Join(imagesDirName, name+".jpg"),
+			Caption:   item.Description,
+			Alt:       item.Filename,
+			Video:     item.IsVideo(),
+			item:      item,
+		})
+	}
+
+	return page
+}
+
+// itemView is the page of the media item at Index of Album.
+type itemView struct {
+	Album *albumPage
+	Index int
+}
+
+func (v itemView) Item() itemPage {
+	return v.Album.Items[v.Index]
+}
+
+// Prev returns the page of the previous item, empty on the first.
+func (v itemView) Prev() string {
+	if v.Index == 0 {
+		return ""
+	}
+	return v.Album.Items[v.Index-1].Page
+}
+
+// Next returns the page of the next item, empty on the last.
+func (v itemView) Next() string {
+	if v.Index == len(v.Album.Items)-1 {
+		return ""
+	}
+	return v.Album.Items[v.Index+1].Page
+}
+
+// Position returns the 1 based position of the item.
+func (v itemView) Position() int {
+	return v.Index + 1
+}
+
+const style = `<style>
+body { margin: 0; font-family: system-ui, sans-serif; background: #111; color: #eee; }
+a { color: #9cf; text-decoration: none; }
+header { padding: 1rem 1.5rem; }
+h1 { margin: 0; font-size: 1.5rem; font-weight: normal; }
+.grid { display: flex; flex-wrap: wrap; gap: .5rem; padding: 0 1.5rem 1.5rem; }
+.grid a { display: block; position: relative; }
+.grid img { display: block; height: 200px; max-width: 100%; object-fit: cover; }
+.grid .label { display: block; padding: .25rem 0; }
+.video::after { content: "\25B6"; position: absolute; left: .5rem; bottom: .5rem; color: #fff; text-shadow: 0 0 4px #000; }
+.lightbox { display: flex; flex-direction: column; align-items: center; min-height: 100vh; }
+.lightbox nav { display: flex; justify-content: space-between; width: 100%; box-sizing: border-box; padding: 1rem 1.5rem; }
+.lightbox img { max-width: 100vw; max-height: 80vh; }
+.lightbox figcaption { padding: 1rem 1.5rem; max-width: 60rem; white-space: pre-line; }
+</style>`
+
+var siteTemplate = template.Must(template.New("site").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+` + style + `
+</head>
+<body>
+<header><h1>{{.Title}}</h1></header>
+<div class="grid">
+{{- range .Albums}}
+<a href="{{.Index}}">{{with .Cover}}<img src="{{.}}" alt="" loading="lazy">{{end}}<span class="label">{{.Title}} ({{len .Items}})</span></a>
+{{- end}}
+</div>
+</body>
+</html>
+`))
+
+var albumTemplate = template.Must(template.New("album").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+` + style + `
+</head>
+<body>
+<header><a href="../index.html">&larr; Albums</a><h1>{{.Title}}</h1></header>
+<div class="grid">
+{{- range .Items}}
+<a href="{{.Page}}"{{if .Video}} class="video"{{end}}><img src="{{.Thumbnail}}" alt="{{.Alt}}" title="{{.Caption}}" loading="lazy"></a>
+{{- end}}
+</div>
+</body>
+</html>
+`))
+
+var itemTemplate = template.Must(template.New("item").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Album.Title}} {{.Position}}/{{len .Album.Items}}</title>
+` + style + `
+</head>
+<body>
+<div class="lightbox">
+<nav>
+<span>{{with .Prev}}<a href="{{.}}" rel="prev">&larr; Previous</a>{{end}}</span>
+<a href="index.html">{{.Album.Title}} {{.Position}}/{{len .Album.Items}}</a>
+<span>{{with .Next}}<a href="{{.}}" rel="next">Next &rarr;</a>{{end}}</span>
+</nav>
+<figure>
+{{- with .Item}}
+{{with $.Next}}<a href="{{.}}">{{end}}<img src="{{.Image}}" alt="{{.Alt}}">{{with $.Next}}</a>{{end}}
+{{- with .Caption}}
+<figcaption>{{.}}</figcaption>
+{{- end}}
+{{- end}}
+</figure>
+</div>
+</body>
+</html>
+`))
@@ -0,0 +1,89 @@
+// Package hooks defines the extension points of the sync and upload
+// pipelines, for steps such as stripping locations, transcoding, scanning
+// or notifying.
+//
+// A hook implements one or more of the interfaces and is registered with
+// the options of each pipeline, e.g. upload.WithBeforeUpload. Hooks of a
+// kind run in registration order. Pipelines call them from their workers,
+// so hooks must be safe for concurrent use.
+package hooks
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+// ErrSkip vetoes a file when returned, or wrapped, by BeforeUpload or
+// AfterDownload. The file is skipped rather than failed, and the error
+// message is reported.
+var ErrSkip = errors.New("skipped by hook")
+
+// Upload is a local file about to be uploaded. BeforeUpload hooks may change
+// it, e.g. point Path to a transcoded copy and set the matching MimeType
+// and Filename. Copies are not removed by the pipeline.
+type Upload struct {
+	// Path is the file whose bytes are uploaded.
+	Path string
+	// MimeType is the type of the bytes at Path.
+	MimeType string
+	// Filename is the name of the new media item.
+	Filename string
+	// Description is the description of the new media item.
+	Description string
+}
+
+// BeforeUploadHook runs before the bytes of a file are uploaded. Returning
+// ErrSkip vetoes the upload, other errors fail the file.
+type BeforeUploadHook interface {
+	BeforeUpload(ctx context.Context, upload *Upload) error
+}
+
+// AfterUploadHook runs once the media item of the file at path was created.
+// An error is reported with the file, the media item is kept.
+type AfterUploadHook interface {
+	AfterUpload(ctx context.Context, item mediaitems.MediaItem, path string) error
+}
+
+// AfterDownloadHook runs once the bytes of item were downloaded to path,
+// before the file is moved into place. It may rewrite the file. Returning
+// ErrSkip vetoes the file, which is removed, other errors fail the item.
+type AfterDownloadHook interface {
+	AfterDownload(ctx context.Context, item mediaitems.MediaItem, path string) error
+}
+
+// ErrorHook is told about every failed file. item is zero when the file
+// failed before its media item was known, path is empty when no local file
+// was involved.
+type ErrorHook interface {
+	OnError(ctx context.Context, item mediaitems.MediaItem, path string, err error)
+}
+
+// BeforeUploadFunc adapts a function to a BeforeUploadHook.
+type BeforeUploadFunc func(ctx context.Context, upload *Upload) error
+
+func (fn BeforeUploadFunc) BeforeUpload(ctx context.Context, upload *Upload) error {
+	return fn(ctx, upload)
+}
+
+// AfterUploadFunc adapts a function to an AfterUploadHook.
+type AfterUploadFunc func(ctx context.Context, item mediaitems.MediaItem, path string) error
+
+func (fn AfterUploadFunc) AfterUpload(ctx context.Context, item mediaitems.MediaItem, path string) error {
+	return fn(ctx, item, path)
+}
+
+// AfterDownloadFunc adapts a function to an AfterDownloadHook.
+type AfterDownloadFunc func(ctx context.Context, item mediaitems.MediaItem, path string) error
+
+func (fn AfterDownloadFunc) AfterDownload(ctx context.Context, item mediaitems.MediaItem, path string) error {
+	return fn(ctx, item, path)
+}
+
+// ErrorFunc adapts a function to an ErrorHook.
+type ErrorFunc func(ctx context.Context, item mediaitems.MediaItem, path string, err error)
+
+func (fn ErrorFunc) OnError(ctx context.Context, item mediaitems.MediaItem, path string, err error) {
+	fn(ctx, item, path, err)
+}
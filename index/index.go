@@ -0,0 +1,511 @@
+// Package index keeps the metadata of a library in a local file and
+// answers queries offline with the predicates of package match.
+//
+// The index is stored in the snapshot format, so an index file can be
+// diffed against snapshots. A refresh is incremental: albums are walked
+// again only when their media item count changed, and media items are
+// searched from the newest indexed creation time minus a lookback. It
+// misses deleted media items, media items created before the lookback and
+// added outside of albums, and album changes which keep the count, a full
+// refresh with Rebuild catches up on them.
+package index
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/match"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+	"github.com/dlph/go-photoslibrary/snapshot"
+
+	"golang.org/x/exp/slog"
+)
+
+// DefaultLookback is how far before the newest indexed media item a
+// refresh searches, to find media items which took a while to appear.
+const DefaultLookback = 7 * 24 * time.Hour
+
+type Config struct {
+	lookback time.Duration
+}
+
+type Option func(*Config)
+
+// WithLookback sets how far before the newest indexed media item a refresh
+// searches, DefaultLookback when unset.
+func WithLookback(d time.Duration) Option {
+	return func(c *Config) {
+		c.lookback = d
+	}
+}
+
+// Report counts the changes of a refresh.
+type Report struct {
+	Added        int  `json:"added"`
+	Updated      int  `json:"updated"`
+	Removed      int  `json:"removed"`
+	AlbumsWalked int  `json:"albumsWalked"`
+	Full         bool `json:"full"`
+}
+
+// Index is the metadata of a library stored in a file. It is safe for
+// concurrent use, queries see the state of the last completed refresh.
+//
+// Media items are kept sorted by creation time, with their positions by
+// album and by MIME type, so a Scope narrows a query by binary search and
+// map lookups. Other predicates are matched against every media item of
+// the scope, which is fast enough for libraries of a few hundred thousand
+// media items and keeps the index a plain snapshot without secondary
+// files to keep in sync.
+type Index struct {
+	name string
+	cfg  *Config
+
+	refreshMu gosync.Mutex // serializes refreshes
+
+	mu      gosync.RWMutex
+	snap    *snapshot.Snapshot // media items sorted by creation time
+	items   map[string]mediaitems.MediaItem
+	members map[string]map[string]bool // media item ids by album id
+	byAlbum map[string][]int           // album id to sorted positions of its members
+	byMime  map[string][]int           // lowercase MIME type to sorted positions
+}
+
+// Scope narrows a query to media items which the index finds without
+// matching every media item. The zero Scope is the whole index.
+type Scope struct {
+	// Start and End bound the creation time like match.Created, a zero
+	// Start or End leaves the range open.
+	Start, End time.Time
+	// AlbumID selects the members of the album, when set.
+	AlbumID string
+	// MimeTypes selects the media items of any of the types, which may end
+	// in a wildcard subtype like match.MimeType, when set.
+	MimeTypes []string
+}
+
+// Open returns the index stored in the named file, which is empty when
+// the file does not exist yet.
+func Open(name string, opts ...Option) (*Index, error) {
+	cfg := &Config{
+		lookback: DefaultLookback,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	s, err := snapshot.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		s, err = &snapshot.Snapshot{Version: snapshot.Version}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sortByCreation(s.MediaItems) // e.g. a snapshot taken by other means
+
+	x := &Index{name: name, cfg: cfg}
+	x.set(s)
+	return x, nil
+}
+
+// UpdatedAt returns when the index was last refreshed, zero if never.
+func (x *Index) UpdatedAt() time.Time {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return x.snap.TakenAt
+}
+
+// Len returns the number of media items indexed.
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return len(x.items)
+}
+
+// Albums returns the indexed albums.
+func (x *Index) Albums() []snapshot.Album {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return append([]snapshot.Album(nil), x.snap.Albums...)
+}
+
+// HasAlbum reports whether the album is indexed.
+func (x *Index) HasAlbum(albumID string) bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	_, ok := x.members[albumID]
+	return ok
+}
+
+// Query returns the indexed media items which match p, oldest first.
+func (x *Index) Query(p match.Predicate) []mediaitems.MediaItem {
+	return x.Select(Scope{}, p)
+}
+
+// Select returns the indexed media items of the scope which match p,
+// oldest first.
+func (x *Index) Select(scope Scope, p match.Predicate) []mediaitems.MediaItem {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	lo, hi := x.span(scope.Start, scope.End)
+
+	var positions []int
+	switch {
+	case scope.AlbumID != "":
+		positions = within(x.byAlbum[scope.AlbumID], lo, hi)
+		if len(scope.MimeTypes) > 0 {
+			positions = intersect(positions, x.mimePositions(scope.MimeTypes))
+		}
+	case len(scope.MimeTypes) > 0:
+		positions = within(x.mimePositions(scope.MimeTypes), lo, hi)
+	default:
+		positions = make([]int, 0, hi-lo)
+		for i := lo; i < hi; i++ {
+			positions = append(positions, i)
+		}
+	}
+
+	var matches []mediaitems.MediaItem
+	for _, i := range positions {
+		if item := x.snap.MediaItems[i]; p.Match(item) {
+			matches = append(matches, item)
+		}
+	}
+	return matches
+}
+
+// span returns the positions of the media items created at or after start
+// and before end. Media items without creation time sort first, they are
+// only in an open range.
+func (x *Index) span(start, end time.Time) (lo, hi int) {
+	sorted := x.snap.MediaItems
+	hi = len(sorted)
+	if start.IsZero() && end.IsZero() {
+		return 0, hi
+	}
+	lo = sort.Search(len(sorted), func(i int) bool {
+		t := creationTime(sorted[i])
+		return !t.IsZero() && !t.Before(start)
+	})
+	if !end.IsZero() {
+		hi = sort.Search(len(sorted), func(i int) bool {
+			return !creationTime(sorted[i]).Before(end)
+		})
+	}
+	return lo, max(lo, hi)
+}
+
+// mimePositions returns the sorted positions of the media items of any of
+// the types.
+func (x *Index) mimePositions(types []string) []int {
+	p := match.MimeType(types...)
+	var positions []int
+	for mimeType, ps := range x.byMime {
+		if p.Match(mediaitems.MediaItem{MimeType: mimeType}) {
+			positions = append(positions, ps...)
+		}
+	}
+	sort.Ints(positions)
+	return positions
+}
+
+// within returns the sorted positions between lo and hi.
+func within(positions []int, lo, hi int) []int {
+	from := sort.SearchInts(positions, lo)
+	to := sort.SearchInts(positions, hi)
+	return positions[from:max(from, to)]
+}
+
+// intersect returns the positions in both sorted a and b.
+func intersect(a, b []int) []int {
+	var both []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			both = append(both, a[i])
+			i++
+			j++
+		}
+	}
+	return both
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// InAlbum matches the media items of the album as of the last refresh.
+// Unlike an album search it combines with any other predicate.
+func (x *Index) InAlbum(albumID string) match.Predicate {
+	x.mu.RLock()
+	members := x.members[albumID]
+	x.mu.RUnlock()
+
+	return match.Func(func(item mediaitems.MediaItem) bool {
+		return members[item.ID]
+	})
+}
+
+// Refresh updates the index incrementally and saves it. An empty index is
+// rebuilt.
+func (x *Index) Refresh(ctx context.Context, client *http.Client) (Report, error) {
+	x.refreshMu.Lock()
+	defer x.refreshMu.Unlock()
+
+	// only refreshes replace the state, reading it needs no lock here
+	if len(x.snap.Albums) == 0 && len(x.items) == 0 {
+		return x.rebuild(ctx, client)
+	}
+
+	var report Report
+
+	albumCh, errCh := albums.List(ctx, client, albums.ListAlbumsRequest{PageSize: api.MaxPageSize})
+	fetched, err := collect(ctx, albumCh, errCh)
+	if err != nil {
+		return Report{}, err
+	}
+	known := make(map[string]snapshot.Album, len(x.snap.Albums))
+	for _, album := range x.snap.Albums {
+		known[album.ID] = album
+	}
+
+	s := &snapshot.Snapshot{Version: snapshot.Version, TakenAt: time.Now().UTC()}
+	for _, album := range fetched {
+		album.CoverPhotoBaseURL = ""
+		indexed := snapshot.Album{Album: album}
+		if old, ok := known[album.ID]; ok && old.MediaItemsCount == album.MediaItemsCount {
+			indexed.MediaItemIDs = old.MediaItemIDs
+		} else {
+			if indexed.MediaItemIDs, err = albumItemIDs(ctx, client, album.ID); err != nil {
+				return Report{}, err
+			}
+			report.AlbumsWalked++
+		}
+		s.Albums = append(s.Albums, indexed)
+	}
+
+	items := make(map[string]mediaitems.MediaItem, len(x.items))
+	for id, item := range x.items {
+		items[id] = item
+	}
+
+	var newest time.Time
+	for _, item := range items {
+		if item.MediaMetadata != nil && item.MediaMetadata.CreationTime.After(newest) {
+			newest = item.MediaMetadata.CreationTime
+		}
+	}
+	var since time.Time
+	if !newest.IsZero() {
+		since = newest.Add(-x.cfg.lookback)
+	}
+	itemCh, errCh := match.Search(ctx, client, mediaitems.SearchMediaItemRequest{PageSize: api.MaxPageSize}, match.Created(since, time.Time{}))
+	recent, err := collect(ctx, itemCh, errCh)
+	if err != nil {
+		return Report{}, err
+	}
+	for _, item := range recent {
+		item.BaseURL = ""
+		items[item.ID] = item
+	}
+
+	if err := fetchMissing(ctx, client, s.Albums, items); err != nil {
+		return Report{}, err
+	}
+
+	x.count(&report, items)
+	return report, x.save(s, items)
+}
+
+// Rebuild lists the whole library again, replacing the index, and saves it.
+func (x *Index) Rebuild(ctx context.Context, client *http.Client) (Report, error) {
+	x.refreshMu.Lock()
+	defer x.refreshMu.Unlock()
+
+	return x.rebuild(ctx, client)
+}
+
+func (x *Index) rebuild(ctx context.Context, client *http.Client) (Report, error) {
+	report := Report{Full: true}
+
+	s, err := snapshot.Take(ctx, client)
+	if err != nil {
+		return Report{}, err
+	}
+	report.AlbumsWalked = len(s.Albums)
+
+	items := make(map[string]mediaitems.MediaItem, len(s.MediaItems))
+	for _, item := range s.MediaItems {
+		items[item.ID] = item
+	}
+	if err := fetchMissing(ctx, client, s.Albums, items); err != nil {
+		return Report{}, err
+	}
+
+	x.count(&report, items)
+	return report, x.save(s, items)
+}
+
+// count counts the media items added, updated and removed by replacing
+// the indexed media items with items.
+func (x *Index) count(report *Report, items map[string]mediaitems.MediaItem) {
+	for id, item := range items {
+		old, ok := x.items[id]
+		switch {
+		case !ok:
+			report.Added++
+		case !reflect.DeepEqual(old, item):
+			report.Updated++
+		}
+	}
+	for id := range x.items {
+		if _, ok := items[id]; !ok {
+			report.Removed++
+		}
+	}
+}
+
+// fetchMissing adds the album members which are not in items, such as the
+// media items of others in shared albums. Members gone meanwhile are
+// skipped.
+func fetchMissing(ctx context.Context, client *http.Client, indexed []snapshot.Album, items map[string]mediaitems.MediaItem) error {
+	for _, album := range indexed {
+		for _, id := range album.MediaItemIDs {
+			if _, ok := items[id]; ok {
+				continue
+			}
+			item, err := mediaitems.Get(ctx, client, mediaitems.GetMediaItemRequest{MediaItemID: id})
+			if api.IsNotFound(err) {
+				slog.DebugContext(ctx, "skipping missing album member", "album", album.ID, "id", id)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			item.BaseURL = ""
+			items[item.ID] = item
+		}
+	}
+	return nil
+}
+
+// save writes the index file and replaces the state with s holding items
+// oldest first.
+func (x *Index) save(s *snapshot.Snapshot, items map[string]mediaitems.MediaItem) error {
+	s.MediaItems = make([]mediaitems.MediaItem, 0, len(items))
+	for _, item := range items {
+		s.MediaItems = append(s.MediaItems, item)
+	}
+	sortByCreation(s.MediaItems)
+
+	if err := snapshot.WriteFile(x.name, s); err != nil {
+		return err
+	}
+	x.set(s)
+	return nil
+}
+
+// set replaces the state with s, whose media items are sorted by creation
+// time, and builds the lookup structures.
+func (x *Index) set(s *snapshot.Snapshot) {
+	items := make(map[string]mediaitems.MediaItem, len(s.MediaItems))
+	positions := make(map[string]int, len(s.MediaItems))
+	byMime := make(map[string][]int)
+	for i, item := range s.MediaItems {
+		items[item.ID] = item
+		positions[item.ID] = i
+		mimeType := strings.ToLower(item.MimeType)
+		byMime[mimeType] = append(byMime[mimeType], i)
+	}
+	members := make(map[string]map[string]bool, len(s.Albums))
+	byAlbum := make(map[string][]int, len(s.Albums))
+	for _, album := range s.Albums {
+		ids := make(map[string]bool, len(album.MediaItemIDs))
+		var ps []int
+		for _, id := range album.MediaItemIDs {
+			if i, ok := positions[id]; ok && !ids[id] {
+				ps = append(ps, i)
+			}
+			ids[id] = true
+		}
+		sort.Ints(ps)
+		members[album.ID] = ids
+		byAlbum[album.ID] = ps
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.snap, x.items, x.members = s, items, members
+	x.byAlbum, x.byMime = byAlbum, byMime
+}
+
+// sortByCreation sorts the media items oldest first, and by id when they
+// were created at the same time.
+func sortByCreation(items []mediaitems.MediaItem) {
+	sort.Slice(items, func(i, j int) bool {
+		ti, tj := creationTime(items[i]), creationTime(items[j])
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return items[i].ID < items[j].ID
+	})
+}
+
+func albumItemIDs(ctx context.Context, client *http.Client, albumID string) ([]string, error) {
+	itemCh, errCh := mediaitems.Search(ctx, client, mediaitems.SearchMediaItemRequest{AlbumID: albumID, PageSize: api.MaxPageSize})
+	items, err := collect(ctx, itemCh, errCh)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids, nil
+}
+
+// collect receives everything of a stream, failing on its error or once
+// ctx is done.
+func collect[T any](ctx context.Context, ch <-chan T, errCh <-chan error) ([]T, error) {
+	var all []T
+	for v := range ch {
+		all = append(all, v)
+	}
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+	return all, ctx.Err()
+}
+
+func creationTime(item mediaitems.MediaItem) time.Time {
+	if item.MediaMetadata == nil {
+		return time.Time{}
+	}
+	return item.MediaMetadata.CreationTime
+}
@@ -0,0 +1,180 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/match"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+	"github.com/dlph/go-photoslibrary/snapshot"
+)
+
+var _ http.RoundTripper = mockRoundTripper{}
+
+type mockRoundTripper struct {
+	roundTripperFn func(*http.Request) (*http.Response, error)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (mock mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return mock.roundTripperFn(req)
+}
+
+func item(id string, created time.Time, model string) mediaitems.MediaItem {
+	return mediaitems.MediaItem{ID: id, Filename: id + ".jpg", MimeType: "image/jpeg", BaseURL: "https://lh3.example.com/" + id,
+		MediaMetadata: &mediaitems.MediaMetadata{CreationTime: created, Photo: &mediaitems.Photo{CameraModel: model}}}
+}
+
+func ids(items []mediaitems.MediaItem) string {
+	var s string
+	for _, item := range items {
+		s += item.ID
+	}
+	return s
+}
+
+func TestRefresh(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2023, time.June, d, 12, 0, 0, 0, time.UTC) }
+
+	library := []mediaitems.MediaItem{item("b", day(2), "Pixel 7"), item("a", day(1), "iPhone 12")}
+	shared := item("x", day(3), "iPhone 12") // of another member of a shared album
+	albumList := []albums.Album{{ID: "1", Title: "Trip", MediaItemsCount: "3"}}
+	members := map[string][]string{"1": {"a", "x", "gone"}}
+
+	var searches []mediaitems.SearchMediaItemRequest
+	client := &http.Client{Transport: mockRoundTripper{roundTripperFn: func(req *http.Request) (*http.Response, error) {
+		status := http.StatusOK
+		var resp any
+		switch path := req.URL.Path; {
+		case path == "/v1/albums":
+			resp = albums.ListAlbumsResponse{Albums: albumList}
+		case path == "/v1/mediaItems":
+			resp = mediaitems.ListMediaItemsResponse{MediaItems: library}
+		case path == "/v1/mediaItems:search":
+			var search mediaitems.SearchMediaItemRequest
+			if err := json.NewDecoder(req.Body).Decode(&search); err != nil {
+				t.Fatal(err)
+			}
+			searches = append(searches, search)
+			var found []mediaitems.MediaItem
+			if search.AlbumID != "" {
+				for _, id := range members[search.AlbumID] {
+					found = append(found, mediaitems.MediaItem{ID: id})
+				}
+			} else {
+				found = library
+			}
+			resp = mediaitems.SearchMediaItemResponse{MediaItems: found}
+		case path == "/v1/mediaItems/x":
+			resp = shared
+		default:
+			status, resp = http.StatusNotFound, map[string]any{"error": map[string]any{"code": 404, "status": "NOT_FOUND"}}
+		}
+		body, _ := json.Marshal(resp)
+		return &http.Response{
+			StatusCode: status,
+			Body:       io.NopCloser(bytes.NewReader(body)),
+			Request:    req,
+		}, nil
+	}}}
+
+	ctx := context.Background()
+	name := filepath.Join(t.TempDir(), "index"+snapshot.FileExt)
+
+	x, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := x.Refresh(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report != (Report{Added: 3, AlbumsWalked: 1, Full: true}) {
+		t.Errorf("first refresh %+v", report)
+	}
+
+	x, err = Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Len() != 3 || x.UpdatedAt().IsZero() {
+		t.Fatalf("reopened index of %d media items updated at %v", x.Len(), x.UpdatedAt())
+	}
+	for _, tt := range []struct {
+		name string
+		p    match.Predicate
+		want string
+	}{
+		{"all", match.All, "abx"},
+		{"album", x.InAlbum("1"), "ax"},
+		{"album and camera", match.And(x.InAlbum("1"), match.CameraModel("iphone 12")), "ax"},
+		{"created", match.Created(day(2), day(3)), "b"},
+		{"mime type", match.MimeType("video/*"), ""},
+		{"unknown album", x.InAlbum("2"), ""},
+	} {
+		if got := ids(x.Query(tt.p)); got != tt.want {
+			t.Errorf("%s queried %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		name  string
+		scope Scope
+		want  string
+	}{
+		{"all", Scope{}, "abx"},
+		{"created", Scope{Start: day(2), End: day(3)}, "b"},
+		{"created from", Scope{Start: day(2)}, "bx"},
+		{"created before", Scope{End: day(2)}, "a"},
+		{"album", Scope{AlbumID: "1"}, "ax"},
+		{"album and created", Scope{AlbumID: "1", Start: day(2)}, "x"},
+		{"mime type", Scope{MimeTypes: []string{"image/*"}}, "abx"},
+		{"album and mime type", Scope{AlbumID: "1", MimeTypes: []string{"video/mp4"}}, ""},
+		{"empty range", Scope{Start: day(3), End: day(2)}, ""},
+	} {
+		if got := ids(x.Select(tt.scope, match.All)); got != tt.want {
+			t.Errorf("%s selected %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got := ids(x.Select(Scope{AlbumID: "1"}, match.CameraModel("iphone 12"))); got != "ax" {
+		t.Errorf("album scope with camera selected %q", got)
+	}
+	if got := x.Query(match.All); got[0].BaseURL != "" {
+		t.Error("index kept base urls")
+	}
+
+	library = append(library, item("c", day(4), "Pixel 7"))
+	albumList = append(albumList, albums.Album{ID: "2", Title: "Pixel", MediaItemsCount: "2"})
+	members["2"] = []string{"b", "c"}
+	searches = nil
+	if report, err = x.Refresh(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	if report != (Report{Added: 1, AlbumsWalked: 1}) {
+		t.Errorf("incremental refresh %+v", report)
+	}
+	if len(searches) != 2 || searches[1].Filters == nil || searches[1].Filters.DateFilter == nil {
+		t.Errorf("incremental refresh searched %+v", searches)
+	}
+	if got := ids(x.Query(x.InAlbum("2"))); got != "bc" {
+		t.Errorf("new album queried %q", got)
+	}
+
+	library = library[1:]
+	members["2"] = []string{"c"}
+	if report, err = x.Rebuild(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	if report != (Report{Removed: 1, AlbumsWalked: 2, Full: true}) {
+		t.Errorf("rebuild %+v", report)
+	}
+	if got := ids(x.Query(match.All)); got != "axc" {
+		t.Errorf("rebuilt index holds %q", got)
+	}
+}
@@ -0,0 +1,113 @@
+// Package journal keeps append-only files of JSON records, one per line,
+// which survive interrupted processes: every record is synced to disk when
+// it is appended, and a final line without newline, the torn write of an
+// interrupted append, is skipped when the journal is opened and cut off by
+// the next append.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// Journal is an append-only file of records of type T. It is not safe for
+// concurrent use, its owners guard it with the lock of their state.
+type Journal[T any] struct {
+	path string
+	f    *os.File
+	size int64 // length of the complete lines
+}
+
+// Open reads the records of the journal at path in order, calling fn with
+// every one. Lines which are no record are skipped. The file is created on
+// the first Append, an empty path keeps the journal in memory only.
+func Open[T any](path string, fn func(T)) (*Journal[T], error) {
+	j := &Journal[T]{path: path}
+	if path == "" {
+		return j, nil
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break // a final line without newline is a torn write, dropped on the next Append
+		}
+		if err != nil {
+			return nil, err
+		}
+		j.size += int64(len(line))
+
+		var v T
+		if err := json.Unmarshal(line, &v); err != nil {
+			continue
+		}
+		fn(v)
+	}
+
+	return j, nil
+}
+
+// Append writes the record and syncs the journal to disk.
+func (j *Journal[T]) Append(v T) error {
+	data, err := json.Marshal(&v)
+	if err != nil {
+		return err
+	}
+	if j.path == "" {
+		return nil
+	}
+
+	if j.f == nil {
+		f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		if err := f.Truncate(j.size); err != nil {
+			f.Close()
+			return err
+		}
+		j.f = f
+	}
+
+	if _, err := j.f.Write(append(data, '\n')); err != nil {
+		j.discard()
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		j.discard()
+		return err
+	}
+	j.size += int64(len(data)) + 1
+	return nil
+}
+
+// discard closes the file after a failed append, the next Append opens it
+// again and cuts off what the failed one may have written.
+func (j *Journal[T]) discard() {
+	j.f.Close()
+	j.f = nil
+}
+
+// Close closes the journal file, a later Append opens it again.
+func (j *Journal[T]) Close() error {
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
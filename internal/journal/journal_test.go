@@ -0,0 +1,113 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type record struct {
+	ID    string `json:"id"`
+	Value int    `json:"value"`
+}
+
+func TestJournal(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	// an interrupted append left a torn line
+	data := `{"id":"a","value":1}` + "\n" + "not json\n" + `{"id":"b","val`
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var read []record
+	j, err := Open(name, func(r record) {
+		read = append(read, r)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []record{{"a", 1}}; !reflect.DeepEqual(read, want) {
+		t.Errorf("read %v, want %v", read, want)
+	}
+
+	if err := j.Append(record{"b", 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Append(record{"c", 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	read = nil
+	if _, err := Open(name, func(r record) {
+		read = append(read, r)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []record{{"a", 1}, {"b", 2}, {"c", 3}}; !reflect.DeepEqual(read, want) {
+		t.Errorf("reopened %v, want %v", read, want)
+	}
+
+	memory, err := Open("", func(record) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := memory.Append(record{"a", 1}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJournalAppendFailed(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	j, err := Open(name, func(record) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Append(record{"a", 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed append left part of its record behind
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"id":"b","va`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	ro, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.f.Close()
+	j.f = ro
+	if err := j.Append(record{"b", 2}); err == nil {
+		t.Fatal("append to read-only file succeeded")
+	}
+
+	if err := j.Append(record{"c", 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var read []record
+	if _, err := Open(name, func(r record) {
+		read = append(read, r)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []record{{"a", 1}, {"c", 3}}; !reflect.DeepEqual(read, want) {
+		t.Errorf("reopened %v, want %v", read, want)
+	}
+}
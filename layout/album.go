@@ -0,0 +1,34 @@
+package layout
+
+import "strings"
+
+// AlbumDirs names a directory per album. Untitled albums and albums sharing
+// a title are told apart by id.
+type AlbumDirs struct {
+	caseInsensitive bool
+	names           map[string]bool // folded names handed out
+}
+
+// NewAlbumDirs returns an empty set of album directories, whose names are
+// compared case-insensitively when caseInsensitive is set.
+func NewAlbumDirs(caseInsensitive bool) *AlbumDirs {
+	return &AlbumDirs{caseInsensitive: caseInsensitive, names: make(map[string]bool)}
+}
+
+// Name returns the directory of the album, a single sanitized path segment
+// unique among the names returned before.
+func (d *AlbumDirs) Name(title, id string) string {
+	name := Sanitize(title)
+	if title == "" || d.names[d.key(name)] {
+		name = Sanitize(strings.TrimSpace(title + " " + id))
+	}
+	d.names[d.key(name)] = true
+	return name
+}
+
+func (d *AlbumDirs) key(name string) string {
+	if d.caseInsensitive {
+		return strings.ToLower(name)
+	}
+	return name
+}
@@ -0,0 +1,174 @@
+package layout
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CollisionPolicy decides what happens when two media items map to the same path.
+type CollisionPolicy string
+
+const (
+	// Suffix stores the item under the path with _1, _2, ... before the extension.
+	Suffix CollisionPolicy = "suffix"
+	// Skip leaves the existing file and does not store the item.
+	Skip CollisionPolicy = "skip"
+	// Overwrite replaces the existing file with the item.
+	Overwrite CollisionPolicy = "overwrite"
+	// HashCompare treats the item as stored when its content equals the
+	// existing file and falls back to Suffix when it differs.
+	HashCompare CollisionPolicy = "hash"
+)
+
+// ParseCollisionPolicy parses the name of a policy.
+func ParseCollisionPolicy(name string) (CollisionPolicy, error) {
+	switch policy := CollisionPolicy(name); policy {
+	case Suffix, Skip, Overwrite, HashCompare:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown collision policy %q, want %s, %s, %s or %s", name, Suffix, Skip, Overwrite, HashCompare)
+}
+
+// Action tells the caller how to store an item at a resolved path.
+type Action int
+
+const (
+	// Write stores the item at a free path.
+	Write Action = iota
+	// SkipItem does not store the item.
+	SkipItem
+	// OverwriteFile replaces the file at the path.
+	OverwriteFile
+	// CompareContent stores the item only when its content differs from the
+	// file at the path, in which case the caller resolves again with Suffix.
+	CompareContent
+)
+
+// Resolver hands out collision free paths below a directory. Paths are
+// compared case-insensitively when the directory's filesystem is, so items
+// differing only by case never overwrite each other on macOS or Windows.
+// A Resolver is safe for concurrent use.
+type Resolver struct {
+	dir             string
+	caseInsensitive bool
+
+	mu     sync.Mutex
+	owners map[string]string // folded path to media item id
+}
+
+// NewResolver returns a resolver for dir, probing the filesystem for case sensitivity.
+func NewResolver(dir string) *Resolver {
+	caseInsensitive, err := CaseInsensitive(dir)
+	if err != nil {
+		caseInsensitive = true // the safe assumption, e.g. for dry runs before dir exists
+	}
+
+	return &Resolver{
+		dir:             dir,
+		caseInsensitive: caseInsensitive,
+		owners:          make(map[string]string),
+	}
+}
+
+// CaseInsensitive reports whether names in dir are case-insensitive.
+func CaseInsensitive(dir string) (bool, error) {
+	f, err := os.CreateTemp(dir, ".case-probe-")
+	if err != nil {
+		return false, err
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+
+	probe := filepath.Join(filepath.Dir(name), strings.ToUpper(filepath.Base(name)))
+	if _, err := os.Stat(probe); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// CaseInsensitiveFS reports whether the resolver folds case.
+func (r *Resolver) CaseInsensitiveFS() bool {
+	return r.caseInsensitive
+}
+
+func (r *Resolver) key(p string) string {
+	if r.caseInsensitive {
+		return strings.ToLower(p)
+	}
+	return p
+}
+
+// Claim records that the media item owns the path, e.g. from a manifest.
+func (r *Resolver) Claim(p, id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.owners[r.key(p)] = id
+}
+
+// Owner returns the media item owning the path.
+func (r *Resolver) Owner(p string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.owners[r.key(p)]
+	return id, ok
+}
+
+// Resolve returns where to store the media item id which the layout placed
+// at p, and how. The returned path is claimed for id except for SkipItem
+// and CompareContent.
+func (r *Resolver) Resolve(p, id string, policy CollisionPolicy) (string, Action) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if owner, ok := r.owners[r.key(p)]; ok && owner == id {
+		return p, Write
+	}
+	if r.free(p) {
+		r.owners[r.key(p)] = id
+		return p, Write
+	}
+
+	switch policy {
+	case Skip:
+		return p, SkipItem
+	case Overwrite:
+		r.owners[r.key(p)] = id
+		return p, OverwriteFile
+	case HashCompare:
+		return p, CompareContent
+	}
+
+	ext := path.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, n, ext)
+		if owner, ok := r.owners[r.key(candidate)]; ok && owner == id {
+			return candidate, Write
+		}
+		if r.free(candidate) {
+			r.owners[r.key(candidate)] = id
+			return candidate, Write
+		}
+	}
+}
+
+// free reports whether no item owns p and no file exists at p.
+func (r *Resolver) free(p string) bool {
+	if _, ok := r.owners[r.key(p)]; ok {
+		return false
+	}
+	_, err := os.Lstat(filepath.Join(r.dir, filepath.FromSlash(p)))
+	return errors.Is(err, fs.ErrNotExist)
+}
@@ -0,0 +1,244 @@
+// Package layout derives local paths for media items from templates such as
+// {{year}}/{{month}}/{{filename}} or {{album}}/{{date}}_{{id}}.{{ext}}.
+package layout
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+const (
+	// Unknown replaces date fields of media items without a creation time.
+	Unknown = "unknown"
+	// NoAlbum replaces {{album}} for media items which are in no album.
+	NoAlbum = "no-album"
+
+	openDelim  = "{{"
+	closeDelim = "}}"
+)
+
+// Fields lists the names usable in templates.
+var Fields = map[string]string{
+	"year":     "four digit creation year",
+	"month":    "two digit creation month",
+	"day":      "two digit creation day",
+	"date":     "creation date as 2006-01-02",
+	"time":     "creation time as 150405",
+	"id":       "media item id",
+	"filename": "filename including extension",
+	"name":     "filename without extension",
+	"ext":      "extension without dot, derived from the mime type when the filename has none",
+	"type":     "photo or video",
+	"camera":   "camera make and model",
+	"album":    "title of the album, " + NoAlbum + " when in none",
+}
+
+// Default is the layout used when none is configured.
+var Default = MustParse("{{year}}/{{month}}/{{filename}}")
+
+type token struct {
+	literal string
+	field   string
+}
+
+// Template is a parsed layout. Each slash separated segment is sanitized
+// after expansion so field values can never add directories.
+type Template struct {
+	text     string
+	segments [][]token
+}
+
+// Parse parses a layout template.
+func Parse(text string) (*Template, error) {
+	t := &Template{text: text}
+
+	if strings.HasPrefix(text, "/") {
+		return nil, fmt.Errorf("layout %q: must be relative", text)
+	}
+
+	for _, segment := range strings.Split(text, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("layout %q: invalid path segment %q", text, segment)
+		}
+
+		var tokens []token
+		rest := segment
+		for rest != "" {
+			start := strings.Index(rest, openDelim)
+			if start < 0 {
+				tokens = append(tokens, token{literal: rest})
+				break
+			}
+			if start > 0 {
+				tokens = append(tokens, token{literal: rest[:start]})
+			}
+
+			end := strings.Index(rest[start:], closeDelim)
+			if end < 0 {
+				return nil, fmt.Errorf("layout %q: unclosed %s", text, openDelim)
+			}
+
+			field := strings.TrimSpace(rest[start+len(openDelim) : start+end])
+			if _, ok := Fields[field]; !ok {
+				return nil, fmt.Errorf("layout %q: unknown field %q, want one of %s", text, field, strings.Join(fieldNames(), ", "))
+			}
+			tokens = append(tokens, token{field: field})
+
+			rest = rest[start+end+len(closeDelim):]
+		}
+		t.segments = append(t.segments, tokens)
+	}
+
+	return t, nil
+}
+
+// MustParse is like Parse but panics on error.
+func MustParse(text string) *Template {
+	t, err := Parse(text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func fieldNames() []string {
+	names := make([]string, 0, len(Fields))
+	for name := range Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *Template) String() string {
+	return t.text
+}
+
+// UsesAlbum reports whether the template needs album membership.
+func (t *Template) UsesAlbum() bool {
+	for _, segment := range t.segments {
+		for _, tok := range segment {
+			if tok.field == "album" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Execute returns the slash separated path of the media item in the album.
+func (t *Template) Execute(item mediaitems.MediaItem, album string) string {
+	segments := make([]string, len(t.segments))
+	for i, segment := range t.segments {
+		var b strings.Builder
+		for _, tok := range segment {
+			if tok.field == "" {
+				b.WriteString(tok.literal)
+				continue
+			}
+			b.WriteString(value(tok.field, item, album))
+		}
+		segments[i] = Sanitize(b.String())
+	}
+	return path.Join(segments...)
+}
+
+func value(field string, item mediaitems.MediaItem, album string) string {
+	var metadata mediaitems.MediaMetadata
+	if item.MediaMetadata != nil {
+		metadata = *item.MediaMetadata
+	}
+	creationTime := metadata.CreationTime
+
+	switch field {
+	case "year", "month", "day", "date", "time":
+		if creationTime.IsZero() {
+			return Unknown
+		}
+		return creationTime.Format(map[string]string{
+			"year":  "2006",
+			"month": "01",
+			"day":   "02",
+			"date":  "2006-01-02",
+			"time":  "150405",
+		}[field])
+	case "id":
+		return item.ID
+	case "filename":
+		if item.Filename == "" {
+			return item.ID + extension(item, true)
+		}
+		return item.Filename
+	case "name":
+		if item.Filename == "" {
+			return item.ID
+		}
+		return strings.TrimSuffix(item.Filename, path.Ext(item.Filename))
+	case "ext":
+		return strings.TrimPrefix(extension(item, false), ".")
+	case "type":
+		if item.IsVideo() {
+			return "video"
+		}
+		return "photo"
+	case "camera":
+		var cameraMake, model string
+		switch {
+		case metadata.Photo != nil:
+			cameraMake, model = metadata.Photo.CameraMake, metadata.Photo.CameraModel
+		case metadata.Video != nil:
+			cameraMake, model = metadata.Video.CameraMake, metadata.Video.CameraModel
+		}
+		camera := strings.TrimSpace(cameraMake + " " + strings.TrimSpace(strings.TrimPrefix(model, cameraMake)))
+		if camera == "" {
+			return Unknown
+		}
+		return camera
+	case "album":
+		if album == "" {
+			return NoAlbum
+		}
+		return album
+	}
+	return ""
+}
+
+// mimeExtensions pins the extension of common types, mime.ExtensionsByType
+// depends on the system's mime database.
+var mimeExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/heic":      ".heic",
+	"image/heif":      ".heif",
+	"image/tiff":      ".tif",
+	"image/bmp":       ".bmp",
+	"video/mp4":       ".mp4",
+	"video/quicktime": ".mov",
+	"video/mpeg":      ".mpg",
+	"video/3gpp":      ".3gp",
+	"video/x-msvideo": ".avi",
+	"video/webm":      ".webm",
+}
+
+// extension returns the extension with dot from the filename, or from the mime type.
+func extension(item mediaitems.MediaItem, mimeOnly bool) string {
+	if ext := path.Ext(item.Filename); ext != "" && !mimeOnly {
+		return ext
+	}
+	if ext, ok := mimeExtensions[item.MimeType]; ok {
+		return ext
+	}
+	exts, err := mime.ExtensionsByType(item.MimeType)
+	if err != nil || len(exts) == 0 {
+		return ""
+	}
+	sort.Strings(exts)
+	return exts[0]
+}
@@ -0,0 +1,153 @@
+package layout
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+func TestExecute(t *testing.T) {
+	item := mediaitems.MediaItem{
+		ID:       "abc",
+		Filename: "IMG_0001.HEIC",
+		MimeType: "image/heic",
+		MediaMetadata: &mediaitems.MediaMetadata{
+			CreationTime: time.Date(2019, time.June, 7, 8, 9, 10, 0, time.UTC),
+			Photo:        &mediaitems.Photo{CameraMake: "Apple", CameraModel: "iPhone XS"},
+		},
+	}
+
+	for text, want := range map[string]string{
+		"{{year}}/{{month}}/{{filename}}":      "2019/06/IMG_0001.HEIC",
+		"{{album}}/{{date}}_{{id}}.{{ext}}":    "Trips_ Spain/2019-06-07_abc.HEIC",
+		"{{camera}}/{{name}}-{{time}}.{{ext}}": "Apple iPhone XS/IMG_0001-080910.HEIC",
+		"{{type}}s/{{ year }}/{{day}}":         "photos/2019/07",
+		"by-id/{{id}}":                         "by-id/abc",
+		"{{album}}/../{{filename}}/../escape":  "",
+	} {
+		tmpl, err := Parse(text)
+		if want == "" {
+			if err == nil {
+				t.Errorf("%q parsed, expected error", text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tmpl.Execute(item, "Trips/ Spain"); got != want {
+			t.Errorf("%q executed to %q not expected %q", text, got, want)
+		}
+	}
+
+	noMetadata := mediaitems.MediaItem{ID: "x", MimeType: "video/mp4"}
+	if got := MustParse("{{year}}/{{album}}/{{filename}}").Execute(noMetadata, ""); got != "unknown/no-album/x.mp4" {
+		t.Errorf("executed to %q not expected %q", got, "unknown/no-album/x.mp4")
+	}
+
+	if _, err := Parse("{{year}}/{{unknown}}"); err == nil {
+		t.Error("unknown field parsed")
+	}
+	if _, err := Parse("{{year"); err == nil {
+		t.Error("unclosed field parsed")
+	}
+	if !MustParse("{{album}}/{{filename}}").UsesAlbum() || Default.UsesAlbum() {
+		t.Error("unexpected UsesAlbum")
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	for segment, want := range map[string]string{
+		"a/b\\c":          "a_b_c",
+		`what?<>:"|*`:     "what_______",
+		"trailing. . ":    "trailing",
+		"CON.txt":         "_CON.txt",
+		"con":             "_con",
+		"":                "_",
+		"..":              "_",
+		"tab\there":       "tab_here",
+		"normal name.jpg": "normal name.jpg",
+	} {
+		if got := Sanitize(segment); got != want {
+			t.Errorf("Sanitize(%q) = %q not expected %q", segment, got, want)
+		}
+	}
+
+	long := Sanitize(strings.Repeat("é", 200) + ".jpg")
+	if len(long) > MaxSegmentLength || !strings.HasSuffix(long, ".jpg") {
+		t.Errorf("long segment %d bytes %q", len(long), long)
+	}
+}
+
+func TestAlbumDirs(t *testing.T) {
+	dirs := NewAlbumDirs(true)
+	for _, tt := range []struct{ title, id, want string }{
+		{"Trip", "1", "Trip"},
+		{"trip", "2", "trip 2"},
+		{"", "3", "3"},
+		{"a/b", "4", "a_b"},
+	} {
+		if got := dirs.Name(tt.title, tt.id); got != tt.want {
+			t.Errorf("Name(%q, %q) = %q not expected %q", tt.title, tt.id, got, tt.want)
+		}
+	}
+
+	if got := NewAlbumDirs(false).Name("trip", "2"); got != "trip" {
+		t.Errorf("case-sensitive name %q not expected", got)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "existing.jpg"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Resolver{dir: dir, caseInsensitive: true, owners: make(map[string]string)}
+
+	if p, action := r.Resolve("a.jpg", "1", Suffix); p != "a.jpg" || action != Write {
+		t.Errorf("resolved %s %d", p, action)
+	}
+	if p, action := r.Resolve("a.jpg", "1", Suffix); p != "a.jpg" || action != Write {
+		t.Errorf("same item resolved %s %d", p, action)
+	}
+	if p, action := r.Resolve("A.JPG", "2", Suffix); p != "A_1.JPG" || action != Write {
+		t.Errorf("case-insensitive collision resolved %s %d", p, action)
+	}
+	if p, action := r.Resolve("existing.jpg", "3", Suffix); p != "existing_1.jpg" || action != Write {
+		t.Errorf("existing file resolved %s %d", p, action)
+	}
+	if _, action := r.Resolve("a.jpg", "4", Skip); action != SkipItem {
+		t.Errorf("skip resolved %d", action)
+	}
+	if _, action := r.Resolve("a.jpg", "5", HashCompare); action != CompareContent {
+		t.Errorf("hash compare resolved %d", action)
+	}
+	if p, action := r.Resolve("a.jpg", "6", Overwrite); p != "a.jpg" || action != OverwriteFile {
+		t.Errorf("overwrite resolved %s %d", p, action)
+	}
+	if owner, _ := r.Owner("A.jpg"); owner != "6" {
+		t.Errorf("owner %s not expected %s", owner, "6")
+	}
+
+	sensitive := &Resolver{dir: dir, owners: make(map[string]string)}
+	sensitive.Claim("a.jpg", "1")
+	if p, _ := sensitive.Resolve("A.jpg", "2", Suffix); p != "A.jpg" {
+		t.Errorf("case-sensitive resolved %s", p)
+	}
+}
+
+func TestParseCollisionPolicy(t *testing.T) {
+	for _, name := range []string{"suffix", "skip", "overwrite", "hash"} {
+		if _, err := ParseCollisionPolicy(name); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := ParseCollisionPolicy("rename"); err == nil {
+		t.Error("unknown policy parsed")
+	}
+}
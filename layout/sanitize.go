@@ -0,0 +1,67 @@
+package layout
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxSegmentLength is the longest path segment most filesystems accept, in bytes.
+const MaxSegmentLength = 255
+
+// windowsReservedNames may not be used as file names on Windows, with any extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Sanitize returns a single path segment which is valid on Linux, macOS and
+// Windows: separators, reserved and control characters are replaced with _,
+// trailing dots and spaces are removed, reserved names are prefixed and the
+// result is truncated to MaxSegmentLength bytes keeping the extension.
+func Sanitize(segment string) string {
+	segment = strings.Map(func(r rune) rune {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r):
+			return '_'
+		case strings.ContainsRune(`/\<>:"|?*`, r):
+			return '_'
+		}
+		return r
+	}, segment)
+
+	segment = strings.TrimRight(strings.TrimSpace(segment), ". ")
+	if segment == "" {
+		return "_"
+	}
+
+	base := segment
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if windowsReservedNames[strings.ToUpper(base)] {
+		segment = "_" + segment
+	}
+
+	if len(segment) > MaxSegmentLength {
+		ext := ""
+		if i := strings.LastIndexByte(segment, '.'); i > 0 && len(segment)-i <= 16 {
+			ext = segment[i:]
+		}
+		segment = truncate(segment[:len(segment)-len(ext)], MaxSegmentLength-len(ext)) + ext
+	}
+
+	return segment
+}
+
+// truncate cuts s to at most n bytes without splitting a rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,342 @@
+// Package match filters media items on the client by fields the search API
+// cannot filter by, such as camera model, filename or dimensions.
+//
+// Predicates compose with And, Or and Not. Search and List push what the
+// server supports into the search filters, e.g. a MimeType of videos
+// becomes a media type filter, and check every streamed item against the
+// predicate, so pushing down only saves transfer.
+package match
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+// Predicate reports whether a media item matches.
+type Predicate interface {
+	Match(item mediaitems.MediaItem) bool
+}
+
+// pushDowner is a predicate the server can check in part, it narrows
+// filters without excluding any matching item.
+type pushDowner interface {
+	pushDown(f *mediaitems.Filters)
+}
+
+// Func adapts a function to a Predicate.
+type Func func(item mediaitems.MediaItem) bool
+
+func (fn Func) Match(item mediaitems.MediaItem) bool {
+	return fn(item)
+}
+
+// All matches every media item.
+var All Predicate = Func(func(mediaitems.MediaItem) bool { return true })
+
+type and []Predicate
+
+// And matches the media items all predicates match.
+func And(predicates ...Predicate) Predicate {
+	return and(predicates)
+}
+
+func (a and) Match(item mediaitems.MediaItem) bool {
+	for _, p := range a {
+		if !p.Match(item) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a and) pushDown(f *mediaitems.Filters) {
+	for _, p := range a {
+		if pd, ok := p.(pushDowner); ok {
+			pd.pushDown(f)
+		}
+	}
+}
+
+type or []Predicate
+
+// Or matches the media items any predicate matches.
+func Or(predicates ...Predicate) Predicate {
+	return or(predicates)
+}
+
+func (o or) Match(item mediaitems.MediaItem) bool {
+	for _, p := range o {
+		if p.Match(item) {
+			return true
+		}
+	}
+	return false
+}
+
+type not struct {
+	p Predicate
+}
+
+// Not matches the media items p does not match.
+func Not(p Predicate) Predicate {
+	return not{p}
+}
+
+func (n not) Match(item mediaitems.MediaItem) bool {
+	return !n.p.Match(item)
+}
+
+type cameraModel string
+
+// CameraModel matches the photos and videos taken with the camera, given
+// as the model or as make and model, e.g. "Canon EOS R6" or "Apple
+// iPhone 12", ignoring case.
+func CameraModel(model string) Predicate {
+	return cameraModel(strings.TrimSpace(model))
+}
+
+func (m cameraModel) Match(item mediaitems.MediaItem) bool {
+	if item.MediaMetadata == nil {
+		return false
+	}
+
+	var cameraMake, model string
+	switch {
+	case item.MediaMetadata.Photo != nil:
+		cameraMake, model = item.MediaMetadata.Photo.CameraMake, item.MediaMetadata.Photo.CameraModel
+	case item.MediaMetadata.Video != nil:
+		cameraMake, model = item.MediaMetadata.Video.CameraMake, item.MediaMetadata.Video.CameraModel
+	}
+	if model == "" {
+		return false
+	}
+	return strings.EqualFold(string(m), model) || strings.EqualFold(string(m), cameraMake+" "+model)
+}
+
+type filenameGlob string
+
+// FilenameGlob matches the media items whose filename matches the pattern
+// of path.Match, ignoring case, e.g. "img_*.jpg".
+func FilenameGlob(pattern string) (Predicate, error) {
+	pattern = strings.ToLower(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("filename pattern %q: %w", pattern, err)
+	}
+	return filenameGlob(pattern), nil
+}
+
+func (g filenameGlob) Match(item mediaitems.MediaItem) bool {
+	ok, _ := path.Match(string(g), strings.ToLower(item.Filename))
+	return ok
+}
+
+type minResolution struct {
+	long, short int64
+}
+
+// MinResolution matches the media items at least width by height pixels
+// large, in either orientation.
+func MinResolution(width, height int64) Predicate {
+	if width < height {
+		width, height = height, width
+	}
+	return minResolution{long: width, short: height}
+}
+
+func (r minResolution) Match(item mediaitems.MediaItem) bool {
+	if item.MediaMetadata == nil {
+		return false
+	}
+	long, short := item.MediaMetadata.Width, item.MediaMetadata.Height
+	if long < short {
+		long, short = short, long
+	}
+	return long >= r.long && short >= r.short
+}
+
+type mimeType []string
+
+// MimeType matches the media items of any of the types, which may end in
+// a wildcard subtype, e.g. "image/*". Only videos or only images are
+// pushed down as a media type filter.
+func MimeType(types ...string) Predicate {
+	m := make(mimeType, len(types))
+	for i, t := range types {
+		m[i] = strings.ToLower(t)
+	}
+	return m
+}
+
+func (m mimeType) Match(item mediaitems.MediaItem) bool {
+	itemType := strings.ToLower(item.MimeType)
+	for _, t := range m {
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok {
+			if strings.HasPrefix(itemType, prefix+"/") {
+				return true
+			}
+		} else if itemType == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (m mimeType) pushDown(f *mediaitems.Filters) {
+	if len(m) == 0 || f.MediaTypeFilter != nil {
+		return
+	}
+
+	var mediaType mediaitems.MediaType
+	for _, t := range m {
+		var typ mediaitems.MediaType
+		switch {
+		case strings.HasPrefix(t, "image/"):
+			typ = mediaitems.PhotoType
+		case strings.HasPrefix(t, "video/"):
+			typ = mediaitems.VideoType
+		default:
+			return
+		}
+		if mediaType != "" && typ != mediaType {
+			return
+		}
+		mediaType = typ
+	}
+
+	f.MediaTypeFilter = &mediaitems.MediaTypeFilter{MediaTypes: []mediaitems.MediaType{mediaType}}
+}
+
+type descriptionContains string
+
+// DescriptionContains matches the media items whose description contains
+// s, ignoring case.
+func DescriptionContains(s string) Predicate {
+	return descriptionContains(strings.ToLower(s))
+}
+
+func (d descriptionContains) Match(item mediaitems.MediaItem) bool {
+	return strings.Contains(strings.ToLower(item.Description), string(d))
+}
+
+type aspectRatio struct {
+	min, max float64
+}
+
+// AspectRatio matches the media items whose width divided by height is
+// between min and max, both included. Use 16.0/9 for both to match one
+// ratio, a tolerance of 1% absorbs rounded dimensions.
+func AspectRatio(min, max float64) Predicate {
+	return aspectRatio{min: min * 0.99, max: max * 1.01}
+}
+
+func (a aspectRatio) Match(item mediaitems.MediaItem) bool {
+	if item.MediaMetadata == nil || item.MediaMetadata.Height <= 0 {
+		return false
+	}
+	ratio := float64(item.MediaMetadata.Width) / float64(item.MediaMetadata.Height)
+	return ratio >= a.min && ratio <= a.max
+}
+
+type created struct {
+	start, end time.Time
+}
+
+// Created matches the media items created at or after start and before
+// end, a zero start or end leaves the range open. It is pushed down as a
+// date range widened by a day, dates are matched in an unknown time zone.
+func Created(start, end time.Time) Predicate {
+	return created{start: start, end: end}
+}
+
+func (c created) Match(item mediaitems.MediaItem) bool {
+	if item.MediaMetadata == nil || item.MediaMetadata.CreationTime.IsZero() {
+		return false
+	}
+	t := item.MediaMetadata.CreationTime
+	return (c.start.IsZero() || !t.Before(c.start)) && (c.end.IsZero() || t.Before(c.end))
+}
+
+func (c created) pushDown(f *mediaitems.Filters) {
+	if f.DateFilter != nil {
+		return
+	}
+
+	r := mediaitems.DateRange{
+		StartDate: mediaitems.Date{Year: 1, Month: 1, Day: 1},
+		EndDate:   mediaitems.Date{Year: 9999, Month: 12, Day: 31},
+	}
+	if !c.start.IsZero() {
+		r.StartDate = mediaitems.NewDate(c.start.UTC().AddDate(0, 0, -1))
+	}
+	if !c.end.IsZero() {
+		r.EndDate = mediaitems.NewDate(c.end.UTC().AddDate(0, 0, 1))
+	}
+	f.DateFilter = &mediaitems.DateFilter{Ranges: []mediaitems.DateRange{r}}
+}
+
+// PushDown returns req with the parts of p the server supports added to
+// its filters. Requests of an album cannot have filters and are returned
+// unchanged.
+func PushDown(req mediaitems.SearchMediaItemRequest, p Predicate) mediaitems.SearchMediaItemRequest {
+	pd, ok := p.(pushDowner)
+	if !ok || req.AlbumID != "" {
+		return req
+	}
+
+	var filters mediaitems.Filters
+	if req.Filters != nil {
+		filters = *req.Filters
+	}
+	pd.pushDown(&filters)
+	if filters != (mediaitems.Filters{}) {
+		req.Filters = &filters
+	}
+	return req
+}
+
+// Search streams the media items of the search which match p, pushing
+// down what the server supports.
+func Search(ctx context.Context, client *http.Client, req mediaitems.SearchMediaItemRequest, p Predicate) (<-chan mediaitems.MediaItem, <-chan error) {
+	itemCh, errCh := mediaitems.Search(ctx, client, PushDown(req, p))
+	return Filter(ctx, itemCh, p), errCh
+}
+
+// List streams the media items of the library which match p, searching
+// instead of listing when the server can check part of p.
+func List(ctx context.Context, client *http.Client, p Predicate) (<-chan mediaitems.MediaItem, <-chan error) {
+	req := PushDown(mediaitems.SearchMediaItemRequest{PageSize: api.MaxPageSize}, p)
+	if req.Filters == nil {
+		itemCh, errCh := mediaitems.List(ctx, client, mediaitems.ListMediaItemsRequest{PageSize: api.MaxPageSize})
+		return Filter(ctx, itemCh, p), errCh
+	}
+	return Search(ctx, client, req, p)
+}
+
+// Filter streams the media items of itemCh which match p. It returns once
+// itemCh is closed or ctx is done.
+func Filter(ctx context.Context, itemCh <-chan mediaitems.MediaItem, p Predicate) <-chan mediaitems.MediaItem {
+	matchCh := make(chan mediaitems.MediaItem)
+
+	go func() {
+		defer close(matchCh)
+		for item := range itemCh {
+			if !p.Match(item) {
+				continue
+			}
+			select {
+			case matchCh <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return matchCh
+}
@@ -0,0 +1,163 @@
+package match
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+var _ http.RoundTripper = mockRoundTripper{}
+
+type mockRoundTripper struct {
+	roundTripperFn func(*http.Request) (*http.Response, error)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (mock mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return mock.roundTripperFn(req)
+}
+
+var items = []mediaitems.MediaItem{
+	{ID: "a", Filename: "IMG_0001.JPG", MimeType: "image/jpeg", Description: "Dinner at the Beach",
+		MediaMetadata: &mediaitems.MediaMetadata{CreationTime: time.Date(2023, time.February, 1, 0, 0, 0, 0, time.UTC), Width: 4032, Height: 3024,
+			Photo: &mediaitems.Photo{CameraMake: "Apple", CameraModel: "iPhone 12"}}},
+	{ID: "b", Filename: "pano.heic", MimeType: "image/heic",
+		MediaMetadata: &mediaitems.MediaMetadata{CreationTime: time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC), Width: 12000, Height: 3000,
+			Photo: &mediaitems.Photo{CameraMake: "Canon", CameraModel: "Canon EOS R6"}}},
+	{ID: "c", Filename: "clip.mp4", MimeType: "video/mp4",
+		MediaMetadata: &mediaitems.MediaMetadata{CreationTime: time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC), Width: 1080, Height: 1920,
+			Video: &mediaitems.Video{CameraMake: "Apple", CameraModel: "iPhone 12"}}},
+	{ID: "d", Filename: "scan.png", MimeType: "image/png"},
+}
+
+func matching(p Predicate) string {
+	var ids string
+	for _, item := range items {
+		if p.Match(item) {
+			ids += item.ID
+		}
+	}
+	return ids
+}
+
+func TestPredicates(t *testing.T) {
+	jpegs, err := FilenameGlob("img_*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FilenameGlob("[a-"); err == nil {
+		t.Error("bad pattern accepted")
+	}
+
+	for _, tt := range []struct {
+		name string
+		p    Predicate
+		want string
+	}{
+		{"camera model", CameraModel("iphone 12"), "ac"},
+		{"camera make and model", CameraModel("Apple iPhone 12"), "ac"},
+		{"camera model repeating make", CameraModel("Canon EOS R6"), "b"},
+		{"filename", jpegs, "a"},
+		{"resolution", MinResolution(3000, 4000), "ab"},
+		{"resolution portrait", MinResolution(1080, 1920), "abc"},
+		{"mime type", MimeType("image/*"), "abd"},
+		{"mime types", MimeType("image/heic", "video/mp4"), "bc"},
+		{"description", DescriptionContains("beach"), "a"},
+		{"aspect ratio", AspectRatio(4.0/3, 4.0/3), "a"},
+		{"panorama", AspectRatio(2, 100), "b"},
+		{"and", And(CameraModel("iPhone 12"), MimeType("image/*")), "a"},
+		{"or", Or(jpegs, MimeType("video/*")), "ac"},
+		{"not", Not(MimeType("image/*")), "c"},
+		{"created", Created(time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC), time.Time{}), "bc"},
+		{"created before", Created(time.Time{}, time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC)), "a"},
+		{"all", All, "abcd"},
+		{"func", Func(func(item mediaitems.MediaItem) bool { return item.ID == "d" }), "d"},
+	} {
+		if got := matching(tt.p); got != tt.want {
+			t.Errorf("%s matched %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPushDown(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		req  mediaitems.SearchMediaItemRequest
+		p    Predicate
+		want mediaitems.MediaType
+	}{
+		{"videos", mediaitems.SearchMediaItemRequest{}, MimeType("video/*"), mediaitems.VideoType},
+		{"images in and", mediaitems.SearchMediaItemRequest{}, And(CameraModel("x"), MimeType("image/jpeg", "image/png")), mediaitems.PhotoType},
+		{"mixed types", mediaitems.SearchMediaItemRequest{}, MimeType("image/jpeg", "video/mp4"), ""},
+		{"or", mediaitems.SearchMediaItemRequest{}, Or(MimeType("video/*"), CameraModel("x")), ""},
+		{"album", mediaitems.SearchMediaItemRequest{AlbumID: "1"}, MimeType("video/*"), ""},
+		{"created", mediaitems.SearchMediaItemRequest{}, And(Created(time.Now(), time.Time{}), MimeType("video/*")), mediaitems.VideoType},
+		{"existing filter", mediaitems.SearchMediaItemRequest{Filters: &mediaitems.Filters{
+			MediaTypeFilter: &mediaitems.MediaTypeFilter{MediaTypes: []mediaitems.MediaType{mediaitems.PhotoType}},
+		}}, MimeType("video/*"), mediaitems.PhotoType},
+	} {
+		req := PushDown(tt.req, tt.p)
+		var got mediaitems.MediaType
+		if req.Filters != nil && req.Filters.MediaTypeFilter != nil {
+			got = req.Filters.MediaTypeFilter.MediaTypes[0]
+		}
+		if got != tt.want {
+			t.Errorf("%s pushed down media type %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	var paths []string
+	client := &http.Client{Transport: mockRoundTripper{roundTripperFn: func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.URL.Path)
+
+		var resp any = mediaitems.ListMediaItemsResponse{MediaItems: items}
+		if req.URL.Path == "/v1/mediaItems:search" {
+			var search mediaitems.SearchMediaItemRequest
+			if err := json.NewDecoder(req.Body).Decode(&search); err != nil {
+				t.Fatal(err)
+			}
+			if search.Filters == nil || search.Filters.MediaTypeFilter == nil {
+				t.Errorf("search without media type filter %+v", search)
+			}
+			resp = mediaitems.SearchMediaItemResponse{MediaItems: items[2:3]}
+		}
+
+		body, _ := json.Marshal(resp)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(bytes.NewReader(body)),
+			Request:    req,
+		}, nil
+	}}}
+
+	collect := func(itemCh <-chan mediaitems.MediaItem, errCh <-chan error) string {
+		var ids string
+		for item := range itemCh {
+			ids += item.ID
+		}
+		select {
+		case err := <-errCh:
+			t.Fatal(err)
+		default:
+		}
+		return ids
+	}
+
+	ctx := context.Background()
+	if got := collect(List(ctx, client, DescriptionContains("beach"))); got != "a" || paths[0] != "/v1/mediaItems" {
+		t.Errorf("listed %q with %v", got, paths)
+	}
+
+	paths = nil
+	if got := collect(List(ctx, client, And(MimeType("video/*"), CameraModel("iPhone 12")))); got != "c" || paths[0] != "/v1/mediaItems:search" {
+		t.Errorf("searched %q with %v", got, paths)
+	}
+}
@@ -0,0 +1,63 @@
+package mediaitems
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/dlph/go-photoslibrary/api"
+)
+
+const (
+	// DownloadPhotoParam fetches the original photo bytes with most metadata.
+	DownloadPhotoParam = "d"
+	// DownloadVideoParam fetches the original video bytes.
+	DownloadVideoParam = "dv"
+)
+
+// DownloadURL returns the base URL with the parameter for the original bytes.
+// https://developers.google.com/photos/library/guides/access-media-items#base-urls
+func DownloadURL(mediaItem MediaItem) string {
+	if mediaItem.IsVideo() {
+		return fmt.Sprintf("%s=%s", mediaItem.BaseURL, DownloadVideoParam)
+	}
+	return fmt.Sprintf("%s=%s", mediaItem.BaseURL, DownloadPhotoParam)
+}
+
+// SizedURL returns the base URL for an image scaled to fit within width and height.
+func SizedURL(mediaItem MediaItem, width, height int) string {
+	return fmt.Sprintf("%s=w%d-h%d", mediaItem.BaseURL, width, height)
+}
+
+// Download writes the original bytes of the media item to w. Base URLs expire
+// after about an hour, refresh the media item with Get before downloading
+// items listed long ago.
+func Download(ctx context.Context, client *http.Client, mediaItem MediaItem, w io.Writer) (int64, error) {
+	return Fetch(ctx, client, DownloadURL(mediaItem), w)
+}
+
+// Fetch writes the bytes at rawURL, e.g. a SizedURL, to w.
+func Fetch(ctx context.Context, client *http.Client, rawURL string, w io.Writer) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := api.CheckResponse(resp); err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return n, err
+	}
+
+	return n, resp.Body.Close()
+}
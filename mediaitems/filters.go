@@ -0,0 +1,111 @@
+package mediaitems
+
+import "time"
+
+// Search orders, only allowed with a DateFilter.
+const (
+	OrderByCreationTime     = "MediaMetadata.creation_time"
+	OrderByCreationTimeDesc = "MediaMetadata.creation_time desc"
+)
+
+// Filters narrow a search, they cannot be combined with an album id.
+// https://developers.google.com/photos/library/guides/apply-filters
+type Filters struct {
+	DateFilter               *DateFilter      `json:"dateFilter,omitempty"`
+	ContentFilter            *ContentFilter   `json:"contentFilter,omitempty"`
+	MediaTypeFilter          *MediaTypeFilter `json:"mediaTypeFilter,omitempty"`
+	FeatureFilter            *FeatureFilter   `json:"featureFilter,omitempty"`
+	IncludeArchivedMedia     bool             `json:"includeArchivedMedia,omitempty"`
+	ExcludeNonAppCreatedData bool             `json:"excludeNonAppCreatedData,omitempty"`
+}
+
+// DateFilter matches media items created on any of the dates or in any of
+// the ranges, at most 5 of each.
+type DateFilter struct {
+	Dates  []Date      `json:"dates,omitempty"`
+	Ranges []DateRange `json:"ranges,omitempty"`
+}
+
+// Date is a calendar date, a zero month or day matches any month or day.
+type Date struct {
+	Year  int `json:"year,omitempty"`
+	Month int `json:"month,omitempty"`
+	Day   int `json:"day,omitempty"`
+}
+
+// NewDate returns the date of t.
+func NewDate(t time.Time) Date {
+	return Date{Year: t.Year(), Month: int(t.Month()), Day: t.Day()}
+}
+
+// DateRange is a range of dates, both ends included.
+type DateRange struct {
+	StartDate Date `json:"startDate"`
+	EndDate   Date `json:"endDate"`
+}
+
+// ContentCategory is a category media items are classified in.
+type ContentCategory string
+
+const (
+	ContentNone         ContentCategory = "NONE"
+	ContentLandscapes   ContentCategory = "LANDSCAPES"
+	ContentReceipts     ContentCategory = "RECEIPTS"
+	ContentCityscapes   ContentCategory = "CITYSCAPES"
+	ContentLandmarks    ContentCategory = "LANDMARKS"
+	ContentSelfies      ContentCategory = "SELFIES"
+	ContentPeople       ContentCategory = "PEOPLE"
+	ContentPets         ContentCategory = "PETS"
+	ContentWeddings     ContentCategory = "WEDDINGS"
+	ContentBirthdays    ContentCategory = "BIRTHDAYS"
+	ContentDocuments    ContentCategory = "DOCUMENTS"
+	ContentTravel       ContentCategory = "TRAVEL"
+	ContentAnimals      ContentCategory = "ANIMALS"
+	ContentFood         ContentCategory = "FOOD"
+	ContentSport        ContentCategory = "SPORT"
+	ContentNight        ContentCategory = "NIGHT"
+	ContentPerformances ContentCategory = "PERFORMANCES"
+	ContentWhiteboards  ContentCategory = "WHITEBOARDS"
+	ContentScreenshots  ContentCategory = "SCREENSHOTS"
+	ContentUtility      ContentCategory = "UTILITY"
+	ContentArts         ContentCategory = "ARTS"
+	ContentCrafts       ContentCategory = "CRAFTS"
+	ContentFashion      ContentCategory = "FASHION"
+	ContentHouses       ContentCategory = "HOUSES"
+	ContentGardens      ContentCategory = "GARDENS"
+	ContentFlowers      ContentCategory = "FLOWERS"
+	ContentHolidays     ContentCategory = "HOLIDAYS"
+)
+
+// ContentFilter includes and excludes content categories, at most 10 each.
+type ContentFilter struct {
+	IncludedContentCategories []ContentCategory `json:"includedContentCategories,omitempty"`
+	ExcludedContentCategories []ContentCategory `json:"excludedContentCategories,omitempty"`
+}
+
+// MediaType is a kind of media item.
+type MediaType string
+
+const (
+	AllMedia  MediaType = "ALL_MEDIA"
+	PhotoType MediaType = "PHOTO"
+	VideoType MediaType = "VIDEO"
+)
+
+// MediaTypeFilter matches media items of a single type.
+type MediaTypeFilter struct {
+	MediaTypes []MediaType `json:"mediaTypes,omitempty"`
+}
+
+// Feature is a feature of media items.
+type Feature string
+
+const (
+	FeatureNone Feature = "NONE"
+	Favorites   Feature = "FAVORITES"
+)
+
+// FeatureFilter matches media items with the features.
+type FeatureFilter struct {
+	IncludedFeatures []Feature `json:"includedFeatures,omitempty"`
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dlph/go-photoslibrary/api"
@@ -21,6 +22,11 @@ const (
 	SearchMediaItemsPath = "mediaItems:search"
 )
 
+const (
+	PhotoMimeTypePrefix = "image/"
+	VideoMimeTypePrefix = "video/"
+)
+
 const (
 	UnspecifiedVideoProcessingStatus VideoProcessingStatus = "UNSPECIFIED"
 	ProcessingVideoProcessingStatus  VideoProcessingStatus = "PROCESSING"
@@ -39,6 +45,14 @@ type MediaItem struct {
 	Filename        string           `json:"filename,omitempty"`
 }
 
+// IsVideo reports whether the media item is a video.
+func (m MediaItem) IsVideo() bool {
+	if m.MediaMetadata != nil && m.MediaMetadata.Video != nil {
+		return true
+	}
+	return strings.HasPrefix(m.MimeType, VideoMimeTypePrefix)
+}
+
 type MediaMetadata struct {
 	CreationTime time.Time `json:"creationTime,omitempty"`
 	Width        int64     `json:"width,omitempty"`
@@ -83,7 +97,7 @@ type ListMediaItemsResponse struct {
 // List https://developers.google.com/photos/library/reference/rest/v1/mediaItems/list
 func List(ctx context.Context, client *http.Client, listRequest ListMediaItemsRequest) (<-chan MediaItem, <-chan error) {
 	respCh := make(chan MediaItem)
-	errCh := make(chan error)
+	errCh := make(chan error, 1)
 
 	go func(req ListMediaItemsRequest) {
 		defer close(respCh)
@@ -165,6 +179,10 @@ func list(ctx context.Context, client *http.Client, listAlbumsRequest ListMediaI
 		return listResponse, err
 	}
 
+	if err := api.CheckResponse(resp); err != nil {
+		return listResponse, err
+	}
+
 	slog.DebugContext(ctx, "received response from client", "response_headers", resp.Header, "request_headers", resp.Request.Header)
 
 	if err := json.NewDecoder(resp.Body).Decode(&listResponse); err != nil {
@@ -203,7 +221,7 @@ func Get(ctx context.Context, client *http.Client, getRequest GetMediaItemReques
 		Path:   urlPath,
 	}
 
-	req, err := http.NewRequest(http.MethodGet, rawURL.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL.String(), nil)
 	if err != nil {
 		return getResponse.MediaItem, err
 	}
@@ -213,7 +231,12 @@ func Get(ctx context.Context, client *http.Client, getRequest GetMediaItemReques
 		return getResponse.MediaItem, err
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&getResponse); err != nil {
+	if err := api.CheckResponse(resp); err != nil {
+		return getResponse.MediaItem, err
+	}
+
+	// the media item is returned as the response body, not wrapped
+	if err := json.NewDecoder(resp.Body).Decode(&getResponse.MediaItem); err != nil {
 		return getResponse.MediaItem, err
 	}
 
@@ -221,14 +244,11 @@ func Get(ctx context.Context, client *http.Client, getRequest GetMediaItemReques
 }
 
 type SearchMediaItemRequest struct {
-	AlbumID   string  `json:"albumId,omitempty"`
-	PageSize  int64   `json:"pageSize,omitempty"`
-	PageToken string  `json:"pageToken,omitempty`
-	Filters   Filters `json:"filters,omitempty"`
-	OrderBy   string  `json:"orderBy,omitempty"`
-}
-type Filters struct {
-	// TODO https://developers.google.com/photos/library/guides/apply-filters
+	AlbumID   string   `json:"albumId,omitempty"`
+	PageSize  int64    `json:"pageSize,omitempty"`
+	PageToken string   `json:"pageToken,omitempty"`
+	Filters   *Filters `json:"filters,omitempty"`
+	OrderBy   string   `json:"orderBy,omitempty"`
 }
 
 type SearchMediaItemResponse struct {
@@ -238,7 +258,7 @@ type SearchMediaItemResponse struct {
 
 func Search(ctx context.Context, client *http.Client, searchRequest SearchMediaItemRequest) (<-chan MediaItem, <-chan error) {
 	mediaItemCh := make(chan MediaItem)
-	errCh := make(chan error)
+	errCh := make(chan error, 1)
 
 	go func(req SearchMediaItemRequest) {
 		defer close(mediaItemCh)
@@ -296,7 +316,7 @@ func search(ctx context.Context, client *http.Client, searchRequest SearchMediaI
 		return searchResponse, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL.String(), bufio.NewReader(b))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL.String(), bufio.NewReader(b))
 	if err != nil {
 		return searchResponse, err
 	}
@@ -306,6 +326,10 @@ func search(ctx context.Context, client *http.Client, searchRequest SearchMediaI
 		return searchResponse, err
 	}
 
+	if err := api.CheckResponse(resp); err != nil {
+		return searchResponse, err
+	}
+
 	slog.DebugContext(ctx, "received response from client", "response_headers", resp.Header, "request_headers", resp.Request.Header)
 
 	if err := json.NewDecoder(resp.Body).Decode(&searchResponse); err != nil {
@@ -206,3 +206,103 @@ func TestSearch(t *testing.T) {
 		t.Errorf("incorrect number of MediaItems have %d want %d", len(mediaItems), 2)
 	}
 }
+
+func TestUploadAndBatchCreate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &http.Client{
+		Transport: mockRoundTripper{
+			roundTripperFn: func(req *http.Request) (*http.Response, error) {
+				var body []byte
+				switch req.URL.Path {
+				case "/v1/uploads":
+					if req.Header.Get(UploadProtocolHeader) != UploadProtocolRaw {
+						return nil, fmt.Errorf("upload protocol %q", req.Header.Get(UploadProtocolHeader))
+					}
+					body = []byte("upload-token")
+				case "/v1/mediaItems:batchCreate":
+					var batchReq BatchCreateMediaItemsRequest
+					if err := json.NewDecoder(req.Body).Decode(&batchReq); err != nil {
+						return nil, err
+					}
+					data, err := json.Marshal(&BatchCreateMediaItemsResponse{
+						NewMediaItemResults: []NewMediaItemResult{{
+							UploadToken: batchReq.NewMediaItems[0].SimpleMediaItem.UploadToken,
+							MediaItem:   MediaItem{ID: "new", Filename: batchReq.NewMediaItems[0].SimpleMediaItem.FileName},
+						}},
+					})
+					if err != nil {
+						return nil, err
+					}
+					body = data
+				default:
+					return nil, fmt.Errorf("unexpected path %s", req.URL.Path)
+				}
+
+				return &http.Response{
+					Status:     http.StatusText(http.StatusOK),
+					StatusCode: http.StatusOK,
+					Header:     map[string][]string{},
+					Body:       io.NopCloser(bytes.NewReader(body)),
+					Request:    req,
+				}, nil
+			},
+		},
+	}
+
+	uploadToken, err := Upload(ctx, client, UploadRequest{Filename: "a.jpg", MimeType: "image/jpeg", Content: bytes.NewReader([]byte("jpeg"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploadToken != "upload-token" {
+		t.Errorf("upload token %s not expected %s", uploadToken, "upload-token")
+	}
+
+	resp, err := BatchCreate(ctx, client, BatchCreateMediaItemsRequest{
+		NewMediaItems: []NewMediaItem{{SimpleMediaItem: SimpleMediaItem{UploadToken: uploadToken, FileName: "a.jpg"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.NewMediaItemResults) != 1 || !resp.NewMediaItemResults[0].Succeeded() {
+		t.Errorf("unexpected batch create response %+v", resp)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &http.Client{
+		Transport: mockRoundTripper{
+			roundTripperFn: func(req *http.Request) (*http.Response, error) {
+				body, statusCode := "original", http.StatusOK
+				if req.URL.String() != "https://lh3.example.com/abc=dv" {
+					body, statusCode = "expired", http.StatusForbidden
+				}
+				return &http.Response{
+					StatusCode: statusCode,
+					Header:     map[string][]string{},
+					Body:       io.NopCloser(bytes.NewReader([]byte(body))),
+					Request:    req,
+				}, nil
+			},
+		},
+	}
+
+	video := MediaItem{BaseURL: "https://lh3.example.com/abc", MimeType: "video/mp4"}
+
+	buf := bytes.NewBuffer(nil)
+	n, err := Download(ctx, client, video, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len("original")) || buf.String() != "original" {
+		t.Errorf("downloaded %d bytes %q", n, buf.String())
+	}
+
+	if _, err := Download(ctx, client, MediaItem{BaseURL: "https://lh3.example.com/abc"}, io.Discard); err == nil {
+		t.Error("expected error for photo download url")
+	}
+}
@@ -0,0 +1,172 @@
+package mediaitems
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/dlph/go-photoslibrary/api"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	UploadsPath               = "uploads"
+	BatchCreateMediaItemsPath = "mediaItems:batchCreate"
+
+	UploadContentTypeHeader  = "X-Goog-Upload-Content-Type"
+	UploadProtocolHeader     = "X-Goog-Upload-Protocol"
+	UploadProtocolRaw        = "raw"
+	uploadRequestContentType = "application/octet-stream"
+
+	batchCreateStatusCodeSucceeded = 0
+)
+
+const (
+	FirstInAlbumPosition         AlbumPositionType = "FIRST_IN_ALBUM"
+	LastInAlbumPosition          AlbumPositionType = "LAST_IN_ALBUM"
+	AfterMediaItemPosition       AlbumPositionType = "AFTER_MEDIA_ITEM"
+	AfterEnrichmentItemPosition  AlbumPositionType = "AFTER_ENRICHMENT_ITEM"
+	UnspecifiedAlbumPositionType AlbumPositionType = "POSITION_TYPE_UNSPECIFIED"
+)
+
+type UploadRequest struct {
+	Filename string // only used for logging, set SimpleMediaItem.FileName in BatchCreate
+	MimeType string
+	Content  io.Reader
+}
+
+// Upload https://developers.google.com/photos/library/guides/upload-media#uploading-bytes
+// returns the upload token to be used in BatchCreate.
+func Upload(ctx context.Context, client *http.Client, uploadRequest UploadRequest) (string, error) {
+	urlPath, err := url.JoinPath(api.PhotosLibraryVersion, UploadsPath)
+	if err != nil {
+		return "", err
+	}
+
+	rawURL := url.URL{
+		Scheme: api.PhotosLibraryScheme,
+		Host:   api.PhotosLibraryHost,
+		Path:   urlPath,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL.String(), uploadRequest.Content)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", uploadRequestContentType)
+	req.Header.Set(UploadProtocolHeader, UploadProtocolRaw)
+	if uploadRequest.MimeType != "" {
+		req.Header.Set(UploadContentTypeHeader, uploadRequest.MimeType)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	if err := api.CheckResponse(resp); err != nil {
+		return "", err
+	}
+
+	uploadToken, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	slog.DebugContext(ctx, "uploaded media bytes", "filename", uploadRequest.Filename)
+
+	return string(uploadToken), resp.Body.Close()
+}
+
+type BatchCreateMediaItemsRequest struct {
+	AlbumID       string         `json:"albumId,omitempty"`
+	NewMediaItems []NewMediaItem `json:"newMediaItems"`
+	AlbumPosition *AlbumPosition `json:"albumPosition,omitempty"`
+}
+
+type NewMediaItem struct {
+	Description     string          `json:"description,omitempty"`
+	SimpleMediaItem SimpleMediaItem `json:"simpleMediaItem"`
+}
+
+type SimpleMediaItem struct {
+	UploadToken string `json:"uploadToken"`
+	FileName    string `json:"fileName,omitempty"`
+}
+
+type AlbumPosition struct {
+	Position                 AlbumPositionType `json:"position"`
+	RelativeMediaItemID      string            `json:"relativeMediaItemId,omitempty"`
+	RelativeEnrichmentItemID string            `json:"relativeEnrichmentItemId,omitempty"`
+}
+
+type AlbumPositionType string
+
+type BatchCreateMediaItemsResponse struct {
+	NewMediaItemResults []NewMediaItemResult `json:"newMediaItemResults"`
+}
+
+type NewMediaItemResult struct {
+	UploadToken string    `json:"uploadToken"`
+	Status      Status    `json:"status"`
+	MediaItem   MediaItem `json:"mediaItem"`
+}
+
+// Succeeded reports whether the media item was created.
+func (r NewMediaItemResult) Succeeded() bool {
+	return r.Status.Code == batchCreateStatusCodeSucceeded && r.MediaItem.ID != ""
+}
+
+type Status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// BatchCreate https://developers.google.com/photos/library/reference/rest/v1/mediaItems/batchCreate
+// at most api.MaxBatchCreateSize items can be created per request.
+func BatchCreate(ctx context.Context, client *http.Client, batchCreateRequest BatchCreateMediaItemsRequest) (BatchCreateMediaItemsResponse, error) {
+	var batchCreateResponse BatchCreateMediaItemsResponse
+
+	urlPath, err := url.JoinPath(api.PhotosLibraryVersion, BatchCreateMediaItemsPath)
+	if err != nil {
+		return batchCreateResponse, err
+	}
+
+	rawURL := url.URL{
+		Scheme: api.PhotosLibraryScheme,
+		Host:   api.PhotosLibraryHost,
+		Path:   urlPath,
+	}
+
+	b := bytes.NewBuffer(nil)
+	if err := json.NewEncoder(b).Encode(&batchCreateRequest); err != nil {
+		return batchCreateResponse, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL.String(), b)
+	if err != nil {
+		return batchCreateResponse, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return batchCreateResponse, err
+	}
+
+	if err := api.CheckResponse(resp); err != nil {
+		return batchCreateResponse, err
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&batchCreateResponse); err != nil {
+		return batchCreateResponse, err
+	}
+
+	slog.DebugContext(ctx, "decoded json response body", "newMediaItemResults", len(batchCreateResponse.NewMediaItemResults))
+
+	return batchCreateResponse, resp.Body.Close()
+}
@@ -0,0 +1,130 @@
+package migrate
+
+import (
+	"fmt"
+	gosync "sync"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/internal/journal"
+)
+
+// Kind is what an entry of the mapping maps.
+type Kind string
+
+const (
+	KindMediaItem Kind = "mediaItem"
+	KindAlbum     Kind = "album"
+)
+
+// Entry maps a media item or album of the source library to its copy in
+// the destination library.
+type Entry struct {
+	Kind          Kind      `json:"kind"`
+	SourceID      string    `json:"sourceId"`
+	DestinationID string    `json:"destinationId"`
+	AlbumIDs      []string  `json:"albumIds,omitempty"` // of the source albums the copy was added to
+	MigratedAt    time.Time `json:"migratedAt"`
+}
+
+// InAlbum reports whether the copy was added to the copy of the source album.
+func (e Entry) InAlbum(albumID string) bool {
+	for _, id := range e.AlbumIDs {
+		if id == albumID {
+			return true
+		}
+	}
+	return false
+}
+
+// Mapping is an append-only journal of source to destination ids, one JSON
+// object per line, so a migration resumes where it stopped. Later lines
+// replace earlier lines of the same kind and source id.
+type Mapping struct {
+	mu         gosync.Mutex
+	mediaItems map[string]Entry
+	albums     map[string]Entry
+	journal    *journal.Journal[Entry]
+}
+
+// OpenMapping loads the mapping at path, creating it on the first Add. An
+// empty path keeps the mapping in memory.
+func OpenMapping(path string) (*Mapping, error) {
+	m := &Mapping{
+		mediaItems: make(map[string]Entry),
+		albums:     make(map[string]Entry),
+	}
+
+	j, err := journal.Open(path, func(entry Entry) {
+		if entries := m.entries(entry.Kind); entries != nil {
+			entries[entry.SourceID] = entry
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.journal = j
+
+	return m, nil
+}
+
+func (m *Mapping) entries(kind Kind) map[string]Entry {
+	switch kind {
+	case KindMediaItem:
+		return m.mediaItems
+	case KindAlbum:
+		return m.albums
+	default:
+		return nil
+	}
+}
+
+// MediaItem returns the entry of the source media item.
+func (m *Mapping) MediaItem(sourceID string) (Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.mediaItems[sourceID]
+	return entry, ok
+}
+
+// Album returns the entry of the source album.
+func (m *Mapping) Album(sourceID string) (Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.albums[sourceID]
+	return entry, ok
+}
+
+// Add appends the entry and syncs the mapping to disk.
+func (m *Mapping) Add(entry Entry) error {
+	entries := m.entries(entry.Kind)
+	if entries == nil {
+		return fmt.Errorf("mapping entry of unknown kind %q", entry.Kind)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.journal.Append(entry); err != nil {
+		return err
+	}
+	entries[entry.SourceID] = entry
+	return nil
+}
+
+// Len returns the number of media items and albums mapped.
+func (m *Mapping) Len() (mediaItems, albums int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.mediaItems), len(m.albums)
+}
+
+// Close closes the journal file.
+func (m *Mapping) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.journal.Close()
+}
@@ -0,0 +1,480 @@
+// Package migrate copies a library from one account to another.
+//
+// The originals of the source media items are downloaded and uploaded to
+// the destination with their filenames and descriptions. The albums are
+// then recreated with the same titles in the same order, adding the copies
+// in album order. A Mapping records the copies, so an interrupted
+// migration resumes without duplicates. The API strips the location of
+// downloaded photos and cannot copy favorites, archiving or sharing.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	gosync "sync"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+	"github.com/dlph/go-photoslibrary/upload"
+
+	"golang.org/x/exp/slog"
+)
+
+const DefaultConcurrency = 4
+
+type Config struct {
+	dryRun      bool
+	concurrency int
+	mapping     *Mapping
+	tempDir     string
+}
+
+type Option func(*Config)
+
+// WithDryRun reports the planned copies and albums without changing the
+// destination library.
+func WithDryRun() Option {
+	return func(c *Config) {
+		c.dryRun = true
+	}
+}
+
+// WithConcurrency sets the number of parallel transfers.
+func WithConcurrency(n int) Option {
+	return func(c *Config) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// WithMapping skips the media items and albums the mapping records as
+// copied and records the new copies, so a migration can be resumed.
+func WithMapping(m *Mapping) Option {
+	return func(c *Config) {
+		c.mapping = m
+	}
+}
+
+// WithTempDir sets the directory originals are downloaded to before they
+// are uploaded, os.TempDir when unset.
+func WithTempDir(dir string) Option {
+	return func(c *Config) {
+		c.tempDir = dir
+	}
+}
+
+// Result is the outcome of a single media item.
+type Result struct {
+	SourceID      string        `json:"sourceId"`
+	Filename      string        `json:"filename"`
+	DestinationID string        `json:"destinationId,omitempty"`
+	Size          int64         `json:"size,omitempty"`
+	Status        upload.Status `json:"status"`
+	Message       string        `json:"message,omitempty"`
+}
+
+// AlbumResult is the outcome of a single album. Its status is duplicate
+// when an earlier run created the album.
+type AlbumResult struct {
+	SourceID      string        `json:"sourceId"`
+	Title         string        `json:"title"`
+	DestinationID string        `json:"destinationId,omitempty"`
+	Added         int           `json:"added"` // media items added by this run
+	Status        upload.Status `json:"status"`
+	Message       string        `json:"message,omitempty"`
+}
+
+// Report summarizes a migration.
+type Report struct {
+	Created    int
+	Duplicates int // copied by an earlier run, with WithMapping
+	Failed     int
+	Bytes      int64 // of the created media items
+
+	// AlbumsCreated are the titles of the new albums.
+	AlbumsCreated []string
+	// Albums has an entry for every source album in list order.
+	Albums []AlbumResult
+	// Results has an entry for every source media item in list order,
+	// followed by the media items only found in albums, such as those of
+	// other members of shared albums.
+	Results []Result
+}
+
+type migrator struct {
+	source, destination *http.Client
+	cfg                 *Config
+
+	mu      gosync.Mutex
+	results map[string]*Result
+	order   []string
+}
+
+// Run copies the media items and albums of the source library to the
+// destination library. Failed media items and albums are listed in the
+// report, the returned error is only set when listing the source or ctx
+// fails.
+func Run(ctx context.Context, source, destination *http.Client, opts ...Option) (Report, error) {
+	cfg := &Config{
+		concurrency: DefaultConcurrency,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.mapping == nil {
+		cfg.mapping, _ = OpenMapping("") // in memory, never fails
+	}
+
+	m := &migrator{source: source, destination: destination, cfg: cfg, results: make(map[string]*Result)}
+
+	// base urls expire, items are transferred as the list is paged through
+	itemCh, errCh := mediaitems.List(ctx, source, mediaitems.ListMediaItemsRequest{PageSize: api.MaxPageSize})
+	m.copyItems(ctx, itemCh)
+	select {
+	case err := <-errCh:
+		return m.report(nil), err
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return m.report(nil), err
+	}
+
+	var sourceAlbums []albums.Album
+	albumCh, errCh := albums.List(ctx, source, albums.ListAlbumsRequest{PageSize: api.MaxPageSize})
+	for album := range albumCh {
+		sourceAlbums = append(sourceAlbums, album)
+	}
+	select {
+	case err := <-errCh:
+		return m.report(nil), err
+	default:
+	}
+
+	var albumResults []AlbumResult
+	for _, album := range sourceAlbums {
+		if ctx.Err() != nil {
+			break
+		}
+		albumResults = append(albumResults, m.copyAlbum(ctx, album))
+	}
+
+	return m.report(albumResults), ctx.Err()
+}
+
+// result returns the result of the item, false if the item was seen before.
+func (m *migrator) result(item mediaitems.MediaItem) (*Result, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.results[item.ID]; ok {
+		return nil, false
+	}
+	r := &Result{SourceID: item.ID, Filename: item.Filename}
+	m.results[item.ID] = r
+	m.order = append(m.order, item.ID)
+	return r, true
+}
+
+// copyItems copies the media items of itemCh which were not copied yet,
+// transferring concurrently and creating the copies in batches of
+// api.MaxBatchCreateSize. It returns once itemCh is closed or ctx is done.
+func (m *migrator) copyItems(ctx context.Context, itemCh <-chan mediaitems.MediaItem) {
+	type transferred struct {
+		item        mediaitems.MediaItem
+		result      *Result
+		uploadToken string
+		err         error
+	}
+
+	type pending struct {
+		item   mediaitems.MediaItem
+		result *Result
+	}
+
+	pendingCh := make(chan pending)
+	transferredCh := make(chan transferred)
+
+	var wg gosync.WaitGroup
+	for i := 0; i < m.cfg.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range pendingCh {
+				uploadToken, n, err := m.transfer(ctx, p.item)
+				p.result.Size = n
+				transferredCh <- transferred{item: p.item, result: p.result, uploadToken: uploadToken, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer func() {
+			close(pendingCh)
+			wg.Wait()
+			close(transferredCh)
+		}()
+
+		for item := range itemCh {
+			r, ok := m.result(item)
+			if !ok {
+				continue
+			}
+			if entry, ok := m.cfg.mapping.MediaItem(item.ID); ok {
+				r.Status, r.DestinationID = upload.StatusDuplicate, entry.DestinationID
+				continue
+			}
+			if m.cfg.dryRun {
+				r.Status = upload.StatusPlanned
+				continue
+			}
+
+			select {
+			case pendingCh <- pending{item: item, result: r}:
+			case <-ctx.Done():
+				r.Status, r.Message = upload.StatusSkipped, ctx.Err().Error()
+				return
+			}
+		}
+	}()
+
+	var batch []transferred
+	create := func() {
+		req := mediaitems.BatchCreateMediaItemsRequest{}
+		byToken := make(map[string]transferred, len(batch))
+		for _, t := range batch {
+			req.NewMediaItems = append(req.NewMediaItems, mediaitems.NewMediaItem{
+				Description: t.item.Description,
+				SimpleMediaItem: mediaitems.SimpleMediaItem{
+					UploadToken: t.uploadToken,
+					FileName:    t.item.Filename,
+				},
+			})
+			byToken[t.uploadToken] = t
+		}
+		batch = batch[:0]
+
+		resp, err := mediaitems.BatchCreate(ctx, m.destination, req)
+		if err != nil {
+			slog.DebugContext(ctx, "failed creating media items", "error", err)
+			for _, t := range byToken {
+				t.result.Status, t.result.Message = upload.StatusFailed, err.Error()
+			}
+			return
+		}
+
+		for _, result := range resp.NewMediaItemResults {
+			t, ok := byToken[result.UploadToken]
+			if !ok {
+				continue
+			}
+			delete(byToken, result.UploadToken)
+
+			if !result.Succeeded() {
+				t.result.Status, t.result.Message = upload.StatusFailed, result.Status.Message
+				continue
+			}
+
+			t.result.Status, t.result.DestinationID = upload.StatusCreated, result.MediaItem.ID
+			if err := m.cfg.mapping.Add(Entry{
+				Kind:          KindMediaItem,
+				SourceID:      t.item.ID,
+				DestinationID: result.MediaItem.ID,
+				MigratedAt:    time.Now().UTC(),
+			}); err != nil {
+				t.result.Message = "not recorded in mapping: " + err.Error()
+			}
+		}
+		for _, t := range byToken {
+			t.result.Status, t.result.Message = upload.StatusFailed, "missing from batch create response"
+		}
+	}
+
+	for t := range transferredCh {
+		if t.err != nil {
+			t.result.Status, t.result.Message = upload.StatusFailed, t.err.Error()
+			continue
+		}
+
+		batch = append(batch, t)
+		if len(batch) == api.MaxBatchCreateSize {
+			create()
+		}
+	}
+	switch {
+	case len(batch) == 0:
+	case ctx.Err() != nil:
+		for _, t := range batch {
+			t.result.Status, t.result.Message = upload.StatusFailed, ctx.Err().Error()
+		}
+	default:
+		create()
+	}
+}
+
+// transfer downloads the original of the item to a temporary file and
+// uploads it to the destination, returning the upload token and the size.
+func (m *migrator) transfer(ctx context.Context, item mediaitems.MediaItem) (string, int64, error) {
+	f, err := os.CreateTemp(m.cfg.tempDir, "gphotos-migrate-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	n, err := mediaitems.Download(ctx, m.source, item, f)
+	if err != nil {
+		return "", n, fmt.Errorf("download: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", n, err
+	}
+
+	uploadToken, err := mediaitems.Upload(ctx, m.destination, mediaitems.UploadRequest{
+		Filename: item.Filename,
+		MimeType: item.MimeType,
+		Content:  f,
+	})
+	if err == nil && uploadToken == "" {
+		err = errors.New("empty upload token")
+	}
+	if err != nil {
+		return "", n, fmt.Errorf("upload: %w", err)
+	}
+	return uploadToken, n, nil
+}
+
+// copyAlbum copies the members of the album missing from the library,
+// creates the album unless an earlier run did and adds the copies of its
+// members in album order. Copies added by an earlier run are not added
+// again, members copied since follow them.
+func (m *migrator) copyAlbum(ctx context.Context, album albums.Album) AlbumResult {
+	r := AlbumResult{SourceID: album.ID, Title: album.Title}
+
+	var members []mediaitems.MediaItem
+	itemCh, errCh := mediaitems.Search(ctx, m.source, mediaitems.SearchMediaItemRequest{AlbumID: album.ID, PageSize: api.MaxPageSize})
+	for item := range itemCh {
+		members = append(members, item)
+	}
+	select {
+	case err := <-errCh:
+		r.Status, r.Message = upload.StatusFailed, err.Error()
+		return r
+	default:
+	}
+
+	missingCh := make(chan mediaitems.MediaItem, len(members))
+	for _, item := range members {
+		missingCh <- item // copyItems skips the items seen before
+	}
+	close(missingCh)
+	m.copyItems(ctx, missingCh)
+	if ctx.Err() != nil {
+		r.Status, r.Message = upload.StatusFailed, ctx.Err().Error()
+		return r
+	}
+
+	if entry, ok := m.cfg.mapping.Album(album.ID); ok {
+		r.Status, r.DestinationID = upload.StatusDuplicate, entry.DestinationID
+	} else {
+		if m.cfg.dryRun {
+			r.Status = upload.StatusPlanned
+			return r
+		}
+
+		created, err := albums.Create(ctx, m.destination, albums.CreateAlbumRequest{Album: albums.Album{Title: album.Title}})
+		if err != nil {
+			r.Status, r.Message = upload.StatusFailed, err.Error()
+			return r
+		}
+		slog.DebugContext(ctx, "created album", "title", album.Title, "id", created.ID)
+		r.Status, r.DestinationID = upload.StatusCreated, created.ID
+
+		if err := m.cfg.mapping.Add(Entry{
+			Kind:          KindAlbum,
+			SourceID:      album.ID,
+			DestinationID: created.ID,
+			MigratedAt:    time.Now().UTC(),
+		}); err != nil {
+			r.Message = "not recorded in mapping: " + err.Error()
+		}
+	}
+	if m.cfg.dryRun {
+		return r
+	}
+
+	var entries []Entry
+	for _, item := range members {
+		if entry, ok := m.cfg.mapping.MediaItem(item.ID); ok && !entry.InAlbum(album.ID) {
+			entries = append(entries, entry)
+		}
+	}
+
+	for start := 0; start < len(entries); start += api.MaxBatchAddMediaItemsSize {
+		end := start + api.MaxBatchAddMediaItemsSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		ids := make([]string, 0, end-start)
+		for _, entry := range entries[start:end] {
+			ids = append(ids, entry.DestinationID)
+		}
+		if err := albums.BatchAddMediaItems(ctx, m.destination, albums.BatchAddMediaItemsRequest{
+			AlbumID:      r.DestinationID,
+			MediaItemIDs: ids,
+		}); err != nil {
+			// later batches would break the album order
+			r.Status, r.Message = upload.StatusFailed, err.Error()
+			return r
+		}
+		r.Added += end - start
+
+		for _, entry := range entries[start:end] {
+			entry.AlbumIDs = append(append([]string(nil), entry.AlbumIDs...), album.ID)
+			if err := m.cfg.mapping.Add(entry); err != nil {
+				r.Message = "not recorded in mapping: " + err.Error()
+			}
+		}
+	}
+
+	return r
+}
+
+func (m *migrator) report(albumResults []AlbumResult) Report {
+	report := Report{Albums: albumResults}
+
+	for _, r := range albumResults {
+		if r.Status == upload.StatusCreated || r.Status == upload.StatusPlanned {
+			report.AlbumsCreated = append(report.AlbumsCreated, r.Title)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range m.order {
+		r := m.results[id]
+		report.Results = append(report.Results, *r)
+
+		switch r.Status {
+		case upload.StatusCreated:
+			report.Created++
+			report.Bytes += r.Size
+		case upload.StatusDuplicate:
+			report.Duplicates++
+		case upload.StatusFailed:
+			report.Failed++
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,173 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	gosync "sync"
+	"testing"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+	"github.com/dlph/go-photoslibrary/upload"
+)
+
+var _ http.RoundTripper = mockRoundTripper{}
+
+type mockRoundTripper struct {
+	roundTripperFn func(*http.Request) (*http.Response, error)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (mock mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return mock.roundTripperFn(req)
+}
+
+func respond(req *http.Request, status int, v any) *http.Response {
+	var body []byte
+	if s, ok := v.(string); ok {
+		body = []byte(s)
+	} else {
+		body, _ = json.Marshal(v)
+	}
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}
+}
+
+func sourceItem(id, description string) mediaitems.MediaItem {
+	return mediaitems.MediaItem{ID: id, Filename: id + ".jpg", MimeType: "image/jpeg", Description: description,
+		BaseURL: "https://lh3.example.com/" + id}
+}
+
+func TestRun(t *testing.T) {
+	source := &http.Client{Transport: mockRoundTripper{roundTripperFn: func(req *http.Request) (*http.Response, error) {
+		switch path := req.URL.Path; {
+		case path == "/v1/mediaItems":
+			return respond(req, http.StatusOK, mediaitems.ListMediaItemsResponse{MediaItems: []mediaitems.MediaItem{
+				sourceItem("a", "Dinner"), sourceItem("b", ""), sourceItem("broken", ""),
+			}}), nil
+		case path == "/v1/albums":
+			return respond(req, http.StatusOK, albums.ListAlbumsResponse{Albums: []albums.Album{{ID: "1", Title: "Trip"}}}), nil
+		case path == "/v1/mediaItems:search":
+			// album order differs from list order, s is of another member
+			return respond(req, http.StatusOK, mediaitems.SearchMediaItemResponse{MediaItems: []mediaitems.MediaItem{
+				sourceItem("b", ""), sourceItem("s", "Shared"), sourceItem("a", "Dinner"),
+			}}), nil
+		case path == "/broken=d":
+			return respond(req, http.StatusForbidden, ""), nil
+		case strings.HasSuffix(path, "=d"):
+			return respond(req, http.StatusOK, "bytes of "+strings.TrimSuffix(path[1:], "=d")), nil
+		}
+		t.Errorf("unexpected source request %s", req.URL)
+		return respond(req, http.StatusNotFound, ""), nil
+	}}}
+
+	var (
+		mu           gosync.Mutex
+		uploads      int
+		descriptions = make(map[string]string)
+		albumTitles  []string
+		added        []string
+	)
+	destination := &http.Client{Transport: mockRoundTripper{roundTripperFn: func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch path := req.URL.Path; path {
+		case "/v1/uploads":
+			uploads++
+			content, _ := io.ReadAll(req.Body)
+			return respond(req, http.StatusOK, "token of "+string(content)), nil
+		case "/v1/mediaItems:batchCreate":
+			var create mediaitems.BatchCreateMediaItemsRequest
+			if err := json.NewDecoder(req.Body).Decode(&create); err != nil {
+				t.Fatal(err)
+			}
+			var resp mediaitems.BatchCreateMediaItemsResponse
+			for _, item := range create.NewMediaItems {
+				id := "copy-" + strings.TrimSuffix(item.SimpleMediaItem.FileName, ".jpg")
+				descriptions[id] = item.Description
+				resp.NewMediaItemResults = append(resp.NewMediaItemResults, mediaitems.NewMediaItemResult{
+					UploadToken: item.SimpleMediaItem.UploadToken,
+					MediaItem:   mediaitems.MediaItem{ID: id},
+				})
+			}
+			return respond(req, http.StatusOK, resp), nil
+		case "/v1/albums":
+			var create albums.CreateAlbumRequest
+			if err := json.NewDecoder(req.Body).Decode(&create); err != nil {
+				t.Fatal(err)
+			}
+			albumTitles = append(albumTitles, create.Album.Title)
+			return respond(req, http.StatusOK, albums.Album{ID: "copy-1", Title: create.Album.Title}), nil
+		case "/v1/albums/copy-1:batchAddMediaItems":
+			var add albums.BatchAddMediaItemsRequest
+			if err := json.NewDecoder(req.Body).Decode(&add); err != nil {
+				t.Fatal(err)
+			}
+			added = append(added, add.MediaItemIDs...)
+			return respond(req, http.StatusOK, struct{}{}), nil
+		}
+		t.Errorf("unexpected destination request %s", req.URL)
+		return respond(req, http.StatusNotFound, ""), nil
+	}}}
+
+	ctx := context.Background()
+	name := filepath.Join(t.TempDir(), "mapping.jsonl")
+	mapping, err := OpenMapping(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(ctx, source, destination, WithMapping(mapping), WithConcurrency(2), WithTempDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 3 || report.Failed != 1 || report.Bytes != int64(len("bytes of a")*3) {
+		t.Errorf("report %+v", report)
+	}
+	if want := map[string]string{"copy-a": "Dinner", "copy-b": "", "copy-s": "Shared"}; !reflect.DeepEqual(descriptions, want) {
+		t.Errorf("created %v, want %v", descriptions, want)
+	}
+	if !reflect.DeepEqual(albumTitles, []string{"Trip"}) || !reflect.DeepEqual(added, []string{"copy-b", "copy-s", "copy-a"}) {
+		t.Errorf("created albums %v with %v", albumTitles, added)
+	}
+	if len(report.Albums) != 1 || report.Albums[0].Status != upload.StatusCreated || report.Albums[0].Added != 3 {
+		t.Errorf("album results %+v", report.Albums)
+	}
+	if err := mapping.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mapping, err = OpenMapping(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapping.Close()
+	if items, albums := mapping.Len(); items != 3 || albums != 1 {
+		t.Errorf("mapping of %d media items and %d albums", items, albums)
+	}
+	if entry, ok := mapping.MediaItem("a"); !ok || entry.DestinationID != "copy-a" || !entry.InAlbum("1") {
+		t.Errorf("mapping entry %+v", entry)
+	}
+
+	uploads, albumTitles, added = 0, nil, nil
+	report, err = Run(ctx, source, destination, WithMapping(mapping), WithTempDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Duplicates != 3 || uploads != 0 || len(albumTitles) != 0 || len(added) != 0 {
+		t.Errorf("resumed with %d uploads, albums %v, added %v: %+v", uploads, albumTitles, added, report)
+	}
+	if report.Albums[0].Status != upload.StatusDuplicate || report.Albums[0].DestinationID != "copy-1" {
+		t.Errorf("resumed album %+v", report.Albums[0])
+	}
+}
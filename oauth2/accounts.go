@@ -0,0 +1,146 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+const idTokenExtraKey = "id_token"
+
+// ErrNoAccountLabel is returned by Accounts.Add when no label was given and
+// the token carries no email, i.e. the openid and email scopes were not granted.
+var ErrNoAccountLabel = errors.New("no account label and no email in id token")
+
+// Accounts is a registry of authorized Google accounts keyed by account label.
+type Accounts struct {
+	config *oauth2.Config
+	store  TokenStore
+	opts   []Option
+}
+
+// NewAccounts returns a registry which authorizes with config, persists tokens
+// in store and passes opts to Authorize when adding accounts.
+func NewAccounts(config *oauth2.Config, store TokenStore, opts ...Option) *Accounts {
+	return &Accounts{
+		config: config,
+		store:  store,
+		opts:   opts,
+	}
+}
+
+// Add runs the consent flow and stores the resulting token under label.
+// When label is empty the email from the ID token is used instead.
+func (a *Accounts) Add(ctx context.Context, label string) (string, error) {
+	token, err := Authorize(ctx, a.config, a.opts...)
+	if err != nil {
+		return "", err
+	}
+
+	if label == "" {
+		label = Email(token)
+	}
+	if label == "" {
+		return "", ErrNoAccountLabel
+	}
+
+	return label, a.store.Save(label, token)
+}
+
+// List returns the labels of all stored accounts.
+func (a *Accounts) List() ([]string, error) {
+	return a.store.List()
+}
+
+// Token returns the stored token for the account.
+func (a *Accounts) Token(label string) (*oauth2.Token, error) {
+	return a.store.Load(label)
+}
+
+// Remove deletes the account's token from the store without revoking it.
+func (a *Accounts) Remove(label string) error {
+	return a.store.Delete(label)
+}
+
+// Client returns an http client authorized as the account. Refreshed tokens
+// are written back to the store.
+func (a *Accounts) Client(ctx context.Context, label string) (*http.Client, error) {
+	token, err := a.store.Load(label)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &storingTokenSource{
+		account: label,
+		store:   a.store,
+		src:     a.config.TokenSource(ctx, token),
+		last:    token,
+	}
+
+	return oauth2.NewClient(ctx, oauth2.ReuseTokenSource(token, src)), nil
+}
+
+// storingTokenSource saves tokens to a TokenStore whenever they change.
+type storingTokenSource struct {
+	account string
+	store   TokenStore
+	src     oauth2.TokenSource
+
+	mu   sync.Mutex
+	last *oauth2.Token
+}
+
+// Token implements oauth2.TokenSource.
+func (s *storingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.last == nil || s.last.AccessToken != token.AccessToken {
+		if err := s.store.Save(s.account, token); err != nil {
+			return nil, err
+		}
+		s.last = token
+	}
+
+	return token, nil
+}
+
+// Email returns the email claim of the token's ID token, or an empty string
+// when the token has no ID token. The ID token is received directly from the
+// token endpoint so its signature is not verified.
+func Email(token *oauth2.Token) string {
+	idToken, ok := token.Extra(idTokenExtraKey).(string)
+	if !ok {
+		return ""
+	}
+
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+
+	var claims struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+
+	return claims.Email
+}
@@ -0,0 +1,133 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestFileTokenStore(t *testing.T) {
+	store := NewFileTokenStore(t.TempDir())
+
+	if _, err := store.Load("nobody"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("error %v not expected %v", err, ErrTokenNotFound)
+	}
+
+	token := &oauth2.Token{AccessToken: "a", RefreshToken: "r", TokenType: "Bearer", Expiry: time.Now().Add(time.Hour).Round(0)}
+	for _, account := range []string{"user@example.com", "family/archive", "family-b"} {
+		if err := store.Save(account, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded, err := store.Load("family/archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.AccessToken != token.AccessToken || loaded.RefreshToken != token.RefreshToken || !loaded.Expiry.Equal(token.Expiry) {
+		t.Errorf("loaded token %+v not expected %+v", loaded, token)
+	}
+
+	accounts, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"family-b", "family/archive", "user@example.com"}; !reflect.DeepEqual(accounts, want) {
+		t.Errorf("accounts %v not expected %v", accounts, want)
+	}
+
+	if err := store.Delete("family/archive"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("family/archive"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("error %v not expected %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testServ := newTestAuthServer(t, "")
+	defer testServ.Close()
+
+	config := newTestConfig(testServ, "http://localhost")
+	store := NewMemoryTokenStore()
+
+	accounts := NewAccounts(config, store, WithEphemeralPort(), WithAuthCodeURLHandler(func(authCodeURL string) {
+		resp, err := testServ.Client().Get(authCodeURL)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+	}))
+
+	label, err := accounts.Add(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label != "user@example.com" {
+		t.Errorf("label %s not expected %s", label, "user@example.com")
+	}
+
+	if _, err := accounts.Add(ctx, "archive"); err != nil {
+		t.Fatal(err)
+	}
+
+	labels, err := accounts.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"archive", "user@example.com"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("labels %v not expected %v", labels, want)
+	}
+
+	client, err := accounts.Client(ctx, "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport, ok := client.Transport.(*oauth2.Transport)
+	if !ok {
+		t.Fatalf("transport %T not an oauth2 transport", client.Transport)
+	}
+	token, err := transport.Source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "54321" {
+		t.Errorf("access token %s not expected %s", token.AccessToken, "54321")
+	}
+
+	if _, err := accounts.Client(ctx, "missing"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("error %v not expected %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestStoringTokenSource(t *testing.T) {
+	store := NewMemoryTokenStore()
+	refreshed := &oauth2.Token{AccessToken: "new", Expiry: time.Now().Add(time.Hour)}
+
+	src := &storingTokenSource{
+		account: "a",
+		store:   store,
+		src:     oauth2.StaticTokenSource(refreshed),
+		last:    &oauth2.Token{AccessToken: "old"},
+	}
+
+	if _, err := src.Token(); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Load("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.AccessToken != "new" {
+		t.Errorf("stored access token %s not expected %s", stored.AccessToken, "new")
+	}
+}
@@ -0,0 +1,46 @@
+package oauth2
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// BrowserOpener opens a URL for the user, typically in the system browser.
+type BrowserOpener interface {
+	Open(rawURL string) error
+}
+
+// BrowserOpenerFunc adapts a function to a BrowserOpener.
+type BrowserOpenerFunc func(rawURL string) error
+
+// Open implements BrowserOpener.
+func (fn BrowserOpenerFunc) Open(rawURL string) error {
+	return fn(rawURL)
+}
+
+// SystemBrowser opens URLs with the platform's default handler:
+// xdg-open on Linux and BSDs, open on macOS and rundll32 on Windows.
+var SystemBrowser BrowserOpener = BrowserOpenerFunc(openSystemBrowser)
+
+func openSystemBrowser(rawURL string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		cmd = exec.Command("xdg-open", rawURL)
+	case "darwin":
+		cmd = exec.Command("open", rawURL)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", rawURL)
+	default:
+		return fmt.Errorf("no browser opener for %s", runtime.GOOS)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	go cmd.Wait() // reap the process without blocking the caller
+
+	return nil
+}
@@ -6,20 +6,75 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"html/template"
+	"net"
 	"net/http"
 	"net/url"
+	"time"
 
 	"golang.org/x/exp/slog"
 	"golang.org/x/oauth2"
 )
 
 const (
-	stateURLQueryKey = "state"
-	stateSize        = 10
+	stateURLQueryKey            = "state"
+	codeURLQueryKey             = "code"
+	errorURLQueryKey            = "error"
+	errorDescriptionURLQueryKey = "error_description"
+	stateSize                   = 10
+
+	// EphemeralAddress is the loopback address bound when WithEphemeralPort is used.
+	EphemeralAddress = "127.0.0.1:0"
+
+	// DefaultAuthorizationTimeout bounds how long NewClient waits for the redirect.
+	DefaultAuthorizationTimeout = 5 * time.Minute
+
+	shutdownTimeout = 5 * time.Second
+)
+
+// ErrAuthorizationTimeout is returned by NewClient when the user does not
+// complete authorization within the configured timeout.
+var ErrAuthorizationTimeout = errors.New("authorization timed out")
+
+var (
+	// DefaultSuccessTemplate is served to the user when authorization succeeds.
+	DefaultSuccessTemplate = template.Must(template.New("success").Parse(
+		`<!DOCTYPE html><html><head><title>Authenticated</title></head>` +
+			`<body><p>Authenticated Successfully. You may close this window.</p></body></html>`))
+	// DefaultFailureTemplate is served to the user when authorization fails.
+	DefaultFailureTemplate = template.Must(template.New("failure").Parse(
+		`<!DOCTYPE html><html><head><title>Authentication Failed</title></head>` +
+			`<body><p>Authentication Failed: {{.Error}}</p>` +
+			`{{if .ErrorDescription}}<p>{{.ErrorDescription}}</p>{{end}}</body></html>`))
 )
 
+// AuthorizationError is returned when the authorization server redirects
+// back with an error instead of a code, e.g. when the user denies access.
+type AuthorizationError struct {
+	Code        string
+	Description string
+}
+
+func (e *AuthorizationError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("authorization failed: %s", e.Code)
+	}
+	return fmt.Sprintf("authorization failed: %s: %s", e.Code, e.Description)
+}
+
+// TemplateData is passed to the success and failure templates.
+type TemplateData struct {
+	Error            string
+	ErrorDescription string
+}
+
 type Config struct {
 	authCodeURLHandlerFn func(authCodeURL string)
+	ephemeralPort        bool
+	authorizationTimeout time.Duration
+	successTemplate      *template.Template
+	failureTemplate      *template.Template
+	authCodeOptions      []oauth2.AuthCodeOption
 }
 
 type Option func(*Config)
@@ -30,6 +85,56 @@ func WithAuthCodeURLHandler(fn func(authCodeURL string)) Option {
 	}
 }
 
+// WithEphemeralPort binds the redirect server to 127.0.0.1:0 instead of the
+// host in config.RedirectURL and rewrites the redirect URI with the chosen port.
+func WithEphemeralPort() Option {
+	return func(c *Config) {
+		c.ephemeralPort = true
+	}
+}
+
+// WithAuthorizationTimeout sets how long NewClient waits for the user to
+// complete authorization. A zero or negative duration waits until ctx is done.
+func WithAuthorizationTimeout(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.authorizationTimeout = timeout
+	}
+}
+
+// WithBrowser opens the auth code URL with the given opener, falling back to
+// PrintAuthCodeURLHandler when the opener fails.
+func WithBrowser(opener BrowserOpener) Option {
+	return func(c *Config) {
+		c.authCodeURLHandlerFn = func(authCodeURL string) {
+			if err := opener.Open(authCodeURL); err != nil {
+				slog.Debug("failed opening browser", "error", err)
+				PrintAuthCodeURLHandler(authCodeURL)
+			}
+		}
+	}
+}
+
+// WithAuthCodeOptions adds parameters to the auth code URL.
+func WithAuthCodeOptions(opts ...oauth2.AuthCodeOption) Option {
+	return func(c *Config) {
+		c.authCodeOptions = append(c.authCodeOptions, opts...)
+	}
+}
+
+// WithSuccessTemplate sets the page served to the user after a successful redirect.
+func WithSuccessTemplate(tmpl *template.Template) Option {
+	return func(c *Config) {
+		c.successTemplate = tmpl
+	}
+}
+
+// WithFailureTemplate sets the page served to the user after a failed redirect.
+func WithFailureTemplate(tmpl *template.Template) Option {
+	return func(c *Config) {
+		c.failureTemplate = tmpl
+	}
+}
+
 // NewClient creates a new http client which handles authorization/authentication
 // Your credentials should be obtained from the Google
 // Developer Console (https://console.developers.google.com).
@@ -37,8 +142,23 @@ func WithAuthCodeURLHandler(fn func(authCodeURL string)) Option {
 // Redirect user to Google's consent page to ask for permission
 // for the scopes specified above.
 func NewClient(ctx context.Context, config *oauth2.Config, opts ...Option) (*http.Client, error) {
+	token, err := Authorize(ctx, config, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// return authenticated client with auto-refreshing token
+	return config.Client(ctx, token), nil
+}
+
+// Authorize runs the same consent flow as NewClient and returns the token
+// itself, e.g. for persisting it in a TokenStore.
+func Authorize(ctx context.Context, config *oauth2.Config, opts ...Option) (*oauth2.Token, error) {
 	cfg := &Config{
 		authCodeURLHandlerFn: PrintAuthCodeURLHandler,
+		successTemplate:      DefaultSuccessTemplate,
+		failureTemplate:      DefaultFailureTemplate,
+		authorizationTimeout: DefaultAuthorizationTimeout,
 	}
 
 	for _, opt := range opts {
@@ -58,49 +178,125 @@ func NewClient(ctx context.Context, config *oauth2.Config, opts ...Option) (*htt
 		return nil, err
 	}
 
-	var codeCh = make(chan string)
+	address := redirectURL.Host
+	if cfg.ephemeralPort {
+		address = EphemeralAddress
+	}
 
-	server := listenAndServerRedirect(redirectURL, codeCh)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
 
-	authURL := config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+	if cfg.ephemeralPort {
+		redirectURL.Host = listener.Addr().String()
+
+		// copy the config so the caller's RedirectURL is left untouched
+		c := *config
+		c.RedirectURL = redirectURL.String()
+		config = &c
+	}
+
+	var resultCh = make(chan redirectResult, 1)
+
+	server := serveRedirect(listener, redirectURL, state, cfg, resultCh)
+
+	authCodeOptions := append([]oauth2.AuthCodeOption{oauth2.S256ChallengeOption(verifier)}, cfg.authCodeOptions...)
+	authURL := config.AuthCodeURL(state, authCodeOptions...)
 	go cfg.authCodeURLHandlerFn(authURL) // run in background in case it blocks
 
-	code := <-codeCh // block until code is read
-	if err := server.Shutdown(ctx); err != nil {
-		return nil, err
+	result := waitForRedirect(ctx, cfg.authorizationTimeout, resultCh)
+
+	// ctx may already be done, give the server its own deadline to drain
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+		if result.err == nil {
+			return nil, err
+		}
+	}
+	if result.err != nil {
+		return nil, result.err
 	}
 
 	// Handle the exchange code to initiate a transport.
-	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
-	if err != nil {
-		return nil, err
+	return config.Exchange(ctx, result.code, oauth2.VerifierOption(verifier))
+}
+
+type redirectResult struct {
+	code string
+	err  error
+}
+
+// waitForRedirect blocks until the redirect is received, ctx is done or the timeout elapses.
+func waitForRedirect(ctx context.Context, timeout time.Duration, resultCh <-chan redirectResult) redirectResult {
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
 	}
 
-	// return authenticated client with auto-refreshing token
-	return config.Client(ctx, token), nil
+	select {
+	case result := <-resultCh:
+		return result
+	case <-ctx.Done():
+		slog.DebugContext(ctx, "authorization context done")
+		return redirectResult{err: ctx.Err()}
+	case <-timeoutCh:
+		slog.DebugContext(ctx, "authorization timed out", "timeout", timeout)
+		return redirectResult{err: ErrAuthorizationTimeout}
+	}
 }
 
-func listenAndServerRedirect(redirectURL *url.URL, codeCh chan<- string) *http.Server {
+func serveRedirect(listener net.Listener, redirectURL *url.URL, state string, cfg *Config, resultCh chan<- redirectResult) *http.Server {
+	redirectPath := redirectURL.Path
+	if redirectPath == "" {
+		redirectPath = "/"
+	}
+
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != redirectPath {
+			http.NotFound(w, r) // e.g. favicon requests from the browser
+			return
+		}
+
 		query := r.URL.Query()
-		state := query.Get(stateURLQueryKey)
-		if state != string(state) {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("invalid state"))
+		if query.Get(stateURLQueryKey) != state {
+			renderTemplate(w, http.StatusUnauthorized, cfg.failureTemplate, TemplateData{Error: "invalid state"})
 			return
 		}
-		codeCh <- query.Get("code")
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Authenticated Successfully"))
+		var result redirectResult
+		if code := query.Get(errorURLQueryKey); code != "" {
+			result.err = &AuthorizationError{Code: code, Description: query.Get(errorDescriptionURLQueryKey)}
+		} else {
+			result.code = query.Get(codeURLQueryKey)
+		}
+
+		select {
+		case resultCh <- result:
+		default: // already received a redirect
+		}
+
+		if result.err != nil {
+			renderTemplate(w, http.StatusUnauthorized, cfg.failureTemplate, TemplateData{
+				Error:            query.Get(errorURLQueryKey),
+				ErrorDescription: query.Get(errorDescriptionURLQueryKey),
+			})
+			return
+		}
+
+		renderTemplate(w, http.StatusOK, cfg.successTemplate, TemplateData{})
 	})
 
-	server := &http.Server{Addr: redirectURL.Host, Handler: handler}
+	server := &http.Server{Addr: listener.Addr().String(), Handler: handler}
 
 	go func(server *http.Server) {
 		slog.Debug("starting redirect server", "address", server.Addr)
 
-		if err := server.ListenAndServe(); err != nil {
+		if err := server.Serve(listener); err != nil {
 			if errors.Is(err, http.ErrServerClosed) {
 				return // graceful shutdown
 			}
@@ -111,6 +307,14 @@ func listenAndServerRedirect(redirectURL *url.URL, codeCh chan<- string) *http.S
 	return server
 }
 
+func renderTemplate(w http.ResponseWriter, statusCode int, tmpl *template.Template, data TemplateData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
+	if err := tmpl.Execute(w, data); err != nil {
+		slog.Debug("failed executing redirect template", "template", tmpl.Name(), "error", err)
+	}
+}
+
 func PrintAuthCodeURLHandler(authCodeURL string) {
 	fmt.Printf("Visit the URL for the auth dialog: %v\n", authCodeURL)
 }
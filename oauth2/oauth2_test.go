@@ -3,13 +3,16 @@ package oauth2
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"mime"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -78,12 +81,12 @@ func TestAuth(t *testing.T) {
 		ClientID:     "<YOUR_CLIENT_ID>.apps.googleusercontent.com",
 		ClientSecret: "<YOUR_CLIENT_SECRET>",
 		RedirectURL:  redirectURL,
-		Scopes: []string{
-			"https://www.googleapis.com/auth/photoslibrary.readonly",
-			"https://www.googleapis.com/auth/photoslibrary.appendonly",
-			"https://www.googleapis.com/auth/photoslibrary.readonly.appcreateddata",
-			"https://www.googleapis.com/auth/photoslibrary.edit.appcreateddata",
-		},
+		Scopes: Scopes(
+			ScopePhotosLibraryReadonly,
+			ScopePhotosLibraryAppendOnly,
+			ScopePhotosLibraryReadonlyAppCreatedData,
+			ScopePhotosLibraryEditAppCreatedData,
+		),
 		Endpoint: oauth2.Endpoint{
 			AuthURL:       fmt.Sprintf("%s/o/oauth2/auth", testServ.URL),
 			TokenURL:      fmt.Sprintf("%s/token", testServ.URL),
@@ -108,3 +111,179 @@ func TestAuth(t *testing.T) {
 		t.Fatal("nil client")
 	}
 }
+
+// testIDToken is an unsigned JWT with the email claim user@example.com.
+const testIDToken = "eyJhbGciOiJub25lIn0.eyJlbWFpbCI6InVzZXJAZXhhbXBsZS5jb20ifQ.c2ln"
+
+func newTestAuthServer(t *testing.T, authErr string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/o/oauth2/auth", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := make(url.Values)
+		if authErr != "" {
+			q.Add("error", authErr)
+		} else {
+			q.Add("code", "12345")
+		}
+		q.Add("state", r.URL.Query().Get("state"))
+
+		redirectURL, err := url.Parse(r.URL.Query().Get("redirect_uri"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		redirectURL.RawQuery = q.Encode()
+
+		http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+	}))
+	mux.Handle("/token", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "54321",
+			"token_type":    "Bearer",
+			"refresh_token": "r54321",
+			"expires_in":    5 * 60 * 60,
+			"id_token":      testIDToken,
+		})
+	}))
+
+	return httptest.NewServer(mux)
+}
+
+func newTestConfig(testServ *httptest.Server, redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     "<YOUR_CLIENT_ID>.apps.googleusercontent.com",
+		ClientSecret: "<YOUR_CLIENT_SECRET>",
+		RedirectURL:  redirectURL,
+		Scopes:       Scopes(ScopePhotosLibraryReadonly),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   fmt.Sprintf("%s/o/oauth2/auth", testServ.URL),
+			TokenURL:  fmt.Sprintf("%s/token", testServ.URL),
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+func TestAuthEphemeralPort(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testServ := newTestAuthServer(t, "")
+	defer testServ.Close()
+
+	config := newTestConfig(testServ, "http://localhost:1/callback")
+
+	bodyCh := make(chan string, 1)
+	opener := BrowserOpenerFunc(func(authCodeURL string) error {
+		authURL, err := url.Parse(authCodeURL)
+		if err != nil {
+			return err
+		}
+		redirectURI, err := url.Parse(authURL.Query().Get("redirect_uri"))
+		if err != nil {
+			return err
+		}
+		if redirectURI.Hostname() != "127.0.0.1" || redirectURI.Port() == "0" || redirectURI.Path != "/callback" {
+			t.Errorf("unexpected redirect_uri %s", redirectURI)
+		}
+
+		resp, err := testServ.Client().Get(authCodeURL)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		bodyCh <- string(b)
+		return err
+	})
+
+	client, err := NewClient(ctx, config, WithEphemeralPort(), WithBrowser(opener))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client == nil {
+		t.Fatal("nil client")
+	}
+	if config.RedirectURL != "http://localhost:1/callback" {
+		t.Errorf("caller config modified, redirect url %s", config.RedirectURL)
+	}
+	if body := <-bodyCh; !strings.Contains(body, "Authenticated Successfully") {
+		t.Errorf("unexpected success page %q", body)
+	}
+}
+
+func TestAuthDenied(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testServ := newTestAuthServer(t, "access_denied")
+	defer testServ.Close()
+
+	config := newTestConfig(testServ, "http://localhost")
+
+	failure := template.Must(template.New("failure").Parse("denied: {{.Error}}"))
+
+	bodyCh := make(chan string, 1)
+	_, err := NewClient(ctx, config, WithEphemeralPort(), WithFailureTemplate(failure), WithAuthCodeURLHandler(func(authCodeURL string) {
+		resp, err := testServ.Client().Get(authCodeURL)
+		if err != nil {
+			t.Error(err)
+			bodyCh <- ""
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		bodyCh <- string(b)
+	}))
+
+	var authErr *AuthorizationError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("error %v not an AuthorizationError", err)
+	}
+	if authErr.Code != "access_denied" {
+		t.Errorf("error code %s not expected %s", authErr.Code, "access_denied")
+	}
+
+	if body := <-bodyCh; body != "denied: access_denied" {
+		t.Errorf("unexpected failure page %q", body)
+	}
+}
+
+func TestAuthTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testServ := newTestAuthServer(t, "")
+	defer testServ.Close()
+
+	config := newTestConfig(testServ, "http://localhost")
+
+	redirectCh := make(chan string, 1)
+	_, err := NewClient(ctx, config, WithEphemeralPort(), WithAuthorizationTimeout(50*time.Millisecond), WithAuthCodeURLHandler(func(authCodeURL string) {
+		authURL, _ := url.Parse(authCodeURL)
+		redirectCh <- authURL.Query().Get("redirect_uri") // user never completes authorization
+	}))
+	if !errors.Is(err, ErrAuthorizationTimeout) {
+		t.Fatalf("error %v not expected %v", err, ErrAuthorizationTimeout)
+	}
+
+	if _, err := http.Get(<-redirectCh); err == nil {
+		t.Error("redirect server still running after timeout")
+	}
+}
+
+func TestAuthCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testServ := newTestAuthServer(t, "")
+	defer testServ.Close()
+
+	config := newTestConfig(testServ, "http://localhost")
+
+	_, err := NewClient(ctx, config, WithEphemeralPort(), WithAuthCodeURLHandler(func(authCodeURL string) {
+		cancel() // user closed the browser tab and the caller gave up
+	}))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error %v not expected %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,125 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/exp/slog"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DefaultRevokeURL is Google's token revocation endpoint.
+	// https://developers.google.com/identity/protocols/oauth2/native-app#tokenrevoke
+	DefaultRevokeURL = "https://oauth2.googleapis.com/revoke"
+
+	tokenFormKey        = "token"
+	invalidTokenError   = "invalid_token"
+	maxRevokeBodyLength = 1 << 16
+)
+
+// ErrNoTokenToRevoke is returned by Revoke when the token has neither a refresh nor an access token.
+var ErrNoTokenToRevoke = errors.New("no token to revoke")
+
+type RevokeConfig struct {
+	revokeURL string
+	client    *http.Client
+}
+
+type RevokeOption func(*RevokeConfig)
+
+// WithRevokeURL sets the revocation endpoint, e.g. a local stand-in in tests.
+func WithRevokeURL(revokeURL string) RevokeOption {
+	return func(c *RevokeConfig) {
+		c.revokeURL = revokeURL
+	}
+}
+
+// WithRevokeHTTPClient sets the client used to call the revocation endpoint.
+func WithRevokeHTTPClient(client *http.Client) RevokeOption {
+	return func(c *RevokeConfig) {
+		c.client = client
+	}
+}
+
+// Revoke revokes the grant behind token, preferring the refresh token so the
+// whole grant is removed. alreadyInvalid reports whether the endpoint rejected
+// the token as already revoked or expired, which is not treated as an error.
+func Revoke(ctx context.Context, token *oauth2.Token, opts ...RevokeOption) (alreadyInvalid bool, err error) {
+	cfg := &RevokeConfig{
+		revokeURL: DefaultRevokeURL,
+		client:    http.DefaultClient,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	value := token.RefreshToken
+	if value == "" {
+		value = token.AccessToken
+	}
+	if value == "" {
+		return false, ErrNoTokenToRevoke
+	}
+
+	form := url.Values{tokenFormKey: []string{value}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.revokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := cfg.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return false, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRevokeBodyLength))
+	if err != nil {
+		return false, err
+	}
+
+	var revokeErr struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &revokeErr); err == nil && revokeErr.Error == invalidTokenError {
+		slog.DebugContext(ctx, "token already invalid", "description", revokeErr.ErrorDescription)
+		return true, nil
+	}
+
+	return false, fmt.Errorf("revoke failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// Logout revokes the account's stored token and deletes it from store.
+// The token is deleted when the grant was already invalid as well.
+func Logout(ctx context.Context, store TokenStore, account string, opts ...RevokeOption) (alreadyInvalid bool, err error) {
+	token, err := store.Load(account)
+	if err != nil {
+		return false, err
+	}
+
+	alreadyInvalid, err = Revoke(ctx, token, opts...)
+	if err != nil {
+		return false, err
+	}
+
+	return alreadyInvalid, store.Delete(account)
+}
+
+// Revoke revokes the account's token and removes the account, see Logout.
+func (a *Accounts) Revoke(ctx context.Context, label string, opts ...RevokeOption) (alreadyInvalid bool, err error) {
+	return Logout(ctx, a.store, label, opts...)
+}
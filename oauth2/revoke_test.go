@@ -0,0 +1,96 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func newTestRevokeServer(t *testing.T, valid map[string]bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method %s not expected %s", r.Method, http.MethodPost)
+		}
+
+		token := r.FormValue("token")
+		if !valid[token] {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_token","error_description":"Token expired or revoked"}`))
+			return
+		}
+		delete(valid, token)
+	}))
+}
+
+func TestRevoke(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	revokeServ := newTestRevokeServer(t, map[string]bool{"r1": true})
+	defer revokeServ.Close()
+
+	token := &oauth2.Token{AccessToken: "a1", RefreshToken: "r1"}
+
+	alreadyInvalid, err := Revoke(ctx, token, WithRevokeURL(revokeServ.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alreadyInvalid {
+		t.Error("valid token reported already invalid")
+	}
+
+	alreadyInvalid, err = Revoke(ctx, token, WithRevokeURL(revokeServ.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !alreadyInvalid {
+		t.Error("revoked token not reported already invalid")
+	}
+
+	if _, err := Revoke(ctx, &oauth2.Token{}, WithRevokeURL(revokeServ.URL)); !errors.Is(err, ErrNoTokenToRevoke) {
+		t.Errorf("error %v not expected %v", err, ErrNoTokenToRevoke)
+	}
+}
+
+func TestRevokeServerError(t *testing.T) {
+	revokeServ := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer revokeServ.Close()
+
+	if _, err := Revoke(context.Background(), &oauth2.Token{AccessToken: "a1"}, WithRevokeURL(revokeServ.URL)); err == nil {
+		t.Error("expected error from unavailable revoke endpoint")
+	}
+}
+
+func TestAccountsRevoke(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	revokeServ := newTestRevokeServer(t, map[string]bool{"a2": true})
+	defer revokeServ.Close()
+
+	store := NewMemoryTokenStore()
+	store.Save("valid", &oauth2.Token{AccessToken: "a2"})
+	store.Save("stale", &oauth2.Token{AccessToken: "a3"})
+
+	accounts := NewAccounts(&oauth2.Config{}, store)
+
+	for account, wantInvalid := range map[string]bool{"valid": false, "stale": true} {
+		alreadyInvalid, err := accounts.Revoke(ctx, account, WithRevokeURL(revokeServ.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alreadyInvalid != wantInvalid {
+			t.Errorf("account %s already invalid %t not expected %t", account, alreadyInvalid, wantInvalid)
+		}
+		if _, err := store.Load(account); !errors.Is(err, ErrTokenNotFound) {
+			t.Errorf("account %s token not deleted, error %v", account, err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/dlph/go-photoslibrary/api"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	scopeExtraKey                  = "scope"
+	includeGrantedScopesAuthURLKey = "include_granted_scopes"
+)
+
+// Scope is an OAuth 2.0 scope.
+// https://developers.google.com/photos/library/guides/authorization
+type Scope string
+
+const (
+	// ScopePhotosLibrary grants access to all Photos Library scopes but sharing.
+	ScopePhotosLibrary                       Scope = "https://www.googleapis.com/auth/photoslibrary"
+	ScopePhotosLibraryReadonly               Scope = "https://www.googleapis.com/auth/photoslibrary.readonly"
+	ScopePhotosLibraryAppendOnly             Scope = "https://www.googleapis.com/auth/photoslibrary.appendonly"
+	ScopePhotosLibraryReadonlyAppCreatedData Scope = "https://www.googleapis.com/auth/photoslibrary.readonly.appcreateddata"
+	ScopePhotosLibraryEditAppCreatedData     Scope = "https://www.googleapis.com/auth/photoslibrary.edit.appcreateddata"
+	ScopePhotosLibrarySharing                Scope = "https://www.googleapis.com/auth/photoslibrary.sharing"
+
+	// ScopeOpenID and ScopeEmail add an ID token with the account email, see Accounts.Add.
+	ScopeOpenID Scope = "openid"
+	ScopeEmail  Scope = "email"
+
+	scopeUserInfoEmail Scope = "https://www.googleapis.com/auth/userinfo.email"
+)
+
+// impliedScopes lists the scopes covered by a broader granted scope.
+var impliedScopes = map[Scope][]Scope{
+	ScopePhotosLibrary: {
+		ScopePhotosLibraryReadonly,
+		ScopePhotosLibraryAppendOnly,
+		ScopePhotosLibraryReadonlyAppCreatedData,
+		ScopePhotosLibraryEditAppCreatedData,
+	},
+	ScopePhotosLibraryReadonly: {ScopePhotosLibraryReadonlyAppCreatedData},
+	scopeUserInfoEmail:         {ScopeEmail},
+}
+
+// Scopes converts scopes for use in oauth2.Config.Scopes.
+func Scopes(scopes ...Scope) []string {
+	s := make([]string, len(scopes))
+	for i, scope := range scopes {
+		s[i] = string(scope)
+	}
+	return s
+}
+
+// GrantedScopes returns the scopes recorded on the token by the token endpoint,
+// or nil when the token does not carry them.
+func GrantedScopes(token *oauth2.Token) []Scope {
+	raw, ok := token.Extra(scopeExtraKey).(string)
+	if !ok {
+		return nil
+	}
+
+	fields := strings.Fields(raw)
+	scopes := make([]Scope, len(fields))
+	for i, field := range fields {
+		scopes[i] = Scope(field)
+	}
+	return scopes
+}
+
+// HasScopes reports whether the token was granted all of scopes, either
+// directly or through a broader scope.
+func HasScopes(token *oauth2.Token, scopes ...Scope) bool {
+	return len(MissingScopes(token, scopes...)) == 0
+}
+
+// MissingScopes returns the scopes which the token was not granted.
+func MissingScopes(token *oauth2.Token, scopes ...Scope) []Scope {
+	granted := make(map[Scope]bool)
+	for _, scope := range GrantedScopes(token) {
+		granted[scope] = true
+		for _, implied := range impliedScopes[scope] {
+			granted[implied] = true
+		}
+	}
+
+	var missing []Scope
+	for _, scope := range scopes {
+		if !granted[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// Upgrade runs the consent flow for additional scopes with incremental
+// authorization, returning a token covering both the previously granted
+// scopes and the new ones.
+func Upgrade(ctx context.Context, config *oauth2.Config, token *oauth2.Token, scopes []Scope, opts ...Option) (*oauth2.Token, error) {
+	c := *config
+	c.Scopes = mergeScopes(config.Scopes, Scopes(GrantedScopes(token)...), Scopes(scopes...))
+
+	opts = append(opts, WithAuthCodeOptions(oauth2.SetAuthURLParam(includeGrantedScopesAuthURLKey, "true")))
+
+	return Authorize(ctx, &c, opts...)
+}
+
+func mergeScopes(scopeLists ...[]string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, scopes := range scopeLists {
+		for _, scope := range scopes {
+			if !seen[scope] {
+				seen[scope] = true
+				merged = append(merged, scope)
+			}
+		}
+	}
+	return merged
+}
+
+// Upgrade adds scopes to the account's token through incremental authorization.
+func (a *Accounts) Upgrade(ctx context.Context, label string, scopes ...Scope) error {
+	token, err := a.store.Load(label)
+	if err != nil {
+		return err
+	}
+
+	upgraded, err := Upgrade(ctx, a.config, token, scopes, a.opts...)
+	if err != nil {
+		return err
+	}
+
+	return a.store.Save(label, upgraded)
+}
+
+// Do calls fn with the account's client. When fn fails with an insufficient
+// scope error the token is upgraded with the scopes named by the error, or
+// the configured scopes when it names none, and fn is called once more.
+func (a *Accounts) Do(ctx context.Context, label string, fn func(client *http.Client) error) error {
+	client, err := a.Client(ctx, label)
+	if err != nil {
+		return err
+	}
+
+	err = fn(client)
+
+	var apiErr *api.Error
+	if !errors.As(err, &apiErr) || !apiErr.InsufficientScope() {
+		return err
+	}
+
+	scopes := make([]Scope, 0, len(apiErr.RequiredScopes))
+	for _, scope := range apiErr.RequiredScopes {
+		scopes = append(scopes, Scope(scope))
+	}
+
+	if err := a.Upgrade(ctx, label, scopes...); err != nil {
+		return err
+	}
+
+	if client, err = a.Client(ctx, label); err != nil {
+		return err
+	}
+
+	return fn(client)
+}
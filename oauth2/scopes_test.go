@@ -0,0 +1,94 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dlph/go-photoslibrary/api"
+
+	"golang.org/x/oauth2"
+)
+
+func TestHasScopes(t *testing.T) {
+	token := (&oauth2.Token{}).WithExtra(map[string]interface{}{
+		"scope": strings.Join(Scopes(ScopePhotosLibrary, ScopeOpenID), " "),
+	})
+
+	if granted := GrantedScopes(token); !reflect.DeepEqual(granted, []Scope{ScopePhotosLibrary, ScopeOpenID}) {
+		t.Errorf("granted scopes %v not expected", granted)
+	}
+	if !HasScopes(token, ScopePhotosLibraryReadonly, ScopePhotosLibraryAppendOnly, ScopeOpenID) {
+		t.Error("scopes implied by photoslibrary not granted")
+	}
+	if missing := MissingScopes(token, ScopePhotosLibrarySharing, ScopePhotosLibraryReadonly); !reflect.DeepEqual(missing, []Scope{ScopePhotosLibrarySharing}) {
+		t.Errorf("missing scopes %v not expected %v", missing, []Scope{ScopePhotosLibrarySharing})
+	}
+	if HasScopes(&oauth2.Token{}, ScopePhotosLibraryReadonly) {
+		t.Error("token without scope extra has scopes")
+	}
+}
+
+func TestAccountsDoUpgrade(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testServ := newTestAuthServer(t, "")
+	defer testServ.Close()
+
+	config := newTestConfig(testServ, "http://localhost")
+	store := NewMemoryTokenStore()
+	store.Save("a", (&oauth2.Token{AccessToken: "old"}).WithExtra(map[string]interface{}{
+		"scope": string(ScopePhotosLibraryReadonly),
+	}))
+
+	authURLCh := make(chan *url.URL, 1)
+	accounts := NewAccounts(config, store, WithEphemeralPort(), WithAuthCodeURLHandler(func(authCodeURL string) {
+		authURL, _ := url.Parse(authCodeURL)
+		authURLCh <- authURL
+		resp, err := testServ.Client().Get(authCodeURL)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+	}))
+
+	calls := 0
+	err := accounts.Do(ctx, "a", func(client *http.Client) error {
+		calls++
+		if calls == 1 {
+			return &api.Error{
+				StatusCode:     http.StatusForbidden,
+				Status:         "PERMISSION_DENIED",
+				RequiredScopes: Scopes(ScopePhotosLibraryAppendOnly),
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("calls %d not expected %d", calls, 2)
+	}
+
+	query := (<-authURLCh).Query()
+	if query.Get("include_granted_scopes") != "true" {
+		t.Errorf("include_granted_scopes %q not expected %q", query.Get("include_granted_scopes"), "true")
+	}
+	if want := strings.Join(Scopes(ScopePhotosLibraryReadonly, ScopePhotosLibraryAppendOnly), " "); query.Get("scope") != want {
+		t.Errorf("scope %q not expected %q", query.Get("scope"), want)
+	}
+
+	token, err := store.Load("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "54321" {
+		t.Errorf("access token %s not expected %s", token.AccessToken, "54321")
+	}
+}
@@ -0,0 +1,210 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+const tokenFileExt = ".json"
+
+// storedToken keeps the token extras used by GrantedScopes and Email, which
+// oauth2.Token does not marshal.
+type storedToken struct {
+	*oauth2.Token
+	Scope   string `json:"scope,omitempty"`
+	IDToken string `json:"id_token,omitempty"`
+}
+
+// ErrTokenNotFound is returned by a TokenStore when no token is stored for an account.
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenStore persists one token per account.
+type TokenStore interface {
+	Load(account string) (*oauth2.Token, error)
+	Save(account string, token *oauth2.Token) error
+	Delete(account string) error
+	List() ([]string, error)
+}
+
+var _ TokenStore = (*FileTokenStore)(nil)
+
+// FileTokenStore stores each account's token as a JSON file in a directory.
+type FileTokenStore struct {
+	dir string
+}
+
+// NewFileTokenStore returns a FileTokenStore rooted at dir, which is created on first Save.
+func NewFileTokenStore(dir string) *FileTokenStore {
+	return &FileTokenStore{dir: dir}
+}
+
+func (s *FileTokenStore) path(account string) string {
+	return filepath.Join(s.dir, url.PathEscape(account)+tokenFileExt)
+}
+
+// Load implements TokenStore.
+func (s *FileTokenStore) Load(account string) (*oauth2.Token, error) {
+	data, err := os.ReadFile(s.path(account))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stored := storedToken{Token: new(oauth2.Token)}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+
+	extra := make(map[string]interface{})
+	if stored.Scope != "" {
+		extra[scopeExtraKey] = stored.Scope
+	}
+	if stored.IDToken != "" {
+		extra[idTokenExtraKey] = stored.IDToken
+	}
+
+	return stored.Token.WithExtra(extra), nil
+}
+
+// Save implements TokenStore.
+func (s *FileTokenStore) Save(account string, token *oauth2.Token) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+
+	stored := storedToken{Token: token}
+	stored.Scope, _ = token.Extra(scopeExtraKey).(string)
+	stored.IDToken, _ = token.Extra(idTokenExtraKey).(string)
+
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+
+	// write then rename so a crash never leaves a truncated token behind
+	tmp, err := os.CreateTemp(s.dir, ".token-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(account))
+}
+
+// Delete implements TokenStore.
+func (s *FileTokenStore) Delete(account string) error {
+	err := os.Remove(s.path(account))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrTokenNotFound
+	}
+	return err
+}
+
+// List implements TokenStore.
+func (s *FileTokenStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, tokenFileExt) {
+			continue
+		}
+
+		account, err := url.PathUnescape(strings.TrimSuffix(name, tokenFileExt))
+		if err != nil {
+			continue // not written by us
+		}
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts) // escaped names sort differently
+
+	return accounts, nil
+}
+
+var _ TokenStore = (*MemoryTokenStore)(nil)
+
+// MemoryTokenStore keeps tokens in memory, useful for tests and short lived tools.
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]oauth2.Token
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[string]oauth2.Token)}
+}
+
+// Load implements TokenStore.
+func (s *MemoryTokenStore) Load(account string) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[account]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+
+	return &token, nil
+}
+
+// Save implements TokenStore.
+func (s *MemoryTokenStore) Save(account string, token *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[account] = *token
+
+	return nil
+}
+
+// Delete implements TokenStore.
+func (s *MemoryTokenStore) Delete(account string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[account]; !ok {
+		return ErrTokenNotFound
+	}
+	delete(s.tokens, account)
+
+	return nil
+}
+
+// List implements TokenStore.
+func (s *MemoryTokenStore) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accounts := make([]string, 0, len(s.tokens))
+	for account := range s.tokens {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+
+	return accounts, nil
+}
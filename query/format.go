@@ -0,0 +1,157 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+// Format returns the canonical query of a search request, which Parse
+// turns back into the same request. Paging is not part of queries.
+// Requests the language cannot express, such as several date ranges,
+// are an error.
+func Format(req mediaitems.SearchMediaItemRequest) (string, error) {
+	var terms []string
+
+	if req.AlbumID != "" {
+		terms = append(terms, "album:"+req.AlbumID)
+	}
+
+	if f := req.Filters; f != nil {
+		if mt := f.MediaTypeFilter; mt != nil && len(mt.MediaTypes) > 0 {
+			if len(mt.MediaTypes) > 1 {
+				return "", errors.New("more than one media type")
+			}
+			name, err := mediaTypeName(mt.MediaTypes[0])
+			if err != nil {
+				return "", err
+			}
+			terms = append(terms, "type:"+name)
+		}
+
+		if cf := f.ContentFilter; cf != nil && len(cf.IncludedContentCategories)+len(cf.ExcludedContentCategories) > 0 {
+			var names []string
+			for _, c := range cf.IncludedContentCategories {
+				names = append(names, string(c))
+			}
+			for _, c := range cf.ExcludedContentCategories {
+				names = append(names, "-"+string(c))
+			}
+			terms = append(terms, "category:"+strings.Join(names, ","))
+		}
+
+		if df := f.DateFilter; df != nil {
+			for _, d := range df.Dates {
+				s, err := formatDate(d)
+				if err != nil {
+					return "", err
+				}
+				terms = append(terms, "date:"+s)
+			}
+
+			switch len(df.Ranges) {
+			case 0:
+			case 1:
+				rangeTerms, err := formatRange(df.Ranges[0])
+				if err != nil {
+					return "", err
+				}
+				terms = append(terms, rangeTerms...)
+			default:
+				return "", errors.New("more than one date range")
+			}
+		}
+
+		if ff := f.FeatureFilter; ff != nil {
+			for _, feature := range ff.IncludedFeatures {
+				switch feature {
+				case mediaitems.Favorites:
+					terms = append(terms, "favorite")
+				case mediaitems.FeatureNone:
+				default:
+					return "", fmt.Errorf("unknown feature %q", feature)
+				}
+			}
+		}
+
+		if f.IncludeArchivedMedia {
+			terms = append(terms, "archived:include")
+		}
+		if f.ExcludeNonAppCreatedData {
+			terms = append(terms, "app-only")
+		}
+	}
+
+	switch req.OrderBy {
+	case "":
+	case mediaitems.OrderByCreationTimeDesc:
+		terms = append(terms, "order:"+OrderNewest)
+	case mediaitems.OrderByCreationTime:
+		terms = append(terms, "order:"+OrderOldest)
+	default:
+		return "", fmt.Errorf("unknown order %q", req.OrderBy)
+	}
+
+	return strings.Join(terms, " "), nil
+}
+
+func mediaTypeName(mediaType mediaitems.MediaType) (string, error) {
+	for name, t := range mediaTypes {
+		if t == mediaType {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown media type %q", mediaType)
+}
+
+// formatDate formats a date with the precision of its non-zero parts.
+func formatDate(d mediaitems.Date) (string, error) {
+	switch {
+	case d.Year <= 0 || d.Year > 9999:
+		return "", fmt.Errorf("date %+v without year", d)
+	case d.Month == 0 && d.Day != 0:
+		return "", fmt.Errorf("date %+v with day but no month", d)
+	case d.Month == 0:
+		return fmt.Sprintf("%04d", d.Year), nil
+	case d.Day == 0:
+		return fmt.Sprintf("%04d-%02d", d.Year, d.Month), nil
+	default:
+		return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day), nil
+	}
+}
+
+// formatRange returns the after and before terms of a range, before names
+// the day following the end.
+func formatRange(r mediaitems.DateRange) ([]string, error) {
+	if r.StartDate.Month == 0 || r.StartDate.Day == 0 || r.EndDate.Month == 0 || r.EndDate.Day == 0 {
+		return nil, errors.New("date range with partial dates")
+	}
+
+	var terms []string
+	if r.StartDate != firstDate || r.EndDate == lastDate {
+		terms = append(terms, "after:"+shortDate(toTime(r.StartDate)))
+	}
+	if r.EndDate != lastDate {
+		terms = append(terms, "before:"+shortDate(toTime(r.EndDate).AddDate(0, 0, 1)))
+	}
+	return terms, nil
+}
+
+// shortDate formats t without the day or month when they are the first.
+func shortDate(t time.Time) string {
+	switch {
+	case t.Month() == time.January && t.Day() == 1:
+		return t.Format("2006")
+	case t.Day() == 1:
+		return t.Format("2006-01")
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+func toTime(d mediaitems.Date) time.Time {
+	return time.Date(d.Year, time.Month(d.Month), d.Day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,345 @@
+// Package query parses a compact search language into search requests.
+//
+// A query is a list of terms separated by spaces, all of which must match:
+//
+//	type:video                    photo, video or all
+//	category:PETS,-SCREENSHOTS    content categories, - excludes
+//	date:2019-06                  created on the date, year, month or day precision
+//	after:2019-06                 created at the start of the date or later
+//	before:2020                   created before the start of the date
+//	favorite                      favorites only
+//	archived:include              include archived media items
+//	app-only                      only media items created by the app
+//	album:<id>                    media items of the album, without other filters
+//	order:newest                  newest or oldest first, requires dates
+//
+// Items created on any of the dates or in the range of after and before
+// match, at most MaxDates dates can be given. Format turns a request back
+// into the canonical query.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+// Limits of the API on filters.
+const (
+	MaxDates      = 5
+	MaxCategories = 10
+)
+
+// Orders of media items.
+const (
+	OrderNewest = "newest"
+	OrderOldest = "oldest"
+)
+
+var (
+	// firstDate and lastDate bound ranges open on one side.
+	firstDate = mediaitems.Date{Year: 1, Month: 1, Day: 1}
+	lastDate  = mediaitems.Date{Year: 9999, Month: 12, Day: 31}
+)
+
+var mediaTypes = map[string]mediaitems.MediaType{
+	"all":   mediaitems.AllMedia,
+	"photo": mediaitems.PhotoType,
+	"video": mediaitems.VideoType,
+}
+
+var categories = func() map[string]mediaitems.ContentCategory {
+	m := make(map[string]mediaitems.ContentCategory)
+	for _, c := range []mediaitems.ContentCategory{
+		mediaitems.ContentNone, mediaitems.ContentLandscapes, mediaitems.ContentReceipts,
+		mediaitems.ContentCityscapes, mediaitems.ContentLandmarks, mediaitems.ContentSelfies,
+		mediaitems.ContentPeople, mediaitems.ContentPets, mediaitems.ContentWeddings,
+		mediaitems.ContentBirthdays, mediaitems.ContentDocuments, mediaitems.ContentTravel,
+		mediaitems.ContentAnimals, mediaitems.ContentFood, mediaitems.ContentSport,
+		mediaitems.ContentNight, mediaitems.ContentPerformances, mediaitems.ContentWhiteboards,
+		mediaitems.ContentScreenshots, mediaitems.ContentUtility, mediaitems.ContentArts,
+		mediaitems.ContentCrafts, mediaitems.ContentFashion, mediaitems.ContentHouses,
+		mediaitems.ContentGardens, mediaitems.ContentFlowers, mediaitems.ContentHolidays,
+	} {
+		m[string(c)] = c
+	}
+	return m
+}()
+
+// SyntaxError is a query which cannot be parsed.
+type SyntaxError struct {
+	Query  string
+	Offset int // in bytes of Query
+	Msg    string
+}
+
+// Column returns the 1-based position of the error in characters.
+func (e *SyntaxError) Column() int {
+	return utf8.RuneCountInString(e.Query[:e.Offset]) + 1
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("query column %d: %s", e.Column(), e.Msg)
+}
+
+type term struct {
+	text   string
+	offset int
+}
+
+// Parse returns the search request of the query, without page size.
+func Parse(q string) (mediaitems.SearchMediaItemRequest, error) {
+	p := &parser{query: q}
+	return p.parse()
+}
+
+type parser struct {
+	query string
+
+	req        mediaitems.SearchMediaItemRequest
+	filters    mediaitems.Filters
+	after      *term
+	before     *term
+	start, end time.Time
+	album      *term
+	order      *term
+}
+
+func (p *parser) errorf(offset int, format string, args ...any) error {
+	return &SyntaxError{Query: p.query, Offset: offset, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) parse() (mediaitems.SearchMediaItemRequest, error) {
+	for _, t := range split(p.query) {
+		if err := p.term(t); err != nil {
+			return mediaitems.SearchMediaItemRequest{}, err
+		}
+	}
+
+	if p.after != nil || p.before != nil {
+		r := mediaitems.DateRange{StartDate: firstDate, EndDate: lastDate}
+		if p.after != nil {
+			r.StartDate = mediaitems.NewDate(p.start)
+		}
+		if p.before != nil {
+			if p.after != nil && !p.start.Before(p.end) {
+				return mediaitems.SearchMediaItemRequest{}, p.errorf(p.before.offset, "before:%s is not after after:%s", value(*p.before), value(*p.after))
+			}
+			r.EndDate = mediaitems.NewDate(p.end.AddDate(0, 0, -1))
+		}
+		p.dateFilter().Ranges = append(p.dateFilter().Ranges, r)
+	}
+
+	hasFilters := p.filters != (mediaitems.Filters{})
+	if p.album != nil && hasFilters {
+		return mediaitems.SearchMediaItemRequest{}, p.errorf(p.album.offset, "album cannot be combined with filters")
+	}
+	if p.order != nil && p.filters.DateFilter == nil {
+		return mediaitems.SearchMediaItemRequest{}, p.errorf(p.order.offset, "order requires date, after or before")
+	}
+
+	if hasFilters {
+		filters := p.filters
+		p.req.Filters = &filters
+	}
+	return p.req, nil
+}
+
+func (p *parser) dateFilter() *mediaitems.DateFilter {
+	if p.filters.DateFilter == nil {
+		p.filters.DateFilter = &mediaitems.DateFilter{}
+	}
+	return p.filters.DateFilter
+}
+
+func (p *parser) term(t term) error {
+	key, val, hasValue := strings.Cut(t.text, ":")
+	valueOffset := t.offset + len(key) + 1
+	if hasValue && val == "" {
+		return p.errorf(valueOffset, "missing value of %s", key)
+	}
+
+	switch strings.ToLower(key) {
+	case "favorite", "favorites":
+		if hasValue {
+			return p.errorf(t.offset, "%s takes no value", key)
+		}
+		p.filters.FeatureFilter = &mediaitems.FeatureFilter{IncludedFeatures: []mediaitems.Feature{mediaitems.Favorites}}
+		return nil
+	case "app-only":
+		if hasValue {
+			return p.errorf(t.offset, "%s takes no value", key)
+		}
+		p.filters.ExcludeNonAppCreatedData = true
+		return nil
+	}
+
+	if !hasValue {
+		return p.errorf(t.offset, "unknown term %q", t.text)
+	}
+
+	switch strings.ToLower(key) {
+	case "type":
+		if p.filters.MediaTypeFilter != nil {
+			return p.errorf(t.offset, "type given twice")
+		}
+		mediaType, ok := mediaTypes[strings.ToLower(val)]
+		if !ok {
+			return p.errorf(valueOffset, "unknown type %q, want photo, video or all", val)
+		}
+		p.filters.MediaTypeFilter = &mediaitems.MediaTypeFilter{MediaTypes: []mediaitems.MediaType{mediaType}}
+	case "category":
+		return p.categories(val, valueOffset)
+	case "date":
+		d, err := parseDate(val)
+		if err != nil {
+			return p.errorf(valueOffset, "%v", err)
+		}
+		f := p.dateFilter()
+		if len(f.Dates) == MaxDates {
+			return p.errorf(t.offset, "more than %d dates", MaxDates)
+		}
+		f.Dates = append(f.Dates, d)
+	case "after", "before":
+		d, err := parseDate(val)
+		if err != nil {
+			return p.errorf(valueOffset, "%v", err)
+		}
+		start := time.Date(d.Year, time.Month(max(d.Month, 1)), max(d.Day, 1), 0, 0, 0, 0, time.UTC)
+		if strings.ToLower(key) == "after" {
+			if p.after != nil {
+				return p.errorf(t.offset, "after given twice")
+			}
+			p.after, p.start = &t, start
+		} else {
+			if p.before != nil {
+				return p.errorf(t.offset, "before given twice")
+			}
+			if !start.After(toTime(firstDate)) {
+				return p.errorf(valueOffset, "nothing is created before %s", val)
+			}
+			p.before, p.end = &t, start
+		}
+	case "archived":
+		if strings.ToLower(val) != "include" {
+			return p.errorf(valueOffset, "unknown archived value %q, want include", val)
+		}
+		p.filters.IncludeArchivedMedia = true
+	case "album":
+		if p.album != nil {
+			return p.errorf(t.offset, "album given twice")
+		}
+		p.album, p.req.AlbumID = &t, val
+	case "order":
+		if p.order != nil {
+			return p.errorf(t.offset, "order given twice")
+		}
+		switch strings.ToLower(val) {
+		case OrderNewest:
+			p.req.OrderBy = mediaitems.OrderByCreationTimeDesc
+		case OrderOldest:
+			p.req.OrderBy = mediaitems.OrderByCreationTime
+		default:
+			return p.errorf(valueOffset, "unknown order %q, want newest or oldest", val)
+		}
+		p.order = &t
+	default:
+		return p.errorf(t.offset, "unknown key %q", key)
+	}
+
+	return nil
+}
+
+// categories adds a comma separated list of categories, - excludes one.
+func (p *parser) categories(list string, offset int) error {
+	if p.filters.ContentFilter == nil {
+		p.filters.ContentFilter = &mediaitems.ContentFilter{}
+	}
+	f := p.filters.ContentFilter
+
+	for _, name := range strings.Split(list, ",") {
+		exclude := strings.HasPrefix(name, "-")
+		c, ok := categories[strings.ToUpper(strings.TrimPrefix(name, "-"))]
+		switch {
+		case name == "" || name == "-":
+			return p.errorf(offset, "missing category")
+		case !ok:
+			return p.errorf(offset, "unknown category %q", strings.TrimPrefix(name, "-"))
+		case exclude && len(f.ExcludedContentCategories) == MaxCategories,
+			!exclude && len(f.IncludedContentCategories) == MaxCategories:
+			return p.errorf(offset, "more than %d categories", MaxCategories)
+		case exclude:
+			f.ExcludedContentCategories = append(f.ExcludedContentCategories, c)
+		default:
+			f.IncludedContentCategories = append(f.IncludedContentCategories, c)
+		}
+		offset += len(name) + 1
+	}
+
+	return nil
+}
+
+// parseDate parses YYYY, YYYY-MM or YYYY-MM-DD, leaving the missing parts zero.
+func parseDate(s string) (mediaitems.Date, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) > 3 {
+		return mediaitems.Date{}, fmt.Errorf("invalid date %q, want YYYY, YYYY-MM or YYYY-MM-DD", s)
+	}
+
+	var fields [3]int
+	for i, part := range parts {
+		want := 2
+		if i == 0 {
+			want = 4
+		}
+		n, err := strconv.Atoi(part)
+		if len(part) != want || err != nil || n < 0 {
+			return mediaitems.Date{}, fmt.Errorf("invalid date %q, want YYYY, YYYY-MM or YYYY-MM-DD", s)
+		}
+		fields[i] = n
+	}
+
+	d := mediaitems.Date{Year: fields[0], Month: fields[1], Day: fields[2]}
+	t := time.Date(d.Year, time.Month(max(d.Month, 1)), max(d.Day, 1), 0, 0, 0, 0, time.UTC)
+	if d.Year == 0 || len(parts) > 1 && int(t.Month()) != d.Month || len(parts) > 2 && t.Day() != d.Day {
+		return mediaitems.Date{}, fmt.Errorf("invalid date %q", s)
+	}
+
+	return d, nil
+}
+
+// split returns the terms separated by white space.
+func split(q string) []term {
+	var terms []term
+	start := -1
+	for i, r := range q {
+		switch {
+		case unicode.IsSpace(r) && start >= 0:
+			terms = append(terms, term{text: q[start:i], offset: start})
+			start = -1
+		case !unicode.IsSpace(r) && start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		terms = append(terms, term{text: q[start:], offset: start})
+	}
+	return terms
+}
+
+func value(t term) string {
+	_, v, _ := strings.Cut(t.text, ":")
+	return v
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
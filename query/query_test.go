@@ -0,0 +1,108 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+func TestParse(t *testing.T) {
+	req, err := Parse("type:video category:PETS,-screenshots after:2019-06 before:2020 favorite archived:include")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := mediaitems.SearchMediaItemRequest{Filters: &mediaitems.Filters{
+		MediaTypeFilter: &mediaitems.MediaTypeFilter{MediaTypes: []mediaitems.MediaType{mediaitems.VideoType}},
+		ContentFilter: &mediaitems.ContentFilter{
+			IncludedContentCategories: []mediaitems.ContentCategory{mediaitems.ContentPets},
+			ExcludedContentCategories: []mediaitems.ContentCategory{mediaitems.ContentScreenshots},
+		},
+		DateFilter: &mediaitems.DateFilter{Ranges: []mediaitems.DateRange{{
+			StartDate: mediaitems.Date{Year: 2019, Month: 6, Day: 1},
+			EndDate:   mediaitems.Date{Year: 2019, Month: 12, Day: 31},
+		}}},
+		FeatureFilter:        &mediaitems.FeatureFilter{IncludedFeatures: []mediaitems.Feature{mediaitems.Favorites}},
+		IncludeArchivedMedia: true,
+	}}
+	if !reflect.DeepEqual(req, want) {
+		t.Errorf("request %+v\nwant %+v", req, want)
+	}
+
+	if req, err := Parse("  "); err != nil || req.Filters != nil {
+		t.Errorf("empty query %+v, %v", req, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tt := range []struct {
+		query  string
+		column int
+	}{
+		{"type:audio", 6},
+		{"favorite cat:PETS", 10},
+		{"category:PETS,-NOPE", 15},
+		{"category:PETS,", 15},
+		{"after:2019-13", 7},
+		{"after:2019-02-30", 7},
+		{"after:19", 7},
+		{"after:2020 before:2019", 12},
+		{"before:0001", 8},
+		{"type:photo type:video", 12},
+		{"type:", 6},
+		{"favorite:yes", 1},
+		{"type:photo album:x", 12},
+		{"order:newest", 1},
+		{"order:random after:2020", 7},
+		{"date:2019 date:2020 date:2021 date:2022 date:2023 date:2024", 51},
+		{"album:é after:x", 15}, // columns count characters, not bytes
+	} {
+		_, err := Parse(tt.query)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%q error %v, want a syntax error", tt.query, err)
+			continue
+		}
+		if syntaxErr.Column() != tt.column {
+			t.Errorf("%q error %q at column %d, want %d", tt.query, syntaxErr.Msg, syntaxErr.Column(), tt.column)
+		}
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	for _, q := range []string{
+		"",
+		"type:video category:PETS,-SCREENSHOTS after:2019-06 before:2020 favorite archived:include",
+		"album:abc",
+		"type:photo date:2019 date:2020-02 date:2021-03-04 order:newest",
+		"after:2019-06-15 app-only",
+		"before:2001-02-03 order:oldest",
+		"after:0001",
+	} {
+		req, err := Parse(q)
+		if err != nil {
+			t.Errorf("parse %q: %v", q, err)
+			continue
+		}
+		formatted, err := Format(req)
+		if err != nil {
+			t.Errorf("format %q: %v", q, err)
+			continue
+		}
+		if formatted != q {
+			t.Errorf("formatted %q, want %q", formatted, q)
+		}
+		again, err := Parse(formatted)
+		if err != nil || !reflect.DeepEqual(again, req) {
+			t.Errorf("round trip of %q gave %+v, %v", q, again, err)
+		}
+	}
+
+	if _, err := Format(mediaitems.SearchMediaItemRequest{Filters: &mediaitems.Filters{
+		DateFilter: &mediaitems.DateFilter{Ranges: make([]mediaitems.DateRange, 2)},
+	}}); err == nil {
+		t.Error("formatted two date ranges")
+	}
+}
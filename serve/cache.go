@@ -0,0 +1,310 @@
+package serve
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Cache files are named by extension, anything else in the directory is left alone.
+const (
+	cacheFileExt = ".cache"
+	tempFileExt  = ".tmp"
+)
+
+// Cache keeps responses on disk, evicting the least recently used ones
+// once their total size exceeds the bound. Every file starts with the
+// content type on a line of its own, followed by the bytes.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu    gosync.Mutex
+	size  int64
+	lru   *list.List               // of *cacheEntry, most recently used first
+	index map[string]*list.Element // file name to element
+}
+
+type cacheEntry struct {
+	name string
+	size int64
+}
+
+// OpenCache opens the cache in dir, which is created if needed. Files of
+// earlier runs are kept, ordered by their modification time, which every
+// hit updates.
+func OpenCache(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		index:    make(map[string]*list.Element),
+	}
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type existing struct {
+		cacheEntry
+		modTime time.Time
+	}
+	var files []existing
+	for _, d := range dirEntries {
+		if d.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(d.Name(), tempFileExt) && strings.Contains(d.Name(), cacheFileExt+".") {
+			os.Remove(filepath.Join(dir, d.Name())) // left by an interrupted store
+			continue
+		}
+		if !strings.HasSuffix(d.Name(), cacheFileExt) {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			continue // removed meanwhile
+		}
+		files = append(files, existing{cacheEntry{name: d.Name(), size: info.Size()}, info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+	for _, f := range files {
+		entry := f.cacheEntry
+		c.index[entry.name] = c.lru.PushBack(&entry)
+		c.size += entry.size
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c, c.evict()
+}
+
+// Size returns the total size of the cached files.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// CachedResponse is a cached response body.
+type CachedResponse struct {
+	*io.SectionReader
+	ContentType string
+
+	f *os.File
+}
+
+func (r *CachedResponse) Close() error {
+	return r.f.Close()
+}
+
+// Open returns the response cached for key, false when there is none.
+func (c *Cache) Open(key string) (*CachedResponse, bool) {
+	name := cacheFileName(key)
+
+	c.mu.Lock()
+	elem, ok := c.index[name]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	now := time.Now()
+	p := filepath.Join(c.dir, name)
+	os.Chtimes(p, now, now) // best effort, orders the cache of the next run
+
+	resp, err := openCached(p)
+	if err != nil {
+		c.remove(name)
+		return nil, false
+	}
+	return resp, true
+}
+
+// Store caches the response body read from r for key and returns it.
+// A body larger than the bound is returned without being kept.
+func (c *Cache) Store(key, contentType string, r io.Reader) (*CachedResponse, error) {
+	w, err := c.Create(key, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return w.commit()
+}
+
+// Create returns a writer caching the response body written to it for key,
+// so a body can be cached while it is streamed to the client.
+func (c *Cache) Create(key, contentType string) (*CacheWriter, error) {
+	name := cacheFileName(key)
+
+	f, err := os.CreateTemp(c.dir, name+".*"+tempFileExt)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &CacheWriter{c: c, name: name, f: f, w: bufio.NewWriter(f)}
+	_, w.err = w.w.WriteString(contentType + "\n")
+	return w, nil
+}
+
+// CacheWriter writes a response body to the cache, which keeps it once it
+// is committed. Writes never fail, so a full disk does not interrupt the
+// stream the body is copied from: the first error is returned by Commit.
+type CacheWriter struct {
+	c    *Cache
+	name string
+	f    *os.File
+	w    *bufio.Writer
+	err  error
+}
+
+// Write implements io.Writer.
+func (w *CacheWriter) Write(p []byte) (int, error) {
+	if w.err == nil {
+		_, w.err = w.w.Write(p)
+	}
+	return len(p), nil
+}
+
+// Commit keeps the written body in the cache. A body larger than the bound
+// is not kept.
+func (w *CacheWriter) Commit() error {
+	resp, err := w.commit()
+	if err != nil {
+		return err
+	}
+	return resp.Close()
+}
+
+// Abort discards the written body, e.g. when it is incomplete.
+func (w *CacheWriter) Abort() {
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+func (w *CacheWriter) commit() (*CachedResponse, error) {
+	err := w.err
+	if err == nil {
+		err = w.w.Flush()
+	}
+	if err == nil {
+		err = w.f.Close()
+	}
+	if err != nil {
+		w.Abort()
+		return nil, err
+	}
+
+	c := w.c
+	p := filepath.Join(c.dir, w.name)
+	if err := os.Rename(w.f.Name(), p); err != nil {
+		os.Remove(w.f.Name())
+		return nil, err
+	}
+
+	// opened before the entry may be evicted, the open file stays readable
+	resp, err := openCached(p)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.index[w.name]; ok { // stored concurrently
+		c.size -= elem.Value.(*cacheEntry).size
+		c.lru.Remove(elem)
+	}
+	size := resp.Size() + int64(len(resp.ContentType)) + 1
+	c.index[w.name] = c.lru.PushFront(&cacheEntry{name: w.name, size: size})
+	c.size += size
+
+	if err := c.evict(); err != nil {
+		slog.Debug("failed evicting cached responses", "error", err)
+	}
+	return resp, nil
+}
+
+// evict removes the least recently used files until the cache fits its bound.
+func (c *Cache) evict() error {
+	var errs []error
+	for c.size > c.maxBytes && c.lru.Len() > 0 {
+		entry := c.lru.Remove(c.lru.Back()).(*cacheEntry)
+		delete(c.index, entry.name)
+		c.size -= entry.size
+
+		if err := os.Remove(filepath.Join(c.dir, entry.name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Cache) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.index[name]; ok {
+		c.size -= elem.Value.(*cacheEntry).size
+		c.lru.Remove(elem)
+		delete(c.index, name)
+	}
+	os.Remove(filepath.Join(c.dir, name))
+}
+
+func openCached(name string) (*CachedResponse, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	contentType, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	offset := int64(len(contentType))
+
+	return &CachedResponse{
+		SectionReader: io.NewSectionReader(f, offset, info.Size()-offset),
+		ContentType:   strings.TrimSuffix(contentType, "\n"),
+		f:             f,
+	}, nil
+}
+
+// cacheFileName hashes the key, which may hold any character.
+func cacheFileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]) + cacheFileExt
+}
@@ -0,0 +1,353 @@
+// Package serve exposes media items under stable urls.
+//
+// Base urls expire after about an hour and only work with the OAuth client,
+// so they cannot be embedded in pages. The server resolves stable routes to
+// current base urls and streams the bytes:
+//
+//	/items/{id}            the original, or a video's bytes
+//	/items/{id}?w=800      the image scaled to fit 800 pixels wide, a video's poster frame
+//	/albums/{id}/cover     the album's cover photo, scaled with w and h alike
+//
+// Responses are optionally cached on disk in a Cache.
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// DefaultBaseURLTTL is how long resolved base urls are used, shorter
+	// than the hour they are valid.
+	DefaultBaseURLTTL = 45 * time.Minute
+
+	// MaxDimension bounds the w and h parameters, the largest size the
+	// API scales to.
+	MaxDimension = 16383
+
+	// DefaultMaxAge is the max-age of the Cache-Control header of responses.
+	DefaultMaxAge = 24 * time.Hour
+)
+
+type Config struct {
+	cache      *Cache
+	baseURLTTL time.Duration
+	maxAge     time.Duration
+}
+
+type Option func(*Config)
+
+// WithCache caches responses in cache.
+func WithCache(cache *Cache) Option {
+	return func(c *Config) {
+		c.cache = cache
+	}
+}
+
+// WithBaseURLTTL sets how long resolved base urls are used before they are
+// resolved again, DefaultBaseURLTTL when unset.
+func WithBaseURLTTL(ttl time.Duration) Option {
+	return func(c *Config) {
+		if ttl > 0 {
+			c.baseURLTTL = ttl
+		}
+	}
+}
+
+// WithMaxAge sets how long clients may cache responses, DefaultMaxAge when unset.
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(c *Config) {
+		c.maxAge = maxAge
+	}
+}
+
+// Server is an http.Handler serving media items of the library client
+// has access to.
+type Server struct {
+	client *http.Client
+	cfg    *Config
+
+	mu       gosync.Mutex
+	resolved map[string]resolved // route target, e.g. items/{id}, to its base url
+}
+
+type resolved struct {
+	baseURL  string
+	mimeType string // of the original
+	video    bool
+	at       time.Time
+}
+
+// New returns a server resolving base urls with client.
+func New(client *http.Client, opts ...Option) *Server {
+	cfg := &Config{
+		baseURLTTL: DefaultBaseURLTTL,
+		maxAge:     DefaultMaxAge,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return &Server{
+		client:   client,
+		cfg:      cfg,
+		resolved: make(map[string]resolved),
+	}
+}
+
+// target is what a request asks for.
+type target struct {
+	key  string // of the resolved base url, items/{id} or albums/{id}
+	id   string
+	w, h int
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	t, err := parseTarget(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if t.key == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	// the cache key is the normalized request, independent of base urls
+	cacheKey := fmt.Sprintf("%s?w=%d&h=%d", t.key, t.w, t.h)
+	if s.cfg.cache != nil {
+		if cached, ok := s.cfg.cache.Open(cacheKey); ok {
+			defer cached.Close()
+			s.serveContent(w, r, cached.ContentType, cached)
+			return
+		}
+	}
+
+	resp, err := s.fetch(r.Context(), t)
+	if err != nil {
+		// the error may carry base urls, clients only get the status
+		code := statusCode(err)
+		slog.ErrorContext(r.Context(), "failed serving", "path", r.URL.Path, "error", err)
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	defer resp.Body.Close()
+
+	contentType := resp.Header.Get("Content-Type")
+
+	s.setHeaders(w, contentType)
+	if resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// the body is cached while it streams, a failing cache only costs the copy
+	var body io.Reader = resp.Body
+	var cached *CacheWriter
+	if s.cfg.cache != nil {
+		if cached, err = s.cfg.cache.Create(cacheKey, contentType); err != nil {
+			slog.DebugContext(r.Context(), "failed caching", "path", r.URL.Path, "error", err)
+		} else {
+			body = io.TeeReader(resp.Body, cached)
+		}
+	}
+
+	_, err = io.Copy(w, body)
+	if err != nil {
+		slog.DebugContext(r.Context(), "failed streaming", "path", r.URL.Path, "error", err)
+	}
+	if cached == nil {
+		return
+	}
+	if err != nil {
+		cached.Abort() // incomplete
+		return
+	}
+	if err := cached.Commit(); err != nil {
+		slog.DebugContext(r.Context(), "failed caching", "path", r.URL.Path, "error", err)
+	}
+}
+
+func (s *Server) setHeaders(w http.ResponseWriter, contentType string) {
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(s.cfg.maxAge.Seconds())))
+}
+
+// serveContent serves a cached body, supporting range requests.
+func (s *Server) serveContent(w http.ResponseWriter, r *http.Request, contentType string, body io.ReadSeeker) {
+	s.setHeaders(w, contentType)
+	http.ServeContent(w, r, "", time.Time{}, body)
+}
+
+// parseTarget parses the route, returning a target without key when no
+// route matches.
+func parseTarget(u *url.URL) (target, error) {
+	var t target
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "items" && parts[1] != "":
+		t.key, t.id = "items/"+parts[1], parts[1]
+	case len(parts) == 3 && parts[0] == "albums" && parts[1] != "" && parts[2] == "cover":
+		t.key, t.id = "albums/"+parts[1], parts[1]
+	default:
+		return t, nil
+	}
+
+	query := u.Query()
+	for _, dim := range []struct {
+		name string
+		v    *int
+	}{{"w", &t.w}, {"h", &t.h}} {
+		value := query.Get(dim.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > MaxDimension {
+			return t, fmt.Errorf("%s must be between 1 and %d", dim.name, MaxDimension)
+		}
+		*dim.v = n
+	}
+
+	return t, nil
+}
+
+// fetch requests the bytes of the target, resolving its base url again
+// when the cached one was rejected.
+func (s *Server) fetch(ctx context.Context, t target) (*http.Response, error) {
+	res, err := s.resolve(ctx, t, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.get(ctx, bytesURL(res, t))
+
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) && !api.IsNotFound(err) {
+		// expired early, e.g. after a restart of the client's session
+		slog.DebugContext(ctx, "refreshing base url", "target", t.key, "error", err)
+		if res, err = s.resolve(ctx, t, true); err != nil {
+			return nil, err
+		}
+		resp, err = s.get(ctx, bytesURL(res, t))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Header.Get("Content-Type") == "" && t.w == 0 && t.h == 0 {
+		resp.Header.Set("Content-Type", res.mimeType)
+	}
+	return resp, nil
+}
+
+// resolve returns the base url of the target, looking it up when it is not
+// known, older than the TTL or refresh is set.
+func (s *Server) resolve(ctx context.Context, t target, refresh bool) (resolved, error) {
+	s.mu.Lock()
+	res, ok := s.resolved[t.key]
+	s.mu.Unlock()
+	if ok && !refresh && time.Since(res.at) < s.cfg.baseURLTTL {
+		return res, nil
+	}
+
+	if strings.HasPrefix(t.key, "albums/") {
+		album, err := albums.Get(ctx, s.client, albums.GetAlbumRequest{AlbumID: t.id})
+		if err != nil {
+			return resolved{}, err
+		}
+		if album.CoverPhotoBaseURL == "" {
+			return resolved{}, &api.Error{StatusCode: http.StatusNotFound, Message: "album has no cover photo"}
+		}
+		res = resolved{baseURL: album.CoverPhotoBaseURL, mimeType: "image/jpeg"}
+	} else {
+		item, err := mediaitems.Get(ctx, s.client, mediaitems.GetMediaItemRequest{MediaItemID: t.id})
+		if err != nil {
+			return resolved{}, err
+		}
+		res = resolved{baseURL: item.BaseURL, mimeType: item.MimeType, video: item.IsVideo()}
+	}
+	res.at = time.Now()
+
+	s.mu.Lock()
+	s.resolved[t.key] = res
+	s.mu.Unlock()
+
+	return res, nil
+}
+
+// bytesURL appends the parameters selecting the bytes to the base url.
+func bytesURL(res resolved, t target) string {
+	switch {
+	case t.w > 0 && t.h > 0:
+		return fmt.Sprintf("%s=w%d-h%d", res.baseURL, t.w, t.h)
+	case t.w > 0:
+		return fmt.Sprintf("%s=w%d", res.baseURL, t.w)
+	case t.h > 0:
+		return fmt.Sprintf("%s=h%d", res.baseURL, t.h)
+	case res.video:
+		return res.baseURL + "=dv"
+	}
+	return res.baseURL + "=d"
+}
+
+func (s *Server) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := api.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// statusCode maps errors to the status of the response.
+func statusCode(err error) int {
+	var apiErr *api.Error
+	switch {
+	case api.IsNotFound(err):
+		return http.StatusNotFound
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest:
+		// e.g. an invalid id
+		return http.StatusNotFound
+	case api.IsRateLimited(err):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
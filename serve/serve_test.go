@@ -0,0 +1,249 @@
+package serve
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+var _ http.RoundTripper = mockRoundTripper{}
+
+type mockRoundTripper struct {
+	roundTripperFn func(*http.Request) (*http.Response, error)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (mock mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return mock.roundTripperFn(req)
+}
+
+// mockLibrary serves media item a and album 1, whose cover is a. Base urls
+// carry a version, bumping it expires the previous ones.
+type mockLibrary struct {
+	mu      gosync.Mutex
+	version int
+	gets    int
+	fetches []string
+}
+
+func (lib *mockLibrary) client() *http.Client {
+	return &http.Client{Transport: mockRoundTripper{roundTripperFn: func(req *http.Request) (*http.Response, error) {
+		lib.mu.Lock()
+		defer lib.mu.Unlock()
+
+		baseURL := fmt.Sprintf("https://lh3.example.com/a-v%d", lib.version)
+		status, contentType := http.StatusOK, "application/json"
+		var body []byte
+
+		switch {
+		case req.URL.Host == "lh3.example.com":
+			lib.fetches = append(lib.fetches, req.URL.Path)
+			if !strings.HasPrefix(req.URL.String(), baseURL+"=") {
+				status, body = http.StatusForbidden, []byte("expired")
+				break
+			}
+			contentType, body = "image/webp", []byte("bytes "+req.URL.Path)
+			if strings.HasSuffix(req.URL.Path, "=d") {
+				contentType = ""
+			}
+		case req.URL.Path == "/v1/mediaItems/a":
+			lib.gets++
+			body, _ = json.Marshal(mediaitems.MediaItem{ID: "a", BaseURL: baseURL, MimeType: "image/jpeg"})
+		case req.URL.Path == "/v1/albums/1":
+			body, _ = json.Marshal(albums.Album{ID: "1", CoverPhotoBaseURL: baseURL})
+		default:
+			status, body = http.StatusNotFound, []byte(`{"error":{"code":404,"message":"not found","status":"NOT_FOUND"}}`)
+		}
+
+		header := http.Header{}
+		if contentType != "" {
+			header.Set("Content-Type", contentType)
+		}
+		return &http.Response{
+			StatusCode:    status,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}}}
+}
+
+func TestServer(t *testing.T) {
+	lib := &mockLibrary{}
+	cache, err := OpenCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(lib.client(), WithCache(cache))
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	for _, tt := range []struct {
+		target      string
+		status      int
+		body        string
+		contentType string
+	}{
+		{"/items/a?w=800", http.StatusOK, "bytes /a-v0=w800", "image/webp"},
+		{"/items/a?w=800&h=600", http.StatusOK, "bytes /a-v0=w800-h600", "image/webp"},
+		{"/items/a", http.StatusOK, "bytes /a-v0=d", "image/jpeg"},
+		{"/albums/1/cover?h=100", http.StatusOK, "bytes /a-v0=h100", "image/webp"},
+		{"/items/a?w=0", http.StatusBadRequest, "", ""},
+		{"/items/b", http.StatusNotFound, "", ""},
+		{"/other", http.StatusNotFound, "", ""},
+	} {
+		rec := get(tt.target)
+		if rec.Code != tt.status {
+			t.Errorf("%s status %d, want %d", tt.target, rec.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if rec.Body.String() != tt.body || rec.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("%s got %q of type %q, want %q of type %q", tt.target, rec.Body, rec.Header().Get("Content-Type"), tt.body, tt.contentType)
+		}
+		if rec.Header().Get("Cache-Control") != "max-age=86400" {
+			t.Errorf("%s Cache-Control %q", tt.target, rec.Header().Get("Cache-Control"))
+		}
+	}
+
+	// cached, the base url is not used
+	fetches := len(lib.fetches)
+	if rec := get("/items/a?w=800"); rec.Body.String() != "bytes /a-v0=w800" || len(lib.fetches) != fetches {
+		t.Errorf("cached response %q, %d fetches", rec.Body, len(lib.fetches)-fetches)
+	}
+
+	// the base url expires before its TTL, it is resolved again
+	lib.version++
+	gets := lib.gets
+	if rec := get("/items/a?w=400"); rec.Body.String() != "bytes /a-v1=w400" || lib.gets != gets+1 {
+		t.Errorf("refreshed response %q, %d gets", rec.Body, lib.gets-gets)
+	}
+}
+
+func TestServerWithoutCache(t *testing.T) {
+	lib := &mockLibrary{}
+	s := New(lib.client(), WithBaseURLTTL(time.Nanosecond))
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items/a?w=10", nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != "bytes /a-v0=w10" {
+			t.Errorf("got %d %q", rec.Code, rec.Body)
+		}
+	}
+	if lib.gets != 2 || len(lib.fetches) != 2 {
+		t.Errorf("got %d gets and %d fetches, want 2 each", lib.gets, len(lib.fetches))
+	}
+}
+
+func TestServerCacheFailure(t *testing.T) {
+	lib := &mockLibrary{}
+	dir := t.TempDir()
+	cache, err := OpenCache(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	s := New(lib.client(), WithCache(cache))
+
+	// the response is streamed uncached
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items/a?w=10", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "bytes /a-v0=w10" {
+		t.Errorf("got %d %q", rec.Code, rec.Body)
+	}
+	if cache.Size() != 0 {
+		t.Errorf("cache size %d after failing to store", cache.Size())
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, err := OpenCache(dir, 30) // room for two entries of 15 bytes
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := func(key string) {
+		t.Helper()
+		resp, err := cache.Store(key, "text/x", strings.NewReader("value "+key)) // 7 + 8 bytes
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(resp)
+		resp.Close()
+		if err != nil || string(data) != "value "+key {
+			t.Errorf("stored %q, error %v", data, err)
+		}
+	}
+	cached := func(key string) bool {
+		t.Helper()
+		resp, ok := cache.Open(key)
+		if !ok {
+			return false
+		}
+		defer resp.Close()
+
+		data, err := io.ReadAll(resp)
+		if err != nil || string(data) != "value "+key || resp.ContentType != "text/x" {
+			t.Errorf("cached %q of type %q, error %v", data, resp.ContentType, err)
+		}
+		return true
+	}
+
+	store("k1")
+	time.Sleep(10 * time.Millisecond) // modification times order the next run
+	store("k2")
+	time.Sleep(10 * time.Millisecond)
+	if !cached("k1") {
+		t.Fatal("k1 not cached")
+	}
+	store("k3") // evicts k2, the least recently used
+
+	if cached("k2") || !cached("k1") || !cached("k3") {
+		t.Errorf("eviction not least recently used")
+	}
+	if cache.Size() != 30 {
+		t.Errorf("size %d, want 30", cache.Size())
+	}
+
+	// a smaller bound evicts on open, keeping the most recently used
+	time.Sleep(10 * time.Millisecond)
+	cached("k1")
+	reopened, err := OpenCache(dir, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache = reopened
+	if !cached("k1") || cached("k3") {
+		t.Error("reopened cache did not keep the most recently used entry")
+	}
+
+	if _, err := cache.Store("big", "text/x", strings.NewReader(strings.Repeat("x", 100))); err != nil {
+		t.Fatal(err)
+	}
+	if cached("big") || cache.Size() > 20 {
+		t.Errorf("entry larger than the bound kept, size %d", cache.Size())
+	}
+}
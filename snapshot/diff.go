@@ -0,0 +1,249 @@
+package snapshot
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+// AlbumRef identifies an album in a report.
+type AlbumRef struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// Item is a media item in a report, with the albums it is in.
+type Item struct {
+	ID           string     `json:"id"`
+	Filename     string     `json:"filename"`
+	CreationTime time.Time  `json:"creationTime"`
+	Albums       []AlbumRef `json:"albums,omitempty"`
+}
+
+// ItemChange is a media item in both snapshots which changed.
+type ItemChange struct {
+	Item
+	// Description is set when the description changed.
+	Description *DescriptionChange `json:"description,omitempty"`
+	AddedTo     []AlbumRef         `json:"addedTo,omitempty"`
+	RemovedFrom []AlbumRef         `json:"removedFrom,omitempty"`
+}
+
+// DescriptionChange is the old and new description of a media item.
+type DescriptionChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// AlbumRename is an album whose title changed.
+type AlbumRename struct {
+	ID       string `json:"id"`
+	OldTitle string `json:"oldTitle"`
+	NewTitle string `json:"newTitle"`
+}
+
+// Report is the difference between two snapshots. Items and albums are
+// ordered by id.
+type Report struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	Added   []Item       `json:"added"`
+	Removed []Item       `json:"removed"`
+	Changed []ItemChange `json:"changed"`
+
+	AlbumsAdded   []AlbumRef    `json:"albumsAdded"`
+	AlbumsRemoved []AlbumRef    `json:"albumsRemoved"`
+	AlbumsRenamed []AlbumRename `json:"albumsRenamed"`
+}
+
+// Empty reports whether the snapshots are the same.
+func (r Report) Empty() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Changed) == 0 &&
+		len(r.AlbumsAdded) == 0 && len(r.AlbumsRemoved) == 0 && len(r.AlbumsRenamed) == 0
+}
+
+// Diff returns what changed from one snapshot to a later one: media items
+// added and removed, media items whose description or album membership
+// changed, and albums added, removed and renamed.
+func Diff(from, to *Snapshot) Report {
+	r := Report{
+		From:          from.TakenAt,
+		To:            to.TakenAt,
+		Added:         []Item{},
+		Removed:       []Item{},
+		Changed:       []ItemChange{},
+		AlbumsAdded:   []AlbumRef{},
+		AlbumsRemoved: []AlbumRef{},
+		AlbumsRenamed: []AlbumRename{},
+	}
+
+	oldAlbums, newAlbums := albumsByID(from), albumsByID(to)
+	for _, id := range sortedKeys(newAlbums) {
+		a := newAlbums[id]
+		o, ok := oldAlbums[id]
+		switch {
+		case !ok:
+			r.AlbumsAdded = append(r.AlbumsAdded, ref(a))
+		case o.Title != a.Title:
+			r.AlbumsRenamed = append(r.AlbumsRenamed, AlbumRename{ID: id, OldTitle: o.Title, NewTitle: a.Title})
+		}
+	}
+	for _, id := range sortedKeys(oldAlbums) {
+		if _, ok := newAlbums[id]; !ok {
+			r.AlbumsRemoved = append(r.AlbumsRemoved, ref(oldAlbums[id]))
+		}
+	}
+
+	oldItems, newItems := itemsByID(from), itemsByID(to)
+	oldMembership, newMembership := membership(from), membership(to)
+
+	for _, id := range sortedKeys(newItems) {
+		item := newItems[id]
+		o, ok := oldItems[id]
+		if !ok {
+			r.Added = append(r.Added, reportItem(item, newMembership[id]))
+			continue
+		}
+
+		change := ItemChange{Item: reportItem(item, newMembership[id])}
+		if o.Description != item.Description {
+			change.Description = &DescriptionChange{Old: o.Description, New: item.Description}
+		}
+		change.AddedTo = subtract(newMembership[id], oldMembership[id])
+		change.RemovedFrom = subtract(oldMembership[id], newMembership[id])
+
+		if change.Description != nil || len(change.AddedTo) > 0 || len(change.RemovedFrom) > 0 {
+			r.Changed = append(r.Changed, change)
+		}
+	}
+	for _, id := range sortedKeys(oldItems) {
+		if _, ok := newItems[id]; !ok {
+			r.Removed = append(r.Removed, reportItem(oldItems[id], oldMembership[id]))
+		}
+	}
+
+	return r
+}
+
+// WriteText writes the report for people: a line per change, prefixed with
+// + for additions, - for removals and ~ for changes, and a summary.
+func (r Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "changes from %s to %s\n", r.From.Format(time.RFC3339), r.To.Format(time.RFC3339))
+	for _, a := range r.AlbumsAdded {
+		fmt.Fprintf(&b, "+ album %s %q\n", a.ID, a.Title)
+	}
+	for _, a := range r.AlbumsRemoved {
+		fmt.Fprintf(&b, "- album %s %q\n", a.ID, a.Title)
+	}
+	for _, a := range r.AlbumsRenamed {
+		fmt.Fprintf(&b, "~ album %s %q -> %q\n", a.ID, a.OldTitle, a.NewTitle)
+	}
+	for _, item := range r.Added {
+		fmt.Fprintf(&b, "+ item %s %s%s\n", item.ID, item.Filename, inAlbums(item.Albums))
+	}
+	for _, item := range r.Removed {
+		fmt.Fprintf(&b, "- item %s %s%s\n", item.ID, item.Filename, inAlbums(item.Albums))
+	}
+	for _, c := range r.Changed {
+		var details []string
+		if c.Description != nil {
+			details = append(details, fmt.Sprintf("description %q -> %q", c.Description.Old, c.Description.New))
+		}
+		for _, a := range c.AddedTo {
+			details = append(details, fmt.Sprintf("added to %q", a.Title))
+		}
+		for _, a := range c.RemovedFrom {
+			details = append(details, fmt.Sprintf("removed from %q", a.Title))
+		}
+		fmt.Fprintf(&b, "~ item %s %s: %s\n", c.ID, c.Filename, strings.Join(details, ", "))
+	}
+	fmt.Fprintf(&b, "%d items added, %d removed, %d changed; %d albums added, %d removed, %d renamed\n",
+		len(r.Added), len(r.Removed), len(r.Changed), len(r.AlbumsAdded), len(r.AlbumsRemoved), len(r.AlbumsRenamed))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func inAlbums(refs []AlbumRef) string {
+	if len(refs) == 0 {
+		return ""
+	}
+	titles := make([]string, len(refs))
+	for i, a := range refs {
+		titles[i] = fmt.Sprintf("%q", a.Title)
+	}
+	return " in " + strings.Join(titles, ", ")
+}
+
+func ref(a Album) AlbumRef {
+	return AlbumRef{ID: a.ID, Title: a.Title}
+}
+
+func reportItem(item mediaitems.MediaItem, albums []AlbumRef) Item {
+	i := Item{ID: item.ID, Filename: item.Filename, Albums: albums}
+	if item.MediaMetadata != nil {
+		i.CreationTime = item.MediaMetadata.CreationTime
+	}
+	return i
+}
+
+func albumsByID(s *Snapshot) map[string]Album {
+	m := make(map[string]Album, len(s.Albums))
+	for _, a := range s.Albums {
+		m[a.ID] = a
+	}
+	return m
+}
+
+func itemsByID(s *Snapshot) map[string]mediaitems.MediaItem {
+	m := make(map[string]mediaitems.MediaItem, len(s.MediaItems))
+	for _, item := range s.MediaItems {
+		m[item.ID] = item
+	}
+	return m
+}
+
+// membership returns the albums of each media item, in album list order.
+func membership(s *Snapshot) map[string][]AlbumRef {
+	m := make(map[string][]AlbumRef)
+	for _, a := range s.Albums {
+		for _, id := range a.MediaItemIDs {
+			m[id] = append(m[id], ref(a))
+		}
+	}
+	return m
+}
+
+// subtract returns the albums of a not in b.
+func subtract(a, b []AlbumRef) []AlbumRef {
+	var diff []AlbumRef
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			if x.ID == y.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			diff = append(diff, x)
+		}
+	}
+	return diff
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
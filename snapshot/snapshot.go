@@ -0,0 +1,179 @@
+// Package snapshot records the state of a library to compare it later.
+//
+// A snapshot holds every album with the ids of its media items and every
+// media item, as gzip compressed JSON. Base urls expire and are left out.
+package snapshot
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+// Version is the format version of the snapshots written, newer snapshots
+// cannot be read.
+const Version = 1
+
+// FileExt is the conventional extension of snapshot files.
+const FileExt = ".json.gz"
+
+type Config struct {
+	listRequest mediaitems.ListMediaItemsRequest
+}
+
+type Option func(*Config)
+
+// WithListRequest sets the request used to walk the library, e.g. to exclude
+// media items not created by the app.
+func WithListRequest(listRequest mediaitems.ListMediaItemsRequest) Option {
+	return func(c *Config) {
+		c.listRequest = listRequest
+	}
+}
+
+// Snapshot is the state of a library at a point in time.
+type Snapshot struct {
+	Version    int                    `json:"version"`
+	TakenAt    time.Time              `json:"takenAt"`
+	Albums     []Album                `json:"albums"`
+	MediaItems []mediaitems.MediaItem `json:"mediaItems"`
+}
+
+// Album is an album with the ids of its media items in album order.
+type Album struct {
+	albums.Album
+	MediaItemIDs []string `json:"mediaItemIds"`
+}
+
+// Take lists every album with its media items and every media item of the
+// library.
+func Take(ctx context.Context, client *http.Client, opts ...Option) (*Snapshot, error) {
+	cfg := &Config{
+		listRequest: mediaitems.ListMediaItemsRequest{PageSize: api.MaxPageSize},
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	s := &Snapshot{Version: Version, TakenAt: time.Now().UTC()}
+
+	albumCh, errCh := albums.List(ctx, client, albums.ListAlbumsRequest{PageSize: api.MaxPageSize})
+	for album := range albumCh {
+		album.CoverPhotoBaseURL = ""
+		s.Albums = append(s.Albums, Album{Album: album})
+	}
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range s.Albums {
+		itemCh, errCh := mediaitems.Search(ctx, client, mediaitems.SearchMediaItemRequest{
+			AlbumID:  s.Albums[i].ID,
+			PageSize: api.MaxPageSize,
+		})
+		for item := range itemCh {
+			s.Albums[i].MediaItemIDs = append(s.Albums[i].MediaItemIDs, item.ID)
+		}
+		select {
+		case err := <-errCh:
+			return nil, err
+		default:
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	itemCh, errCh := mediaitems.List(ctx, client, cfg.listRequest)
+	for item := range itemCh {
+		item.BaseURL = ""
+		s.MediaItems = append(s.MediaItems, item)
+	}
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+
+	return s, ctx.Err()
+}
+
+// Write writes the compressed snapshot to w.
+func Write(w io.Writer, s *Snapshot) error {
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(s); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// Read reads a snapshot written by Write.
+func Read(r io.Reader) (*Snapshot, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var s Snapshot
+	if err := json.NewDecoder(zr).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Version > Version {
+		return nil, fmt.Errorf("snapshot version %d is newer than %d", s.Version, Version)
+	}
+
+	return &s, nil
+}
+
+// WriteFile writes the snapshot to the named file, which is replaced only
+// once the snapshot is complete.
+func WriteFile(name string, s *Snapshot) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op once renamed
+
+	if err := Write(f, s); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), name)
+}
+
+// ReadFile reads the snapshot of the named file.
+func ReadFile(name string) (*Snapshot, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", name, err)
+	}
+	return s, nil
+}
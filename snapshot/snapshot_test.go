@@ -0,0 +1,140 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+var _ http.RoundTripper = mockRoundTripper{}
+
+type mockRoundTripper struct {
+	roundTripperFn func(*http.Request) (*http.Response, error)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (mock mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return mock.roundTripperFn(req)
+}
+
+func TestTake(t *testing.T) {
+	client := &http.Client{Transport: mockRoundTripper{roundTripperFn: func(req *http.Request) (*http.Response, error) {
+		var resp any
+		switch req.URL.Path {
+		case "/v1/albums":
+			resp = albums.ListAlbumsResponse{Albums: []albums.Album{{ID: "1", Title: "Trip", CoverPhotoBaseURL: "https://lh3.example.com/cover"}}}
+		case "/v1/mediaItems:search":
+			resp = mediaitems.SearchMediaItemResponse{MediaItems: []mediaitems.MediaItem{{ID: "a"}}}
+		default:
+			resp = mediaitems.ListMediaItemsResponse{MediaItems: []mediaitems.MediaItem{
+				{ID: "a", Filename: "a.jpg", BaseURL: "https://lh3.example.com/a"},
+				{ID: "b", Filename: "b.jpg", BaseURL: "https://lh3.example.com/b"},
+			}}
+		}
+		body, _ := json.Marshal(resp)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(bytes.NewReader(body)),
+			Request:    req,
+		}, nil
+	}}}
+
+	s, err := Take(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Albums) != 1 || len(s.Albums[0].MediaItemIDs) != 1 || s.Albums[0].MediaItemIDs[0] != "a" || len(s.MediaItems) != 2 {
+		t.Fatalf("snapshot %+v not expected", s)
+	}
+	if s.Albums[0].CoverPhotoBaseURL != "" || s.MediaItems[0].BaseURL != "" {
+		t.Error("snapshot kept base urls")
+	}
+
+	name := filepath.Join(t.TempDir(), "library"+FileExt)
+	if err := WriteFile(name, s); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !read.TakenAt.Equal(s.TakenAt) || read.Albums[0].Title != "Trip" || len(read.MediaItems) != 2 {
+		t.Errorf("read snapshot %+v differs from %+v", read, s)
+	}
+	if !Diff(s, read).Empty() {
+		t.Error("snapshot differs from itself")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	from := &Snapshot{
+		TakenAt: time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC),
+		Albums: []Album{
+			{Album: albums.Album{ID: "1", Title: "Trip"}, MediaItemIDs: []string{"a", "b"}},
+			{Album: albums.Album{ID: "2", Title: "Old"}, MediaItemIDs: []string{"b"}},
+		},
+		MediaItems: []mediaitems.MediaItem{
+			{ID: "a", Filename: "a.jpg"},
+			{ID: "b", Filename: "b.jpg", Description: "beach"},
+			{ID: "c", Filename: "c.jpg"},
+		},
+	}
+	to := &Snapshot{
+		TakenAt: time.Date(2023, time.July, 1, 0, 0, 0, 0, time.UTC),
+		Albums: []Album{
+			{Album: albums.Album{ID: "1", Title: "Trip 2023"}, MediaItemIDs: []string{"a", "b", "d"}},
+			{Album: albums.Album{ID: "3", Title: "New"}, MediaItemIDs: []string{"a"}},
+		},
+		MediaItems: []mediaitems.MediaItem{
+			{ID: "a", Filename: "a.jpg"},
+			{ID: "b", Filename: "b.jpg", Description: "sunset"},
+			{ID: "d", Filename: "d.jpg"},
+		},
+	}
+
+	r := Diff(from, to)
+
+	if len(r.Added) != 1 || r.Added[0].ID != "d" || len(r.Added[0].Albums) != 1 {
+		t.Errorf("added %+v", r.Added)
+	}
+	if len(r.Removed) != 1 || r.Removed[0].ID != "c" {
+		t.Errorf("removed %+v", r.Removed)
+	}
+	if len(r.Changed) != 2 {
+		t.Fatalf("changed %+v", r.Changed)
+	}
+	if a := r.Changed[0]; a.ID != "a" || a.Description != nil || len(a.AddedTo) != 1 || a.AddedTo[0].ID != "3" || len(a.RemovedFrom) != 0 {
+		t.Errorf("change of a %+v", a)
+	}
+	if b := r.Changed[1]; b.ID != "b" || b.Description == nil || b.Description.New != "sunset" || len(b.RemovedFrom) != 1 || b.RemovedFrom[0].Title != "Old" {
+		t.Errorf("change of b %+v", b)
+	}
+	if len(r.AlbumsAdded) != 1 || len(r.AlbumsRemoved) != 1 || len(r.AlbumsRenamed) != 1 || r.AlbumsRenamed[0].NewTitle != "Trip 2023" {
+		t.Errorf("album changes %+v %+v %+v", r.AlbumsAdded, r.AlbumsRemoved, r.AlbumsRenamed)
+	}
+
+	var text strings.Builder
+	if err := r.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`+ item d d.jpg in "Trip 2023"`,
+		`- item c c.jpg`,
+		`~ item b b.jpg: description "beach" -> "sunset", removed from "Old"`,
+		`~ album 1 "Trip" -> "Trip 2023"`,
+		"1 items added, 1 removed, 2 changed; 1 albums added, 1 removed, 1 renamed",
+	} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text report lacks %s:\n%s", want, text.String())
+		}
+	}
+}
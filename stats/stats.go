@@ -0,0 +1,254 @@
+// Package stats aggregates the metadata of media items, e.g. photos per
+// year or the most used cameras.
+//
+// Only the listed metadata is used, nothing is downloaded. The API does not
+// expose video durations, videos are counted rather than timed.
+package stats
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+// Unknown is the key of media items lacking the metadata of an aggregate.
+const Unknown = "unknown"
+
+// Counts maps keys, such as years or cameras, to the number of media items.
+type Counts map[string]int
+
+// Count is a key of Counts with its number of media items.
+type Count struct {
+	Key string `json:"key"`
+	N   int    `json:"n"`
+}
+
+// ByKey returns the counts ordered by key.
+func (c Counts) ByKey() []Count {
+	counts := make([]Count, 0, len(c))
+	for k, n := range c {
+		counts = append(counts, Count{Key: k, N: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Key < counts[j].Key
+	})
+	return counts
+}
+
+// Top returns the n largest counts, all when n is not positive, largest
+// first and ties ordered by key.
+func (c Counts) Top(n int) []Count {
+	counts := c.ByKey()
+	sort.SliceStable(counts, func(i, j int) bool {
+		return counts[i].N > counts[j].N
+	})
+	if n > 0 && len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// Stats are aggregates over media items. Times are grouped in UTC.
+type Stats struct {
+	Total  int `json:"total"`
+	Photos int `json:"photos"`
+	Videos int `json:"videos"`
+
+	ByYear        Counts `json:"byYear"`        // 2006
+	ByMonth       Counts `json:"byMonth"`       // 2006-01
+	VideosByMonth Counts `json:"videosByMonth"` // 2006-01
+	ByCamera      Counts `json:"byCamera"`      // make and model
+	ByMimeType    Counts `json:"byMimeType"`
+	// PhotoResolutions buckets photos by megapixels, e.g. "12-24 MP".
+	PhotoResolutions Counts `json:"photoResolutions"`
+	// VideoResolutions buckets videos by height, e.g. "1080p".
+	VideoResolutions Counts `json:"videoResolutions"`
+	// ByContributor counts items of shared albums by contributor, media
+	// items of the library have none.
+	ByContributor Counts `json:"byContributor"`
+}
+
+// New returns empty stats.
+func New() *Stats {
+	return &Stats{
+		ByYear:           make(Counts),
+		ByMonth:          make(Counts),
+		VideosByMonth:    make(Counts),
+		ByCamera:         make(Counts),
+		ByMimeType:       make(Counts),
+		PhotoResolutions: make(Counts),
+		VideoResolutions: make(Counts),
+		ByContributor:    make(Counts),
+	}
+}
+
+// Compute aggregates the media items of a stream, such as the one of
+// mediaitems.List.
+func Compute(ctx context.Context, itemCh <-chan mediaitems.MediaItem, errCh <-chan error) (*Stats, error) {
+	s := New()
+	for item := range itemCh {
+		s.Add(item)
+	}
+
+	select {
+	case err := <-errCh:
+		return s, err
+	default:
+	}
+
+	return s, ctx.Err()
+}
+
+// Add counts a media item.
+func (s *Stats) Add(item mediaitems.MediaItem) {
+	s.Total++
+
+	metadata := item.MediaMetadata
+	if metadata == nil {
+		metadata = &mediaitems.MediaMetadata{}
+	}
+
+	year, month := Unknown, Unknown
+	if !metadata.CreationTime.IsZero() {
+		t := metadata.CreationTime.UTC()
+		year, month = t.Format("2006"), t.Format("2006-01")
+	}
+	s.ByYear[year]++
+	s.ByMonth[month]++
+
+	mimeType := item.MimeType
+	if mimeType == "" {
+		mimeType = Unknown
+	}
+	s.ByMimeType[mimeType]++
+
+	contributor := Unknown
+	if item.ContributorInfo != nil && item.ContributorInfo.DisplayName != "" {
+		contributor = item.ContributorInfo.DisplayName
+	}
+	s.ByContributor[contributor]++
+
+	switch {
+	case item.IsVideo():
+		s.Videos++
+		s.VideosByMonth[month]++
+		s.VideoResolutions[videoResolution(metadata.Width, metadata.Height)]++
+		if metadata.Video != nil {
+			s.ByCamera[camera(metadata.Video.CameraMake, metadata.Video.CameraModel)]++
+		} else {
+			s.ByCamera[Unknown]++
+		}
+	default:
+		s.Photos++
+		s.PhotoResolutions[photoResolution(metadata.Width, metadata.Height)]++
+		if metadata.Photo != nil {
+			s.ByCamera[camera(metadata.Photo.CameraMake, metadata.Photo.CameraModel)]++
+		} else {
+			s.ByCamera[Unknown]++
+		}
+	}
+}
+
+// camera joins make and model, which often repeats the make.
+func camera(cameraMake, model string) string {
+	cameraMake, model = strings.TrimSpace(cameraMake), strings.TrimSpace(model)
+	switch {
+	case cameraMake == "" && model == "":
+		return Unknown
+	case cameraMake == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(cameraMake)):
+		return model
+	case model == "":
+		return cameraMake
+	default:
+		return cameraMake + " " + model
+	}
+}
+
+var megapixelBuckets = []struct {
+	max   float64
+	label string
+}{
+	{1, "<1 MP"},
+	{4, "1-4 MP"},
+	{8, "4-8 MP"},
+	{12, "8-12 MP"},
+	{24, "12-24 MP"},
+	{48, "24-48 MP"},
+}
+
+func photoResolution(width, height int64) string {
+	if width <= 0 || height <= 0 {
+		return Unknown
+	}
+	mp := float64(width*height) / 1e6
+	for _, b := range megapixelBuckets {
+		if mp < b.max {
+			return b.label
+		}
+	}
+	return "48+ MP"
+}
+
+// videoResolution names the resolution by the short side, which is the
+// height of landscape videos.
+func videoResolution(width, height int64) string {
+	if width <= 0 || height <= 0 {
+		return Unknown
+	}
+	short := height
+	if width < height {
+		short = width
+	}
+	switch {
+	case short >= 2160:
+		return "2160p"
+	case short >= 1440:
+		return "1440p"
+	case short >= 1080:
+		return "1080p"
+	case short >= 720:
+		return "720p"
+	default:
+		return "SD"
+	}
+}
+
+// WriteText writes the stats as aligned sections for people. Sections
+// keyed by time are complete and in order, the others list the top counts,
+// all when top is not positive.
+func (s *Stats) WriteText(w io.Writer, top int) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "media items\t%d\n", s.Total)
+	fmt.Fprintf(tw, "photos\t%d\n", s.Photos)
+	fmt.Fprintf(tw, "videos\t%d\n", s.Videos)
+
+	for _, section := range []struct {
+		title  string
+		counts []Count
+	}{
+		{"by year", s.ByYear.ByKey()},
+		{"by month", s.ByMonth.ByKey()},
+		{"videos by month", s.VideosByMonth.ByKey()},
+		{"cameras", s.ByCamera.Top(top)},
+		{"mime types", s.ByMimeType.Top(top)},
+		{"photo resolutions", s.PhotoResolutions.Top(top)},
+		{"video resolutions", s.VideoResolutions.Top(top)},
+		{"contributors", s.ByContributor.Top(top)},
+	} {
+		if len(section.counts) == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "\n%s\n", section.title)
+		for _, c := range section.counts {
+			fmt.Fprintf(tw, "  %s\t%d\n", c.Key, c.N)
+		}
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,95 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+func TestCompute(t *testing.T) {
+	items := []mediaitems.MediaItem{
+		{ID: "a", MimeType: "image/jpeg", MediaMetadata: &mediaitems.MediaMetadata{
+			CreationTime: time.Date(2022, time.December, 31, 23, 0, 0, 0, time.UTC),
+			Width:        4032, Height: 3024,
+			Photo: &mediaitems.Photo{CameraMake: "Apple", CameraModel: "iPhone 12"},
+		}},
+		{ID: "b", MimeType: "image/jpeg", MediaMetadata: &mediaitems.MediaMetadata{
+			CreationTime: time.Date(2023, time.January, 1, 0, 30, 0, 0, time.FixedZone("CET", 3600)),
+			Width:        5472, Height: 3648,
+			Photo: &mediaitems.Photo{CameraMake: "Canon", CameraModel: "Canon EOS R6"},
+		}},
+		{ID: "c", MimeType: "video/mp4", ContributorInfo: &mediaitems.ContributorInfo{DisplayName: "Kim"}, MediaMetadata: &mediaitems.MediaMetadata{
+			CreationTime: time.Date(2023, time.January, 5, 0, 0, 0, 0, time.UTC),
+			Width:        1080, Height: 1920,
+			Video: &mediaitems.Video{CameraMake: "Apple", CameraModel: "iPhone 12"},
+		}},
+		{ID: "d"},
+	}
+
+	itemCh := make(chan mediaitems.MediaItem)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(itemCh)
+		for _, item := range items {
+			itemCh <- item
+		}
+	}()
+
+	s, err := Compute(context.Background(), itemCh, errCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Total != 4 || s.Photos != 3 || s.Videos != 1 {
+		t.Errorf("totals %d, %d photos, %d videos", s.Total, s.Photos, s.Videos)
+	}
+	for _, tt := range []struct {
+		name   string
+		counts Counts
+		key    string
+		want   int
+	}{
+		{"year", s.ByYear, "2022", 2}, // b was taken on new year's eve in UTC
+		{"year", s.ByYear, Unknown, 1},
+		{"month", s.ByMonth, "2023-01", 1},
+		{"videos by month", s.VideosByMonth, "2023-01", 1},
+		{"camera", s.ByCamera, "Apple iPhone 12", 2},
+		{"camera", s.ByCamera, "Canon EOS R6", 1},
+		{"mime type", s.ByMimeType, "image/jpeg", 2},
+		{"photo resolution", s.PhotoResolutions, "12-24 MP", 2},
+		{"video resolution", s.VideoResolutions, "1080p", 1},
+		{"contributor", s.ByContributor, "Kim", 1},
+		{"contributor", s.ByContributor, Unknown, 3},
+	} {
+		if got := tt.counts[tt.key]; got != tt.want {
+			t.Errorf("%s %q count %d, want %d", tt.name, tt.key, got, tt.want)
+		}
+	}
+
+	if top := s.ByCamera.Top(1); len(top) != 1 || top[0].Key != "Apple iPhone 12" {
+		t.Errorf("top camera %v", top)
+	}
+
+	var text strings.Builder
+	if err := s.WriteText(&text, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "cameras\n  Apple iPhone 12  2\n") || strings.Contains(text.String(), "Canon") {
+		t.Errorf("text output not expected:\n%s", text.String())
+	}
+}
+
+func TestComputeError(t *testing.T) {
+	itemCh := make(chan mediaitems.MediaItem)
+	errCh := make(chan error, 1)
+	errCh <- errors.New("list failed")
+	close(itemCh)
+
+	if _, err := Compute(context.Background(), itemCh, errCh); err == nil {
+		t.Error("stream error not returned")
+	}
+}
@@ -0,0 +1,84 @@
+package sync
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+// albumContents is an album with the ids of its media items in album order.
+type albumContents struct {
+	album   albums.Album
+	itemIDs []string
+}
+
+// loadAlbums lists every album with its media items.
+func loadAlbums(ctx context.Context, client *http.Client) ([]albumContents, error) {
+	albumList, err := listAlbums(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make([]albumContents, 0, len(albumList))
+	for _, album := range albumList {
+		itemIDs, err := albumItemIDs(ctx, client, album.ID)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, albumContents{album: album, itemIDs: itemIDs})
+	}
+
+	return contents, nil
+}
+
+// albumMembership returns the titles of the albums of each media item, in album list order.
+func albumMembership(contents []albumContents) map[string][]string {
+	membership := make(map[string][]string)
+	for _, c := range contents {
+		for _, id := range c.itemIDs {
+			membership[id] = append(membership[id], c.album.Title)
+		}
+	}
+	return membership
+}
+
+func listAlbums(ctx context.Context, client *http.Client) ([]albums.Album, error) {
+	albumCh, errCh := albums.List(ctx, client, albums.ListAlbumsRequest{PageSize: api.MaxPageSize})
+
+	var albumList []albums.Album
+	for album := range albumCh {
+		albumList = append(albumList, album)
+	}
+
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+
+	return albumList, ctx.Err()
+}
+
+// albumItemIDs returns the ids of the album's media items in album order.
+func albumItemIDs(ctx context.Context, client *http.Client, albumID string) ([]string, error) {
+	itemCh, errCh := mediaitems.Search(ctx, client, mediaitems.SearchMediaItemRequest{
+		AlbumID:  albumID,
+		PageSize: api.MaxPageSize,
+	})
+
+	var ids []string
+	for item := range itemCh {
+		ids = append(ids, item.ID)
+	}
+
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+
+	return ids, ctx.Err()
+}
@@ -0,0 +1,181 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dlph/go-photoslibrary/layout"
+
+	"golang.org/x/exp/slog"
+)
+
+// AlbumsDirName is the directory below the sync directory holding one
+// directory per album. It is managed by Run: files which do not link to a
+// current album member are removed.
+const AlbumsDirName = "albums"
+
+// LinkMode is how album directories refer to the canonical files.
+type LinkMode string
+
+const (
+	// Symlink links with relative symbolic links, so the mirror can be moved.
+	Symlink LinkMode = "symlink"
+	// Hardlink links with hard links, for tools which do not follow symbolic links.
+	Hardlink LinkMode = "hardlink"
+)
+
+// ParseLinkMode parses the name of a link mode.
+func ParseLinkMode(name string) (LinkMode, error) {
+	switch mode := LinkMode(name); mode {
+	case Symlink, Hardlink:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown link mode %q, want %s or %s", name, Symlink, Hardlink)
+}
+
+// linkAlbums makes the albums directory mirror album membership, linking
+// every downloaded album member to its canonical file and removing links of
+// items which left their album and directories of deleted albums.
+func (s *syncer) linkAlbums(ctx context.Context, contents []albumContents) (linked, unlinked int, err error) {
+	fold := func(p string) string {
+		if s.resolver.CaseInsensitiveFS() {
+			return strings.ToLower(p)
+		}
+		return p
+	}
+
+	want := make(map[string]string) // link path to canonical path, both slash separated
+	albumDirs := layout.NewAlbumDirs(s.resolver.CaseInsensitiveFS())
+	for _, c := range contents {
+		dirName := albumDirs.Name(c.album.Title, c.album.ID)
+
+		names := make(map[string]bool)
+		for _, id := range c.itemIDs {
+			entry, ok := s.manifest.Get(id)
+			if !ok {
+				continue // not downloaded, e.g. failed this run
+			}
+
+			name := path.Base(entry.Path)
+			ext := path.Ext(name)
+			for n := 1; names[fold(name)]; n++ {
+				name = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(path.Base(entry.Path), ext), n, ext)
+			}
+			names[fold(name)] = true
+
+			want[path.Join(AlbumsDirName, dirName, name)] = entry.Path
+		}
+	}
+
+	linkPaths := make([]string, 0, len(want))
+	for p := range want {
+		linkPaths = append(linkPaths, p)
+	}
+	sort.Strings(linkPaths)
+
+	for _, p := range linkPaths {
+		if err := ctx.Err(); err != nil {
+			return linked, unlinked, err
+		}
+
+		changed, err := s.link(want[p], p)
+		if err != nil {
+			return linked, unlinked, err
+		}
+		if changed {
+			linked++
+		}
+	}
+
+	root := filepath.Join(s.dir, AlbumsDirName)
+	var dirs []string
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == root {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, p)
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if _, ok := want[rel]; ok {
+			return nil
+		}
+		if _, ok := s.resolver.Owner(rel); ok {
+			return nil // a canonical file, the layout placed it in the albums directory
+		}
+
+		slog.DebugContext(ctx, "removing album link", "path", rel)
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		unlinked++
+		return nil
+	})
+	if err != nil {
+		return linked, unlinked, err
+	}
+
+	// deepest first, removal fails for directories which are not empty
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		os.Remove(dir)
+	}
+
+	return linked, unlinked, nil
+}
+
+// link points the link at linkPath to the canonical file at target, both
+// slash separated and relative to the sync directory. changed reports
+// whether the link was created or replaced.
+func (s *syncer) link(target, linkPath string) (changed bool, err error) {
+	targetAbs := filepath.Join(s.dir, filepath.FromSlash(target))
+	linkAbs := filepath.Join(s.dir, filepath.FromSlash(linkPath))
+
+	relTarget, err := filepath.Rel(filepath.Dir(linkAbs), targetAbs)
+	if err != nil {
+		return false, err
+	}
+
+	linkInfo, err := os.Lstat(linkAbs)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return false, err
+	case s.cfg.linkMode == Symlink && linkInfo.Mode()&fs.ModeSymlink != 0:
+		if dest, err := os.Readlink(linkAbs); err == nil && dest == relTarget {
+			return false, nil
+		}
+	case s.cfg.linkMode == Hardlink && linkInfo.Mode().IsRegular():
+		if targetInfo, err := os.Stat(targetAbs); err == nil && os.SameFile(linkInfo, targetInfo) {
+			return false, nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(linkAbs), 0o755); err != nil {
+		return false, err
+	}
+	if err := os.Remove(linkAbs); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+
+	if s.cfg.linkMode == Hardlink {
+		return true, os.Link(targetAbs, linkAbs)
+	}
+	return true, os.Symlink(relTarget, linkAbs)
+}
@@ -0,0 +1,105 @@
+package sync
+
+import (
+	"sort"
+	gosync "sync"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/internal/journal"
+)
+
+// ManifestFileName is the manifest kept in the root of the sync directory.
+const ManifestFileName = ".gphotos-manifest.jsonl"
+
+// Entry records a downloaded media item.
+type Entry struct {
+	ID           string    `json:"id"`
+	Filename     string    `json:"filename"`
+	Path         string    `json:"path"` // slash separated, relative to the sync directory
+	CreationTime time.Time `json:"creationTime"`
+	SHA256       string    `json:"sha256"`
+	Size         int64     `json:"size"`
+	DownloadedAt time.Time `json:"downloadedAt"`
+}
+
+// Manifest is an append-only journal of entries, one JSON object per line.
+// Every entry is synced to disk once its file is in place so an interrupted
+// run resumes with exactly the items it completed. Later lines replace
+// earlier lines of the same ID.
+type Manifest struct {
+	mu      gosync.Mutex
+	entries map[string]Entry
+	journal *journal.Journal[Entry]
+}
+
+// OpenManifest loads the manifest at path, creating it on the first Add.
+func OpenManifest(path string) (*Manifest, error) {
+	m := &Manifest{entries: make(map[string]Entry)}
+
+	j, err := journal.Open(path, func(entry Entry) {
+		m.entries[entry.ID] = entry
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.journal = j
+
+	return m, nil
+}
+
+// Get returns the entry of the media item.
+func (m *Manifest) Get(id string) (Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[id]
+	return entry, ok
+}
+
+// Add appends the entry and syncs the manifest to disk.
+func (m *Manifest) Add(entry Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.journal.Append(entry); err != nil {
+		return err
+	}
+	m.entries[entry.ID] = entry
+
+	return nil
+}
+
+// Entries returns all entries ordered by creation time.
+func (m *Manifest) Entries() []Entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make([]Entry, 0, len(m.entries))
+	for _, entry := range m.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].CreationTime.Equal(entries[j].CreationTime) {
+			return entries[i].ID < entries[j].ID
+		}
+		return entries[i].CreationTime.Before(entries[j].CreationTime)
+	})
+
+	return entries
+}
+
+// Len returns the number of entries.
+func (m *Manifest) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.entries)
+}
+
+// Close closes the journal file.
+func (m *Manifest) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.journal.Close()
+}
@@ -0,0 +1,563 @@
+// Package sync mirrors a Photos library to local disk.
+//
+// Every run lists the library and downloads the originals of media items
+// which are not yet recorded in the directory's manifest, so later runs only
+// transfer the delta. Files are written under a temporary name and renamed
+// into place before their manifest entry is synced, which makes it safe to
+// interrupt a run and start it again. Album membership can be mirrored as
+// per-album directories of links to the downloaded files.
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/hooks"
+	"github.com/dlph/go-photoslibrary/layout"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+	"github.com/dlph/go-photoslibrary/xmp"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	DefaultConcurrency = 4
+
+	// partial downloads are named .gphotos-<name>.<random>.part, so only
+	// files of sync are removed after an interrupted run
+	partialFilePrefix = ".gphotos-"
+	partialFileExt    = ".part"
+)
+
+type Config struct {
+	dryRun        bool
+	concurrency   int
+	layout        *layout.Template
+	collision     layout.CollisionPolicy
+	linkMode      LinkMode
+	sidecars      bool
+	embed         bool
+	listRequest   mediaitems.ListMediaItemsRequest
+	afterDownload []hooks.AfterDownloadHook
+	onError       []hooks.ErrorHook
+}
+
+type Option func(*Config)
+
+// WithDryRun reports the planned downloads without writing anything.
+func WithDryRun() Option {
+	return func(c *Config) {
+		c.dryRun = true
+	}
+}
+
+// WithConcurrency sets the number of parallel downloads.
+func WithConcurrency(n int) Option {
+	return func(c *Config) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// WithLayout sets where media items are placed, layout.Default when unset.
+func WithLayout(t *layout.Template) Option {
+	return func(c *Config) {
+		c.layout = t
+	}
+}
+
+// WithCollisionPolicy sets what happens when two media items map to the same
+// path, layout.Suffix when unset.
+func WithCollisionPolicy(policy layout.CollisionPolicy) Option {
+	return func(c *Config) {
+		c.collision = policy
+	}
+}
+
+// WithAlbumLinks stores every media item once and mirrors album membership
+// as a directory per album below AlbumsDirName, linking to the canonical files.
+func WithAlbumLinks(mode LinkMode) Option {
+	return func(c *Config) {
+		c.linkMode = mode
+	}
+}
+
+// WithXMPSidecars writes an XMP sidecar next to every downloaded file with
+// the description, creation time, camera and album titles, which the
+// original bytes lack or may lack.
+func WithXMPSidecars() Option {
+	return func(c *Config) {
+		c.sidecars = true
+	}
+}
+
+// WithEmbeddedMetadata embeds the metadata of WithXMPSidecars into
+// downloaded JPEG files. Files which cannot be parsed are kept as downloaded.
+func WithEmbeddedMetadata() Option {
+	return func(c *Config) {
+		c.embed = true
+	}
+}
+
+// WithListRequest sets the request used to walk the library, e.g. to exclude
+// media items not created by the app.
+func WithListRequest(listRequest mediaitems.ListMediaItemsRequest) Option {
+	return func(c *Config) {
+		c.listRequest = listRequest
+	}
+}
+
+// WithAfterDownload runs h for every downloaded file before it is moved into
+// place, it may veto or rewrite the file. Hooks run after metadata is
+// embedded, the manifest records the content they leave.
+func WithAfterDownload(h hooks.AfterDownloadHook) Option {
+	return func(c *Config) {
+		c.afterDownload = append(c.afterDownload, h)
+	}
+}
+
+// WithErrorHook tells h about every failed download.
+func WithErrorHook(h hooks.ErrorHook) Option {
+	return func(c *Config) {
+		c.onError = append(c.onError, h)
+	}
+}
+
+// Report summarizes a run.
+type Report struct {
+	Listed     int
+	Skipped    int // already in the manifest
+	Downloaded int
+	Duplicates int // same content as the file already at the path, with layout.HashCompare or left by an interrupted run
+	Conflicts  int // not stored, with layout.Skip
+	Failed     int
+	Vetoed     int // rejected by an AfterDownload hook, downloaded again on the next run
+	Bytes      int64
+	Linked     int // album links created or updated, with WithAlbumLinks
+	Unlinked   int // album links removed, with WithAlbumLinks
+
+	// Planned are the entries which would be downloaded, only set for dry runs.
+	Planned []Entry
+	Errors  []*ItemError
+}
+
+// ItemError is a failed download of a single media item, the run continues with the next item.
+type ItemError struct {
+	ID  string
+	Err error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("media item %s: %v", e.ID, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+type syncer struct {
+	client   *http.Client
+	dir      string
+	cfg      *Config
+	manifest *Manifest
+	resolver *layout.Resolver
+}
+
+// Run downloads the media items which are not in the manifest of dir.
+// Failed items are listed in the report and retried on the next run, the
+// returned error is only set when listing the library fails or ctx is done.
+func Run(ctx context.Context, client *http.Client, dir string, opts ...Option) (Report, error) {
+	cfg := &Config{
+		concurrency: DefaultConcurrency,
+		layout:      layout.Default,
+		collision:   layout.Suffix,
+		listRequest: mediaitems.ListMediaItemsRequest{PageSize: api.MaxPageSize},
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var report Report
+
+	manifest, err := OpenManifest(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return report, err
+	}
+	defer manifest.Close()
+
+	if !cfg.dryRun {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return report, err
+		}
+		if err := removePartialFiles(dir); err != nil {
+			return report, err
+		}
+	}
+
+	s := &syncer{
+		client:   client,
+		dir:      dir,
+		cfg:      cfg,
+		manifest: manifest,
+		resolver: layout.NewResolver(dir),
+	}
+	for _, entry := range manifest.Entries() {
+		s.resolver.Claim(entry.Path, entry.ID)
+	}
+
+	var contents []albumContents
+	if cfg.layout.UsesAlbum() || cfg.linkMode != "" || cfg.sidecars || cfg.embed {
+		if contents, err = loadAlbums(ctx, client); err != nil {
+			return report, err
+		}
+	}
+	membership := albumMembership(contents)
+
+	type result struct {
+		entry     Entry
+		duplicate bool
+		vetoed    bool
+		conflict  bool
+		err       error
+	}
+
+	jobCh := make(chan job)
+	resultCh := make(chan result)
+
+	var wg gosync.WaitGroup
+	for i := 0; i < cfg.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobCh {
+				entry, duplicate, err := s.download(ctx, j)
+				switch {
+				case errors.Is(err, hooks.ErrSkip):
+					slog.DebugContext(ctx, "media item vetoed by hook", "id", j.item.ID, "reason", err)
+					resultCh <- result{vetoed: true}
+					continue
+				case errors.Is(err, errCollision):
+					slog.DebugContext(ctx, "skipping media item on path collision", "id", j.item.ID, "path", j.path)
+					resultCh <- result{conflict: true}
+					continue
+				case err != nil:
+					for _, h := range cfg.onError {
+						h.OnError(ctx, j.item, filepath.Join(dir, filepath.FromSlash(j.path)), err)
+					}
+					err = &ItemError{ID: j.item.ID, Err: err}
+				}
+				resultCh <- result{entry: entry, duplicate: duplicate, err: err}
+			}
+		}()
+	}
+
+	var (
+		listErr       error
+		listConflicts int // merged once resultCh is closed, workers count conflicts too
+	)
+	go func() {
+		defer func() {
+			close(jobCh)
+			wg.Wait()
+			close(resultCh)
+		}()
+
+		itemCh, errCh := mediaitems.List(ctx, client, cfg.listRequest)
+		for item := range itemCh {
+			report.Listed++
+
+			if _, ok := manifest.Get(item.ID); ok {
+				report.Skipped++
+				continue
+			}
+
+			titles := membership[item.ID]
+			album := ""
+			if len(titles) > 0 {
+				album = titles[0]
+			}
+
+			p, action := s.resolve(cfg.layout.Execute(item, album), item.ID)
+			if action == layout.SkipItem {
+				slog.DebugContext(ctx, "skipping media item on path collision", "id", item.ID, "path", p)
+				listConflicts++
+				continue
+			}
+
+			j := job{item: item, path: p, action: action, albums: titles}
+			if cfg.dryRun {
+				report.Planned = append(report.Planned, newEntry(j, "", 0))
+				continue
+			}
+
+			select {
+			case jobCh <- j:
+			case <-ctx.Done():
+			}
+		}
+
+		select {
+		case listErr = <-errCh:
+		default:
+		}
+	}()
+
+	for r := range resultCh {
+		var itemErr *ItemError
+		if errors.As(r.err, &itemErr) {
+			slog.DebugContext(ctx, "failed downloading media item", "id", itemErr.ID, "error", itemErr.Err)
+			report.Failed++
+			report.Errors = append(report.Errors, itemErr)
+			continue
+		}
+		if r.vetoed {
+			report.Vetoed++
+			continue
+		}
+		if r.conflict {
+			report.Conflicts++
+			continue
+		}
+		if r.duplicate {
+			report.Duplicates++
+			continue
+		}
+		report.Downloaded++
+		report.Bytes += r.entry.Size
+	}
+	report.Conflicts += listConflicts
+
+	if listErr != nil {
+		return report, listErr
+	}
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+
+	if cfg.linkMode != "" && !cfg.dryRun {
+		report.Linked, report.Unlinked, err = s.linkAlbums(ctx, contents)
+	}
+
+	return report, err
+}
+
+// errCollision reports that an item is not stored because of layout.Skip.
+var errCollision = errors.New("path collision")
+
+// resolve returns where to store the media item id which the layout placed
+// at p. A file at p which no manifest entry claims may have been renamed
+// into place by a run interrupted before recording it, so its content is
+// compared with the item's before the collision policy applies.
+func (s *syncer) resolve(p, id string) (string, layout.Action) {
+	if _, ok := s.resolver.Owner(p); !ok && !s.cfg.dryRun {
+		if _, err := os.Lstat(filepath.Join(s.dir, filepath.FromSlash(p))); err == nil {
+			return p, layout.CompareContent
+		}
+	}
+	return s.resolver.Resolve(p, id, s.cfg.collision)
+}
+
+type job struct {
+	item   mediaitems.MediaItem
+	path   string
+	action layout.Action
+	albums []string // titles
+}
+
+func newEntry(j job, sha256Sum string, size int64) Entry {
+	entry := Entry{
+		ID:       j.item.ID,
+		Filename: j.item.Filename,
+		Path:     j.path,
+		SHA256:   sha256Sum,
+		Size:     size,
+	}
+	if j.item.MediaMetadata != nil {
+		entry.CreationTime = j.item.MediaMetadata.CreationTime
+	}
+	return entry
+}
+
+// download fetches the original bytes into place and records the entry.
+// duplicate reports whether the content equals the file already at the path.
+func (s *syncer) download(ctx context.Context, j job) (entry Entry, duplicate bool, err error) {
+	dst := filepath.Join(s.dir, filepath.FromSlash(j.path))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return Entry{}, false, err
+	}
+
+	part, sum, n, err := s.fetch(ctx, &j, dst)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	defer os.Remove(part) // no-op once renamed
+
+	metadata := xmp.FromMediaItem(j.item, j.albums)
+	if s.cfg.embed && xmp.EmbedsJPEG(j.item.MimeType) {
+		if err := xmp.EmbedFile(part, metadata); err != nil {
+			slog.DebugContext(ctx, "failed embedding metadata", "id", j.item.ID, "error", err)
+		} else if sum, n, err = fileSHA256(part); err != nil {
+			return Entry{}, false, err
+		}
+	}
+
+	if len(s.cfg.afterDownload) > 0 {
+		for _, h := range s.cfg.afterDownload {
+			if err := h.AfterDownload(ctx, j.item, part); err != nil {
+				return Entry{}, false, err
+			}
+		}
+		if sum, n, err = fileSHA256(part); err != nil {
+			return Entry{}, false, err
+		}
+	}
+
+	if j.action == layout.CompareContent {
+		existingSum, _, err := fileSHA256(dst)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return Entry{}, false, err
+		}
+
+		if err == nil && existingSum == sum {
+			if _, ok := s.resolver.Owner(j.path); !ok {
+				s.resolver.Claim(j.path, j.item.ID) // adopted from an interrupted run
+			}
+			entry := newEntry(j, sum, n)
+			entry.DownloadedAt = time.Now().UTC()
+			return entry, true, s.manifest.Add(entry)
+		}
+
+		// differs, or the owner of the path is still downloading
+		policy := s.cfg.collision
+		if policy == layout.HashCompare {
+			policy = layout.Suffix
+		}
+		var action layout.Action
+		if j.path, action = s.resolver.Resolve(j.path, j.item.ID, policy); action == layout.SkipItem {
+			return Entry{}, false, errCollision
+		}
+		dst = filepath.Join(s.dir, filepath.FromSlash(j.path))
+	}
+
+	// the sidecar is written first, a file in place always has its sidecar
+	if s.cfg.sidecars {
+		if err := xmp.WriteSidecar(dst, metadata); err != nil {
+			return Entry{}, false, err
+		}
+	}
+
+	if err := os.Rename(part, dst); err != nil {
+		return Entry{}, false, err
+	}
+
+	entry = newEntry(j, sum, n)
+	entry.DownloadedAt = time.Now().UTC()
+
+	if !entry.CreationTime.IsZero() {
+		if err := os.Chtimes(dst, entry.CreationTime, entry.CreationTime); err != nil {
+			slog.DebugContext(ctx, "failed setting modification time", "path", dst, "error", err)
+		}
+	}
+
+	return entry, false, s.manifest.Add(entry)
+}
+
+// fetch downloads the item's original bytes to a partial file next to dst,
+// returning its name and the content's hex encoded SHA-256 and size. The
+// item is refreshed when its base url expired.
+func (s *syncer) fetch(ctx context.Context, j *job, dst string) (part string, sum string, n int64, err error) {
+	f, err := os.CreateTemp(filepath.Dir(dst), partialFilePrefix+filepath.Base(dst)+".*"+partialFileExt)
+	if err != nil {
+		return "", "", 0, err
+	}
+	part = f.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(part)
+		}
+	}()
+
+	h := sha256.New()
+	n, err = mediaitems.Download(ctx, s.client, j.item, io.MultiWriter(f, h))
+
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) {
+		// base urls expire after about an hour, refresh the item and retry once
+		slog.DebugContext(ctx, "refreshing media item base url", "id", j.item.ID, "error", err)
+		item, getErr := mediaitems.Get(ctx, s.client, mediaitems.GetMediaItemRequest{MediaItemID: j.item.ID})
+		if getErr != nil {
+			f.Close()
+			return "", "", 0, getErr
+		}
+		j.item = item
+
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return "", "", 0, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return "", "", 0, err
+		}
+		h.Reset()
+		n, err = mediaitems.Download(ctx, s.client, j.item, io.MultiWriter(f, h))
+	}
+	if err != nil {
+		f.Close()
+		return "", "", 0, err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return "", "", 0, err
+	}
+	if err := f.Close(); err != nil {
+		return "", "", 0, err
+	}
+
+	return part, hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// fileSHA256 returns the hex encoded SHA-256 and the size of the file's content.
+func fileSHA256(name string) (string, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// removePartialFiles deletes downloads left behind by an interrupted run.
+func removePartialFiles(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasPrefix(d.Name(), partialFilePrefix) && strings.HasSuffix(d.Name(), partialFileExt) {
+			return os.Remove(p)
+		}
+		return nil
+	})
+}
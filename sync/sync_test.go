@@ -0,0 +1,544 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/hooks"
+	"github.com/dlph/go-photoslibrary/layout"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+var _ http.RoundTripper = mockRoundTripper{}
+
+type mockRoundTripper struct {
+	roundTripperFn func(*http.Request) (*http.Response, error)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (mock mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return mock.roundTripperFn(req)
+}
+
+// mockLibrary serves mediaItems.list and base url downloads of its items.
+type mockLibrary struct {
+	mu        gosync.Mutex
+	items     []mediaitems.MediaItem
+	content   map[string]string // base url to bytes
+	albums    []albums.Album
+	members   map[string][]string // album id to media item ids
+	downloads int
+}
+
+func newMockLibrary(n int) *mockLibrary {
+	lib := &mockLibrary{content: make(map[string]string)}
+	for i := 0; i < n; i++ {
+		lib.add(string(rune('a'+i)), time.Date(2023, time.Month(i+1), 1, 0, 0, 0, 0, time.UTC))
+	}
+	return lib
+}
+
+func (lib *mockLibrary) add(id string, creationTime time.Time) {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	baseURL := "https://lh3.example.com/" + id
+	lib.items = append(lib.items, mediaitems.MediaItem{
+		ID:            id,
+		BaseURL:       baseURL,
+		MimeType:      "image/jpeg",
+		Filename:      "IMG.JPG", // same name for every item to exercise collisions
+		MediaMetadata: &mediaitems.MediaMetadata{CreationTime: creationTime},
+	})
+	lib.content[baseURL+"=d"] = "content of " + id
+}
+
+func (lib *mockLibrary) setAlbum(id, title string, itemIDs ...string) {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	if lib.members == nil {
+		lib.members = make(map[string][]string)
+	}
+	if _, ok := lib.members[id]; !ok {
+		lib.albums = append(lib.albums, albums.Album{ID: id, Title: title})
+	}
+	lib.members[id] = itemIDs
+}
+
+func (lib *mockLibrary) deleteAlbum(id string) {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	for i, album := range lib.albums {
+		if album.ID == id {
+			lib.albums = append(lib.albums[:i], lib.albums[i+1:]...)
+			break
+		}
+	}
+	delete(lib.members, id)
+}
+
+func (lib *mockLibrary) client() *http.Client {
+	return &http.Client{Transport: mockRoundTripper{roundTripperFn: func(req *http.Request) (*http.Response, error) {
+		lib.mu.Lock()
+		defer lib.mu.Unlock()
+
+		var resp any
+		switch req.URL.Path {
+		case "/v1/albums":
+			resp = &albums.ListAlbumsResponse{Albums: lib.albums}
+		case "/v1/mediaItems:search":
+			var searchReq mediaitems.SearchMediaItemRequest
+			if err := json.NewDecoder(req.Body).Decode(&searchReq); err != nil {
+				return nil, err
+			}
+			searchResp := &mediaitems.SearchMediaItemResponse{}
+			for _, id := range lib.members[searchReq.AlbumID] {
+				searchResp.MediaItems = append(searchResp.MediaItems, mediaitems.MediaItem{ID: id})
+			}
+			resp = searchResp
+		default:
+			resp = &mediaitems.ListMediaItemsResponse{MediaItems: lib.items}
+		}
+
+		var body []byte
+		if req.URL.Host == "lh3.example.com" {
+			lib.downloads++
+			body = []byte(lib.content[req.URL.String()])
+		} else {
+			data, err := json.Marshal(resp)
+			if err != nil {
+				return nil, err
+			}
+			body = data
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     map[string][]string{},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+			Request:    req,
+		}, nil
+	}}}
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	lib := newMockLibrary(3)
+	lib.add("d", time.Date(2023, time.January, 2, 0, 0, 0, 0, time.UTC)) // collides with a
+
+	report, err := Run(ctx, lib.client(), dir, WithDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Planned) != 4 || report.Downloaded != 0 {
+		t.Fatalf("dry run report %+v not expected", report)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ManifestFileName)); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote manifest, stat error %v", err)
+	}
+
+	report, err = Run(ctx, lib.client(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Downloaded != 4 || report.Failed != 0 {
+		t.Fatalf("report %+v not expected", report)
+	}
+
+	manifest, err := OpenManifest(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := manifest.Entries()
+	if len(entries) != 4 {
+		t.Fatalf("manifest entries %d not expected %d", len(entries), 4)
+	}
+	paths := make(map[string]bool)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(entry.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(data)
+		if entry.SHA256 != hex.EncodeToString(sum[:]) || string(data) != "content of "+entry.ID {
+			t.Errorf("entry %+v does not match file content %q", entry, data)
+		}
+		paths[entry.Path] = true
+	}
+	if !paths["2023/01/IMG.JPG"] || !paths["2023/01/IMG_1.JPG"] {
+		t.Errorf("colliding paths not suffixed %v", paths)
+	}
+
+	// only the delta is downloaded on the next run
+	lib.add("e", time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC))
+	lib.downloads = 0
+
+	report, err = Run(ctx, lib.client(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Downloaded != 1 || report.Skipped != 4 || lib.downloads != 1 {
+		t.Errorf("delta report %+v with %d downloads not expected", report, lib.downloads)
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	lib := newMockLibrary(2)
+
+	// an interrupted run completed item a, left a partial file and a torn
+	// manifest line, the user keeps a file of their own named .part
+	if err := os.MkdirAll(filepath.Join(dir, "2023", "01"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2023", "01", "IMG.JPG"), []byte("content of a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "2023", "02"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2023", "02", ".gphotos-IMG.JPG.123.part"), []byte("cont"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2023", "02", "notes.part"), []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	manifestData := `{"id":"a","filename":"IMG.JPG","path":"2023/01/IMG.JPG","size":12}` + "\n" + `{"id":"b","filena`
+	if err := os.WriteFile(filepath.Join(dir, ManifestFileName), []byte(manifestData), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(ctx, lib.client(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Downloaded != 1 || report.Skipped != 1 {
+		t.Errorf("resume report %+v not expected", report)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "2023", "02", "IMG.JPG")); err != nil || string(data) != "content of b" {
+		t.Errorf("resumed download %q, error %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2023", "02", ".gphotos-IMG.JPG.123.part")); !os.IsNotExist(err) {
+		t.Errorf("partial file not removed, stat error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2023", "02", "notes.part")); err != nil {
+		t.Errorf("file of the user removed, stat error %v", err)
+	}
+
+	manifest, err := OpenManifest(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := manifest.Get("b"); !ok || manifest.Len() != 2 {
+		t.Errorf("manifest entries %+v not expected after torn line", manifest.Entries())
+	}
+}
+
+func TestRunAdoptsUntracked(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	lib := newMockLibrary(2)
+
+	// an interrupted run renamed item b into place but did not record it,
+	// the file at item c's path is another
+	for month, content := range map[string]string{"02": "content of b", "03": "modified"} {
+		month := filepath.Join(dir, "2023", month)
+		if err := os.MkdirAll(month, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(month, "IMG.JPG"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lib.add("c", time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC))
+
+	report, err := Run(ctx, lib.client(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Downloaded != 2 || report.Duplicates != 1 {
+		t.Errorf("report %+v not expected", report)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2023", "02", "IMG_1.JPG")); !os.IsNotExist(err) {
+		t.Errorf("matching file downloaded again, stat error %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "2023", "03", "IMG_1.JPG")); err != nil || string(data) != "content of c" {
+		t.Errorf("differing file not suffixed, read %q, error %v", data, err)
+	}
+
+	manifest, err := OpenManifest(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := manifest.Get("b"); !ok || entry.Path != "2023/02/IMG.JPG" {
+		t.Errorf("adopted entry %+v not expected", entry)
+	}
+}
+
+func TestRunCollisionPolicies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lib := newMockLibrary(1)
+	lib.add("same", time.Date(2023, time.January, 2, 0, 0, 0, 0, time.UTC))
+	lib.content["https://lh3.example.com/same=d"] = "content of a"
+	lib.add("other", time.Date(2023, time.January, 3, 0, 0, 0, 0, time.UTC))
+
+	dir := t.TempDir()
+	report, err := Run(ctx, lib.client(), dir, WithConcurrency(1), WithCollisionPolicy(layout.HashCompare))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Downloaded != 2 || report.Duplicates != 1 {
+		t.Errorf("hash compare report %+v not expected", report)
+	}
+
+	dir = t.TempDir()
+	report, err = Run(ctx, lib.client(), dir, WithCollisionPolicy(layout.Skip), WithLayout(layout.MustParse("{{year}}/{{filename}}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Downloaded != 1 || report.Conflicts != 2 {
+		t.Errorf("skip report %+v not expected", report)
+	}
+}
+
+func TestRunConflictsCounted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 2022 items collide while listing, 2023 items with an untracked file
+	// while downloading
+	lib := newMockLibrary(2)
+	lib.add("c", time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC))
+	lib.add("d", time.Date(2022, time.February, 1, 0, 0, 0, 0, time.UTC))
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "2023"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2023", "IMG.JPG"), []byte("other"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(ctx, lib.client(), dir, WithConcurrency(4), WithCollisionPolicy(layout.Skip),
+		WithLayout(layout.MustParse("{{year}}/{{filename}}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Downloaded != 1 || report.Conflicts != 3 {
+		t.Errorf("report %+v not expected", report)
+	}
+}
+
+func TestRunAlbumLinks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	lib := newMockLibrary(3)
+	lib.setAlbum("1", "Trip", "a", "b")
+	lib.setAlbum("2", "Trip", "c")
+	lib.setAlbum("3", "Empty")
+
+	for _, mode := range []LinkMode{Symlink, Hardlink} {
+		report, err := Run(ctx, lib.client(), dir, WithAlbumLinks(mode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode == Symlink && report.Linked != 3 {
+			t.Errorf("%s report %+v not expected", mode, report)
+		}
+
+		for link, want := range map[string]string{
+			"albums/Trip/IMG.JPG":   "content of a",
+			"albums/Trip/IMG_1.JPG": "content of b",
+			"albums/Trip 2/IMG.JPG": "content of c",
+		} {
+			p := filepath.Join(dir, filepath.FromSlash(link))
+			data, err := os.ReadFile(p)
+			if err != nil || string(data) != want {
+				t.Errorf("%s link %s content %q, error %v", mode, link, data, err)
+			}
+			info, err := os.Lstat(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isSymlink := info.Mode()&os.ModeSymlink != 0; isSymlink != (mode == Symlink) {
+				t.Errorf("%s link %s has mode %v", mode, link, info.Mode())
+			}
+		}
+	}
+
+	// b leaves the album and the second album is deleted
+	lib.setAlbum("1", "Trip", "a")
+	lib.deleteAlbum("2")
+
+	report, err := Run(ctx, lib.client(), dir, WithAlbumLinks(Hardlink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Linked != 0 || report.Unlinked != 2 || report.Downloaded != 0 {
+		t.Errorf("update report %+v not expected", report)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "albums", "Trip", "IMG_1.JPG")); !os.IsNotExist(err) {
+		t.Errorf("link of removed member not deleted, stat error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "albums", "Trip 2")); !os.IsNotExist(err) {
+		t.Errorf("directory of deleted album not removed, stat error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2023", "02", "IMG.JPG")); err != nil {
+		t.Errorf("canonical file removed: %v", err)
+	}
+}
+
+func TestRunXMP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	lib := newMockLibrary(2)
+	lib.setAlbum("1", "Trip", "a")
+	lib.items[0].Description = "beach"
+
+	var photo bytes.Buffer
+	if err := jpeg.Encode(&photo, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	lib.content["https://lh3.example.com/a=d"] = photo.String()
+
+	report, err := Run(ctx, lib.client(), dir, WithXMPSidecars(), WithEmbeddedMetadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Downloaded != 2 || report.Failed != 0 {
+		t.Fatalf("report %+v not expected", report)
+	}
+
+	sidecar, err := os.ReadFile(filepath.Join(dir, "2023", "01", "IMG.JPG.xmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{">beach<", "<rdf:li>Trip</rdf:li>", "<xmp:CreateDate>2023-01-01T00:00:00Z</xmp:CreateDate>"} {
+		if !bytes.Contains(sidecar, []byte(want)) {
+			t.Errorf("sidecar lacks %s:\n%s", want, sidecar)
+		}
+	}
+
+	embedded, err := os.ReadFile(filepath.Join(dir, "2023", "01", "IMG.JPG"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(embedded, []byte(">beach<")) {
+		t.Error("metadata not embedded")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(embedded)); err != nil {
+		t.Errorf("embedded JPEG does not decode: %v", err)
+	}
+
+	manifest, err := OpenManifest(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manifest.Close()
+
+	entry, _ := manifest.Get("a")
+	if sum := sha256.Sum256(embedded); entry.SHA256 != hex.EncodeToString(sum[:]) || entry.Size != int64(len(embedded)) {
+		t.Errorf("entry %+v does not match the embedded file", entry)
+	}
+
+	// not a JPEG, kept as downloaded
+	if data, err := os.ReadFile(filepath.Join(dir, "2023", "02", "IMG.JPG")); err != nil || string(data) != "content of b" {
+		t.Errorf("unparsable file content %q, error %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2023", "02", "IMG.JPG.xmp")); err != nil {
+		t.Errorf("sidecar of unparsable file: %v", err)
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	lib := newMockLibrary(3)
+
+	var (
+		mu     gosync.Mutex
+		failed = make(map[string]string) // id to path
+	)
+	report, err := Run(ctx, lib.client(), dir,
+		WithAfterDownload(hooks.AfterDownloadFunc(func(ctx context.Context, item mediaitems.MediaItem, path string) error {
+			switch item.ID {
+			case "a":
+				return os.WriteFile(path, []byte("rewritten a"), 0o644)
+			case "b":
+				return hooks.ErrSkip
+			default:
+				return errors.New("scanner unavailable")
+			}
+		})),
+		WithErrorHook(hooks.ErrorFunc(func(ctx context.Context, item mediaitems.MediaItem, path string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed[item.ID] = path
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Downloaded != 1 || report.Vetoed != 1 || report.Failed != 1 {
+		t.Fatalf("report %+v not expected", report)
+	}
+	if len(failed) != 1 || failed["c"] != filepath.Join(dir, "2023", "03", "IMG.JPG") {
+		t.Errorf("error hook called with %v", failed)
+	}
+
+	manifest, err := OpenManifest(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manifest.Close()
+
+	if _, ok := manifest.Get("b"); ok {
+		t.Error("vetoed media item recorded in manifest")
+	}
+	entry, _ := manifest.Get("a")
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(entry.Path)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(data); string(data) != "rewritten a" || entry.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("entry %+v does not match the rewritten file %q", entry, data)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "2023", "02"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) || len(entries) != 0 {
+		t.Errorf("vetoed file left %v, error %v", entries, err)
+	}
+}
@@ -0,0 +1,396 @@
+package takeout
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	gosync "sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+	"github.com/dlph/go-photoslibrary/upload"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	DefaultConcurrency = 4
+
+	// MaxDescriptionLength is the longest description of a media item, in characters.
+	MaxDescriptionLength = 1000
+)
+
+type Config struct {
+	dryRun      bool
+	concurrency int
+	ledger      *upload.Ledger
+}
+
+type Option func(*Config)
+
+// WithDryRun reports the planned uploads and albums without changing the library.
+func WithDryRun() Option {
+	return func(c *Config) {
+		c.dryRun = true
+	}
+}
+
+// WithConcurrency sets the number of parallel uploads.
+func WithConcurrency(n int) Option {
+	return func(c *Config) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// WithLedger skips media files whose content the ledger records as uploaded
+// and records the files which are uploaded, so an import can be resumed or
+// repeated with a later export.
+func WithLedger(l *upload.Ledger) Option {
+	return func(c *Config) {
+		c.ledger = l
+	}
+}
+
+// Result is the outcome of a single file of the export.
+type Result struct {
+	Path        string        `json:"path"`
+	Filename    string        `json:"filename,omitempty"`
+	Albums      []string      `json:"albums,omitempty"`
+	HasSidecar  bool          `json:"hasSidecar"`
+	MediaItemID string        `json:"mediaItemId,omitempty"`
+	Status      upload.Status `json:"status"`
+	Message     string        `json:"message,omitempty"`
+}
+
+// Report summarizes an import.
+type Report struct {
+	Created    int
+	Duplicates int // uploaded before, with WithLedger
+	Skipped    int
+	Failed     int
+	Bytes      int64 // of the created media items
+	Unpaired   int   // media files without sidecar, uploaded without description
+
+	AlbumsCreated []string
+	// Results has an entry for every media item and unsupported file of the
+	// export, in the order of Library.Items followed by Library.Unsupported.
+	Results []Result
+}
+
+type importer struct {
+	client *http.Client
+	cfg    *Config
+
+	results map[*Item]*Result
+}
+
+// Import uploads the media files of the export with the descriptions of
+// their sidecars and recreates its albums, adding every media file in the
+// order it was taken. The library derives the creation time of media items
+// from the files, the sidecar times only order the albums.
+func Import(ctx context.Context, client *http.Client, archive *Archive, opts ...Option) (Report, error) {
+	cfg := &Config{
+		concurrency: DefaultConcurrency,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var report Report
+
+	lib, err := archive.Scan()
+	if err != nil {
+		return report, err
+	}
+
+	imp := &importer{client: client, cfg: cfg, results: make(map[*Item]*Result, len(lib.Items))}
+
+	var pending []*Item
+	for _, item := range lib.Items {
+		r := &Result{
+			Path:       item.Path,
+			Filename:   item.Filename(),
+			Albums:     item.Albums,
+			HasSidecar: item.Metadata != nil,
+		}
+		imp.results[item] = r
+
+		switch {
+		case item.Size == 0:
+			r.Status, r.Message = upload.StatusSkipped, "empty file"
+			continue
+		case item.Size > maxSize(item.MimeType):
+			r.Status, r.Message = upload.StatusSkipped, "file too large"
+			continue
+		}
+
+		if cfg.ledger != nil {
+			if entry, ok := cfg.ledger.Get(item.SHA256); ok {
+				r.Status, r.MediaItemID = upload.StatusDuplicate, entry.MediaItemID
+				continue
+			}
+		}
+
+		if cfg.dryRun {
+			r.Status = upload.StatusPlanned
+			continue
+		}
+		pending = append(pending, item)
+	}
+
+	titles := make([]string, 0, len(lib.Albums))
+	for _, album := range lib.Albums {
+		titles = append(titles, album.Title)
+	}
+	albumIDs, created, err := upload.EnsureAlbums(ctx, client, titles, cfg.dryRun)
+	if err != nil {
+		return report, err
+	}
+	report.AlbumsCreated = created
+
+	if !cfg.dryRun {
+		imp.upload(ctx, pending)
+		for _, album := range lib.Albums {
+			if ctx.Err() != nil {
+				break
+			}
+			imp.addToAlbum(ctx, album, albumIDs[album.Title])
+		}
+	}
+
+	for _, item := range lib.Items {
+		r := imp.results[item]
+		report.Results = append(report.Results, *r)
+
+		if !r.HasSidecar {
+			report.Unpaired++
+		}
+		switch r.Status {
+		case upload.StatusCreated:
+			report.Created++
+			report.Bytes += item.Size
+		case upload.StatusDuplicate:
+			report.Duplicates++
+		case upload.StatusSkipped:
+			report.Skipped++
+		case upload.StatusFailed:
+			report.Failed++
+		}
+	}
+	for _, p := range lib.Unsupported {
+		report.Results = append(report.Results, Result{Path: p, Status: upload.StatusSkipped, Message: "unsupported file type"})
+		report.Skipped++
+	}
+
+	return report, ctx.Err()
+}
+
+// upload uploads the items concurrently and creates their media items in
+// batches of api.MaxBatchCreateSize.
+func (imp *importer) upload(ctx context.Context, items []*Item) {
+	type uploaded struct {
+		item        *Item
+		uploadToken string
+		err         error
+	}
+
+	itemCh := make(chan *Item)
+	uploadedCh := make(chan uploaded)
+
+	var wg gosync.WaitGroup
+	for i := 0; i < imp.cfg.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range itemCh {
+				uploadToken, err := uploadItem(ctx, imp.client, item)
+				uploadedCh <- uploaded{item: item, uploadToken: uploadToken, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer func() {
+			close(itemCh)
+			wg.Wait()
+			close(uploadedCh)
+		}()
+
+		for _, item := range items {
+			select {
+			case itemCh <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var batch []uploaded
+	create := func() {
+		req := mediaitems.BatchCreateMediaItemsRequest{}
+		byToken := make(map[string]*Item, len(batch))
+		for _, u := range batch {
+			req.NewMediaItems = append(req.NewMediaItems, mediaitems.NewMediaItem{
+				Description: truncateDescription(u.item.Description()),
+				SimpleMediaItem: mediaitems.SimpleMediaItem{
+					UploadToken: u.uploadToken,
+					FileName:    u.item.Filename(),
+				},
+			})
+			byToken[u.uploadToken] = u.item
+		}
+		batch = batch[:0]
+
+		resp, err := mediaitems.BatchCreate(ctx, imp.client, req)
+		if err != nil {
+			slog.DebugContext(ctx, "failed creating media items", "error", err)
+			for _, item := range byToken {
+				r := imp.results[item]
+				r.Status, r.Message = upload.StatusFailed, err.Error()
+			}
+			return
+		}
+
+		for _, result := range resp.NewMediaItemResults {
+			item, ok := byToken[result.UploadToken]
+			if !ok {
+				continue
+			}
+			delete(byToken, result.UploadToken)
+
+			r := imp.results[item]
+			if !result.Succeeded() {
+				r.Status, r.Message = upload.StatusFailed, result.Status.Message
+				continue
+			}
+
+			r.Status, r.MediaItemID = upload.StatusCreated, result.MediaItem.ID
+			if err := imp.record(item, r.MediaItemID, ""); err != nil {
+				r.Message = "not recorded in ledger: " + err.Error()
+			}
+		}
+		for _, item := range byToken {
+			r := imp.results[item]
+			r.Status, r.Message = upload.StatusFailed, "missing from batch create response"
+		}
+	}
+
+	for u := range uploadedCh {
+		if u.err != nil {
+			r := imp.results[u.item]
+			r.Status, r.Message = upload.StatusFailed, u.err.Error()
+			continue
+		}
+
+		batch = append(batch, u)
+		if len(batch) == api.MaxBatchCreateSize {
+			create()
+		}
+	}
+	if len(batch) > 0 && ctx.Err() == nil {
+		create()
+	}
+}
+
+// addToAlbum adds the album's media items which are not in it yet, in order.
+func (imp *importer) addToAlbum(ctx context.Context, album *Album, albumID string) {
+	var ids []string
+	var added []*Item
+	for _, item := range album.Items {
+		r := imp.results[item]
+		if r.MediaItemID == "" {
+			continue
+		}
+		if imp.cfg.ledger != nil {
+			if entry, ok := imp.cfg.ledger.Get(item.SHA256); ok && entry.InAlbum(albumID) {
+				continue
+			}
+		}
+		ids = append(ids, r.MediaItemID)
+		added = append(added, item)
+	}
+
+	for start := 0; start < len(ids); start += api.MaxBatchAddMediaItemsSize {
+		end := start + api.MaxBatchAddMediaItemsSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		err := albums.BatchAddMediaItems(ctx, imp.client, albums.BatchAddMediaItemsRequest{
+			AlbumID:      albumID,
+			MediaItemIDs: ids[start:end],
+		})
+		for _, item := range added[start:end] {
+			r := imp.results[item]
+			if err != nil {
+				r.Message = fmt.Sprintf("not added to album %q: %v", album.Title, err)
+				continue
+			}
+			if err := imp.record(item, r.MediaItemID, albumID); err != nil {
+				r.Message = "not recorded in ledger: " + err.Error()
+			}
+		}
+	}
+}
+
+// record adds the item's media item to the ledger, and the album to its entry.
+func (imp *importer) record(item *Item, mediaItemID, albumID string) error {
+	ledger := imp.cfg.ledger
+	if ledger == nil {
+		return nil
+	}
+
+	entry, ok := ledger.Get(item.SHA256)
+	if !ok {
+		entry = upload.LedgerEntry{
+			SHA256:      item.SHA256,
+			Size:        item.Size,
+			Path:        item.Path,
+			MediaItemID: mediaItemID,
+			UploadedAt:  time.Now().UTC(),
+		}
+	}
+	if albumID != "" && !entry.InAlbum(albumID) {
+		entry.AlbumIDs = append(entry.AlbumIDs, albumID)
+	}
+
+	return ledger.Add(entry)
+}
+
+// uploadItem uploads the item's bytes, returning the upload token.
+func uploadItem(ctx context.Context, client *http.Client, item *Item) (string, error) {
+	f, err := item.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return mediaitems.Upload(ctx, client, mediaitems.UploadRequest{
+		Filename: item.Path,
+		MimeType: item.MimeType,
+		Content:  f,
+	})
+}
+
+func maxSize(mimeType string) int64 {
+	if strings.HasPrefix(mimeType, mediaitems.VideoMimeTypePrefix) {
+		return upload.MaxVideoSize
+	}
+	return upload.MaxPhotoSize
+}
+
+// truncateDescription cuts the description to MaxDescriptionLength characters.
+func truncateDescription(description string) string {
+	if utf8.RuneCountInString(description) <= MaxDescriptionLength {
+		return description
+	}
+	runes := []rune(description)
+	return string(runes[:MaxDescriptionLength])
+}
@@ -0,0 +1,214 @@
+package takeout
+
+import (
+	"encoding/json"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sidecarExt   = ".json"
+	editedSuffix = "-edited"
+
+	// albumMetadataName describes the album of its folder.
+	albumMetadataName = "metadata.json"
+
+	// maxSidecarStem is the length Takeout truncates sidecar names to, without extension.
+	maxSidecarStem = 46
+)
+
+// Metadata is the content of a media file's .json sidecar.
+type Metadata struct {
+	Title          string    `json:"title"`
+	Description    string    `json:"description"`
+	PhotoTakenTime Timestamp `json:"photoTakenTime"`
+	CreationTime   Timestamp `json:"creationTime"`
+	GeoData        GeoData   `json:"geoData"`
+	Favorited      bool      `json:"favorited"`
+}
+
+// Timestamp is a time as Takeout writes it, in seconds since the epoch.
+type Timestamp struct {
+	Timestamp string `json:"timestamp"`
+	Formatted string `json:"formatted"`
+}
+
+// Time returns the timestamp, the zero time when it is unset or invalid.
+func (t Timestamp) Time() time.Time {
+	seconds, err := strconv.ParseInt(t.Timestamp, 10, 64)
+	if err != nil || seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0).UTC()
+}
+
+type GeoData struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude"`
+}
+
+// albumMetadata is the content of an album folder's metadata.json.
+type albumMetadata struct {
+	Title string `json:"title"`
+}
+
+var (
+	// numberedName matches the names Takeout gives files sharing a name, IMG(1).jpg.
+	numberedName = regexp.MustCompile(`^(.*)(\(\d+\))(\.[^.]*)$`)
+	// dateFolderName matches the folders Takeout groups media by year in, they are no albums.
+	dateFolderName = regexp.MustCompile(`^Photos from \d{4}$`)
+)
+
+// specialFolderNames are folders of media which are in no album.
+var specialFolderNames = map[string]bool{
+	"Archive":       true,
+	"Bin":           true,
+	"Trash":         true,
+	"Failed Videos": true,
+}
+
+// sidecars pairs the media files of a folder with their sidecars, which
+// may be in any part of the export.
+type sidecars struct {
+	dir     string
+	sorted  []string             // the folder's .json files
+	parts   map[string]fs.FS     // name of a sidecar to the first part holding it
+	byTitle map[string]*Metadata // parsed on demand, titles shared by several sidecars map to nil
+}
+
+func newSidecars(dir string, files []partFile) *sidecars {
+	s := &sidecars{dir: dir, parts: make(map[string]fs.FS, len(files))}
+	for _, f := range files {
+		if _, ok := s.parts[f.name]; !ok {
+			s.parts[f.name] = f.fsys
+			s.sorted = append(s.sorted, f.name)
+		}
+	}
+	sort.Strings(s.sorted)
+	return s
+}
+
+// lookup returns the metadata of the media file, nil when it has no sidecar.
+func (s *sidecars) lookup(name string) (*Metadata, error) {
+	names := []string{name}
+	// IMG-edited.jpg is described by the sidecar of IMG.jpg
+	if original, ok := unedited(name); ok {
+		names = append(names, original)
+	}
+
+	for _, name := range names {
+		for _, candidate := range candidates(name) {
+			if _, ok := s.parts[candidate]; ok {
+				return s.read(candidate)
+			}
+		}
+
+		// newer exports name sidecars IMG.jpg.supplemental-metadata.json, truncated to fit
+		for _, sidecar := range s.sorted {
+			stem := strings.TrimSuffix(sidecar, sidecarExt)
+			if strings.HasPrefix(stem, name+".") {
+				return s.read(sidecar)
+			}
+		}
+	}
+
+	// last resort, the sidecar names the file it belongs to
+	if s.byTitle == nil {
+		s.byTitle = make(map[string]*Metadata)
+		for _, sidecar := range s.sorted {
+			if sidecar == albumMetadataName {
+				continue
+			}
+			metadata, err := s.read(sidecar)
+			if err != nil {
+				continue // only unpaired files are looked up by title
+			}
+			if _, ok := s.byTitle[metadata.Title]; ok {
+				s.byTitle[metadata.Title] = nil
+				continue
+			}
+			s.byTitle[metadata.Title] = metadata
+		}
+	}
+	return s.byTitle[name], nil
+}
+
+func (s *sidecars) read(name string) (*Metadata, error) {
+	data, err := fs.ReadFile(s.parts[name], path.Join(s.dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, &fs.PathError{Op: "parse", Path: path.Join(s.dir, name), Err: err}
+	}
+	return &metadata, nil
+}
+
+// candidates returns the sidecar names Takeout uses for the media file, in
+// order of preference.
+func candidates(name string) []string {
+	names := []string{name + sidecarExt}
+
+	// IMG(1).jpg is described by IMG.jpg(1).json
+	if m := numberedName.FindStringSubmatch(name); m != nil {
+		names = append(names, m[1]+m[3]+m[2]+sidecarExt)
+	}
+
+	// long names are truncated
+	if len(name) > maxSidecarStem {
+		names = append(names, truncate(name, maxSidecarStem)+sidecarExt)
+	}
+
+	return names
+}
+
+// unedited returns the name of the original of an edited media file.
+func unedited(name string) (string, bool) {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if !strings.HasSuffix(base, editedSuffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(base, editedSuffix) + ext, true
+}
+
+// truncate cuts s to at most n bytes, as Takeout does.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// albumTitle returns the album of the media in dir, "" when they are in none.
+// The title is read from metadata.json in part, which is nil when there is none.
+func albumTitle(part fs.FS, dir string) (string, error) {
+	if part != nil {
+		data, err := fs.ReadFile(part, path.Join(dir, albumMetadataName))
+		if err != nil {
+			return "", err
+		}
+
+		var metadata albumMetadata
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			return "", &fs.PathError{Op: "parse", Path: path.Join(dir, albumMetadataName), Err: err}
+		}
+		if metadata.Title != "" {
+			return metadata.Title, nil
+		}
+	}
+
+	name := path.Base(dir)
+	if dir == "." || dateFolderName.MatchString(name) || specialFolderNames[name] {
+		return "", nil
+	}
+	return name, nil
+}
@@ -0,0 +1,292 @@
+// Package takeout imports Google Takeout exports of Google Photos.
+//
+// An export is a set of zip archives, or the folders they extract to. Every
+// media file has a .json sidecar holding what the file itself lost, such as
+// its description, and every album is a folder. The same media file is
+// usually exported twice, in its year folder and in its album folder, so
+// files are identified by content.
+package takeout
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/upload"
+)
+
+// Archive is a Takeout export, possibly split into several parts.
+type Archive struct {
+	parts   []fs.FS
+	closers []io.Closer
+}
+
+// Open opens the zip archives or extracted folders of an export.
+func Open(names ...string) (*Archive, error) {
+	a := &Archive{}
+
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			a.Close()
+			return nil, err
+		}
+
+		if info.IsDir() {
+			a.parts = append(a.parts, os.DirFS(name))
+			continue
+		}
+
+		r, err := zip.OpenReader(name)
+		if err != nil {
+			a.Close()
+			return nil, err
+		}
+		a.parts = append(a.parts, r)
+		a.closers = append(a.closers, r)
+	}
+
+	return a, nil
+}
+
+// NewArchive returns an archive of already opened parts.
+func NewArchive(parts ...fs.FS) *Archive {
+	return &Archive{parts: parts}
+}
+
+// Close closes the zip archives.
+func (a *Archive) Close() error {
+	var errs []error
+	for _, c := range a.closers {
+		errs = append(errs, c.Close())
+	}
+	a.closers = nil
+	return errors.Join(errs...)
+}
+
+// Item is a media file of the export.
+type Item struct {
+	// Path is where the file was found first, slash separated and relative to its part.
+	Path     string
+	Size     int64
+	MimeType string
+	SHA256   string
+	// Metadata is the content of the sidecar, nil when none was found.
+	Metadata *Metadata
+	// Albums are the titles of the albums the file was exported in.
+	Albums []string
+
+	fsys fs.FS
+}
+
+// Filename returns the original filename, which Takeout may have truncated
+// or numbered in Path. Edited files keep their name, their sidecar is the
+// original's.
+func (it *Item) Filename() string {
+	name := path.Base(it.Path)
+	if _, edited := unedited(name); edited || it.Metadata == nil || path.Ext(it.Metadata.Title) == "" {
+		return name
+	}
+	return it.Metadata.Title
+}
+
+// Description returns the description from the sidecar.
+func (it *Item) Description() string {
+	if it.Metadata == nil {
+		return ""
+	}
+	return it.Metadata.Description
+}
+
+// TakenTime returns when the photo was taken according to the sidecar, the
+// zero time when unknown.
+func (it *Item) TakenTime() time.Time {
+	if it.Metadata == nil {
+		return time.Time{}
+	}
+	return it.Metadata.PhotoTakenTime.Time()
+}
+
+// Open opens the file's content.
+func (it *Item) Open() (fs.File, error) {
+	return it.fsys.Open(it.Path)
+}
+
+// Album is an album folder of the export.
+type Album struct {
+	Title string
+	// Items are ordered by the time they were taken.
+	Items []*Item
+}
+
+// Library is the content of an export.
+type Library struct {
+	// Items are ordered by path.
+	Items []*Item
+	// Albums are ordered by title.
+	Albums []*Album
+	// Unsupported are the paths of files which are no media the library accepts.
+	Unsupported []string
+}
+
+// Scan reads the export, pairing media files with their sidecars and album
+// folders. Every file is read to identify duplicates by content.
+func (a *Archive) Scan() (*Library, error) {
+	lib := &Library{}
+	items := make(map[string]*Item) // sha256 to item
+	albumItems := make(map[string][]*Item)
+
+	// a folder may be split across parts, with a media file and its sidecar
+	// in different parts
+	dirs := make(map[string]*folder)
+	var dirNames []string
+
+	for _, fsys := range a.parts {
+		err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+
+			dir, name := path.Split(p)
+			dir = path.Clean(dir)
+			f, ok := dirs[dir]
+			if !ok {
+				f = &folder{}
+				dirs[dir] = f
+				dirNames = append(dirNames, dir)
+			}
+
+			switch {
+			case name == albumMetadataName:
+				if f.metadata == nil {
+					f.metadata = fsys
+				}
+			case strings.EqualFold(path.Ext(name), sidecarExt):
+				f.sidecars = append(f.sidecars, partFile{fsys: fsys, name: name})
+			case upload.MimeType(name) != "":
+				f.media = append(f.media, partFile{fsys: fsys, name: name})
+			default:
+				lib.Unsupported = append(lib.Unsupported, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, dir := range dirNames {
+		f := dirs[dir]
+		if len(f.media) == 0 {
+			continue
+		}
+
+		title, err := albumTitle(f.metadata, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		sc := newSidecars(dir, f.sidecars)
+		for _, media := range f.media {
+			p := path.Join(dir, media.name)
+
+			sum, size, err := hashFile(media.fsys, p)
+			if err != nil {
+				return nil, err
+			}
+
+			item, ok := items[sum]
+			if !ok {
+				item = &Item{
+					Path:     p,
+					Size:     size,
+					MimeType: upload.MimeType(media.name),
+					SHA256:   sum,
+					fsys:     media.fsys,
+				}
+				items[sum] = item
+				lib.Items = append(lib.Items, item)
+			}
+
+			if item.Metadata == nil {
+				if item.Metadata, err = sc.lookup(media.name); err != nil {
+					return nil, err
+				}
+			}
+
+			if title != "" && !contains(item.Albums, title) {
+				item.Albums = append(item.Albums, title)
+				albumItems[title] = append(albumItems[title], item)
+			}
+		}
+	}
+
+	sort.Slice(lib.Items, func(i, j int) bool {
+		return lib.Items[i].Path < lib.Items[j].Path
+	})
+
+	for title, items := range albumItems {
+		sort.SliceStable(items, func(i, j int) bool {
+			ti, tj := items[i].TakenTime(), items[j].TakenTime()
+			if ti.Equal(tj) {
+				return items[i].Path < items[j].Path
+			}
+			return ti.Before(tj)
+		})
+		lib.Albums = append(lib.Albums, &Album{Title: title, Items: items})
+	}
+	sort.Slice(lib.Albums, func(i, j int) bool {
+		return lib.Albums[i].Title < lib.Albums[j].Title
+	})
+
+	return lib, nil
+}
+
+// folder collects the files of a directory in every part by kind.
+type folder struct {
+	media    []partFile
+	sidecars []partFile
+	metadata fs.FS // the part holding metadata.json, nil when there is none
+}
+
+// partFile is a file of a folder in one part of the export.
+type partFile struct {
+	fsys fs.FS
+	name string
+}
+
+func hashFile(fsys fs.FS, name string) (sum string, size int64, err error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err = io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
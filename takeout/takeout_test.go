@@ -0,0 +1,272 @@
+package takeout
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+	"github.com/dlph/go-photoslibrary/upload"
+)
+
+var _ http.RoundTripper = mockRoundTripper{}
+
+type mockRoundTripper struct {
+	roundTripperFn func(*http.Request) (*http.Response, error)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (mock mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return mock.roundTripperFn(req)
+}
+
+func sidecar(title, description string, taken int) *fstest.MapFile {
+	data, _ := json.Marshal(map[string]any{
+		"title":          title,
+		"description":    description,
+		"photoTakenTime": map[string]string{"timestamp": fmt.Sprint(taken)},
+	})
+	return &fstest.MapFile{Data: data}
+}
+
+const longName = "a_very_long_file_name_exported_by_takeout_0123456789.jpg"
+
+// testExport is an export with a year folder and two album folders.
+func testExport() fstest.MapFS {
+	const root = "Takeout/Google Photos/"
+	return fstest.MapFS{
+		root + "Photos from 2019/IMG_1.jpg":                            {Data: []byte("one")},
+		root + "Photos from 2019/IMG_1.jpg.json":                       sidecar("IMG_1.jpg", "first", 300),
+		root + "Photos from 2019/IMG_1(1).jpg":                         {Data: []byte("one again")},
+		root + "Photos from 2019/IMG_1.jpg(1).json":                    sidecar("IMG_1.jpg", "second", 200),
+		root + "Photos from 2019/IMG_2-edited.jpg":                     {Data: []byte("two edited")},
+		root + "Photos from 2019/IMG_2.jpg.supplemental-metadata.json": sidecar("IMG_2.jpg", "edited", 100),
+		root + "Photos from 2019/" + longName:                          {Data: []byte("long")},
+		root + "Photos from 2019/" + longName[:46] + ".json":           sidecar(longName, "long", 400),
+		root + "Photos from 2019/renamed.jpg":                          {Data: []byte("renamed")},
+		root + "Photos from 2019/other.json":                           sidecar("renamed.jpg", "by title", 500),
+		root + "Photos from 2019/notes.txt":                            {Data: []byte("notes")},
+		root + "Trip/metadata.json":                                    {Data: []byte(`{"title":"Trip 2019"}`)},
+		root + "Trip/IMG_1.jpg":                                        {Data: []byte("one")},
+		root + "Trip/IMG_1(1).jpg":                                     {Data: []byte("one again")},
+		root + "Old Album/unpaired.jpg":                                {Data: []byte("unpaired")},
+	}
+}
+
+func TestScan(t *testing.T) {
+	lib, err := NewArchive(testExport()).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lib.Items) != 6 {
+		t.Fatalf("items %d not expected %d", len(lib.Items), 6)
+	}
+	descriptions := make(map[string]string)
+	for _, item := range lib.Items {
+		descriptions[item.Filename()] = item.Description()
+	}
+	for filename, want := range map[string]string{
+		"IMG_1.jpg":        "first",
+		"IMG_2-edited.jpg": "edited",
+		longName:           "long",
+		"renamed.jpg":      "by title",
+		"unpaired.jpg":     "",
+	} {
+		if got, ok := descriptions[filename]; !ok || got != want {
+			t.Errorf("description of %s %q not expected %q", filename, got, want)
+		}
+	}
+
+	if len(lib.Albums) != 2 || lib.Albums[0].Title != "Old Album" || lib.Albums[1].Title != "Trip 2019" {
+		t.Fatalf("albums %+v not expected", lib.Albums)
+	}
+	trip := lib.Albums[1]
+	if len(trip.Items) != 2 || trip.Items[0].Description() != "second" {
+		t.Errorf("album items not ordered by taken time")
+	}
+	if len(lib.Unsupported) != 1 {
+		t.Errorf("unsupported files %v not expected", lib.Unsupported)
+	}
+}
+
+func TestScanParts(t *testing.T) {
+	// Takeout splits large exports at arbitrary files, so a folder, a media
+	// file and its sidecar may be in different parts
+	const root = "Takeout/Google Photos/"
+	first := fstest.MapFS{
+		root + "Trip/IMG_1.jpg":      {Data: []byte("one")},
+		root + "Trip/IMG_2.jpg.json": sidecar("IMG_2.jpg", "second", 200),
+	}
+	second := fstest.MapFS{
+		root + "Trip/metadata.json":  {Data: []byte(`{"title":"Trip 2019"}`)},
+		root + "Trip/IMG_1.jpg.json": sidecar("IMG_1.jpg", "first", 100),
+		root + "Trip/IMG_2.jpg":      {Data: []byte("two")},
+	}
+
+	lib, err := NewArchive(first, second).Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lib.Albums) != 1 || lib.Albums[0].Title != "Trip 2019" {
+		t.Fatalf("albums %+v not expected", lib.Albums)
+	}
+	items := lib.Albums[0].Items
+	if len(items) != 2 || items[0].Description() != "first" || items[1].Description() != "second" {
+		t.Errorf("sidecars not paired across parts")
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu gosync.Mutex
+	var created []mediaitems.NewMediaItem
+	added := make(map[string][]string)
+	var albumList []albums.Album
+
+	client := &http.Client{Transport: mockRoundTripper{roundTripperFn: func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var resp any
+		route := req.Method + " " + req.URL.Path
+		switch {
+		case route == "GET /v1/albums":
+			resp = &albums.ListAlbumsResponse{Albums: albumList}
+		case route == "POST /v1/albums":
+			var createReq albums.CreateAlbumRequest
+			if err := json.NewDecoder(req.Body).Decode(&createReq); err != nil {
+				return nil, err
+			}
+			album := albums.Album{ID: fmt.Sprintf("album-%d", len(albumList)+1), Title: createReq.Album.Title}
+			albumList = append(albumList, album)
+			resp = &album
+		case route == "POST /v1/uploads":
+			content, err := io.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     map[string][]string{},
+				Body:       io.NopCloser(bytes.NewReader(append([]byte("token:"), content...))),
+				Request:    req,
+			}, nil
+		case route == "POST /v1/mediaItems:batchCreate":
+			var batchReq mediaitems.BatchCreateMediaItemsRequest
+			if err := json.NewDecoder(req.Body).Decode(&batchReq); err != nil {
+				return nil, err
+			}
+			batchResp := &mediaitems.BatchCreateMediaItemsResponse{}
+			for _, newItem := range batchReq.NewMediaItems {
+				created = append(created, newItem)
+				batchResp.NewMediaItemResults = append(batchResp.NewMediaItemResults, mediaitems.NewMediaItemResult{
+					UploadToken: newItem.SimpleMediaItem.UploadToken,
+					MediaItem:   mediaitems.MediaItem{ID: strings.TrimPrefix(newItem.SimpleMediaItem.UploadToken, "token:")},
+				})
+			}
+			resp = batchResp
+		case strings.HasSuffix(route, ":batchAddMediaItems"):
+			var addReq albums.BatchAddMediaItemsRequest
+			if err := json.NewDecoder(req.Body).Decode(&addReq); err != nil {
+				return nil, err
+			}
+			albumID := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/v1/albums/"), ":batchAddMediaItems")
+			added[albumID] = append(added[albumID], addReq.MediaItemIDs...)
+			resp = struct{}{}
+		default:
+			return nil, fmt.Errorf("unexpected request %s %s", req.Method, req.URL)
+		}
+
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     map[string][]string{},
+			Body:       io.NopCloser(bytes.NewReader(data)),
+			Request:    req,
+		}, nil
+	}}}
+
+	// the export as a zip archive
+	name := filepath.Join(t.TempDir(), "takeout-001.zip")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for p, file := range testExport() {
+		w, err := zw.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(file.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	ledger, err := upload.OpenLedger(filepath.Join(t.TempDir(), upload.LedgerFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	report, err := Import(ctx, client, archive, WithLedger(ledger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 6 || report.Unpaired != 1 || report.Skipped != 1 || len(report.AlbumsCreated) != 2 {
+		t.Errorf("report %+v not expected", report)
+	}
+
+	descriptions := make(map[string]string)
+	for _, newItem := range created {
+		descriptions[newItem.SimpleMediaItem.FileName] = newItem.Description
+	}
+	if descriptions["IMG_1.jpg"] == "" || descriptions[longName] != "long" {
+		t.Errorf("descriptions %v not restored", descriptions)
+	}
+
+	// album-2 is Trip 2019, created after Old Album
+	if got := strings.Join(added["album-2"], ","); got != "one again,one" {
+		t.Errorf("album items %s not in taken order", got)
+	}
+
+	// importing again changes nothing
+	created = nil
+	report, err = Import(ctx, client, archive, WithLedger(ledger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 0 || report.Duplicates != 6 || len(created) != 0 || len(added["album-2"]) != 2 {
+		t.Errorf("repeated import report %+v not expected", report)
+	}
+}
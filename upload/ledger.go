@@ -0,0 +1,153 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sort"
+	gosync "sync"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/internal/journal"
+)
+
+// LedgerFileName is the ledger kept in the root of an uploaded directory by default.
+const LedgerFileName = ".gphotos-ledger.jsonl"
+
+// LedgerEntry records uploaded content.
+type LedgerEntry struct {
+	SHA256      string    `json:"sha256"`
+	Size        int64     `json:"size"`
+	Path        string    `json:"path"` // of the file which was uploaded
+	MediaItemID string    `json:"mediaItemId"`
+	AlbumIDs    []string  `json:"albumIds,omitempty"`
+	UploadedAt  time.Time `json:"uploadedAt"`
+
+	Removed bool `json:"removed,omitempty"` // tombstone written by Remove
+}
+
+// InAlbum reports whether the media item was added to the album.
+func (e LedgerEntry) InAlbum(albumID string) bool {
+	for _, id := range e.AlbumIDs {
+		if id == albumID {
+			return true
+		}
+	}
+	return false
+}
+
+// Ledger is an append-only journal of uploaded content keyed by SHA-256,
+// one JSON object per line, so content is uploaded once however often and
+// from wherever it is uploaded. Later lines replace earlier lines of the
+// same hash.
+type Ledger struct {
+	mu      gosync.Mutex
+	entries map[string]LedgerEntry
+	journal *journal.Journal[LedgerEntry]
+}
+
+// OpenLedger loads the ledger at path, creating it on the first Add.
+func OpenLedger(path string) (*Ledger, error) {
+	l := &Ledger{entries: make(map[string]LedgerEntry)}
+
+	j, err := journal.Open(path, func(entry LedgerEntry) {
+		if entry.Removed {
+			delete(l.entries, entry.SHA256)
+			return
+		}
+		l.entries[entry.SHA256] = entry
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.journal = j
+
+	return l, nil
+}
+
+// Get returns the entry of the content.
+func (l *Ledger) Get(sha256Sum string) (LedgerEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[sha256Sum]
+	return entry, ok
+}
+
+// Add appends the entry and syncs the ledger to disk.
+func (l *Ledger) Add(entry LedgerEntry) error {
+	entry.Removed = false
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.journal.Append(entry); err != nil {
+		return err
+	}
+	l.entries[entry.SHA256] = entry
+	return nil
+}
+
+// Remove forgets the content, e.g. when its media item was deleted.
+func (l *Ledger) Remove(sha256Sum string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.journal.Append(LedgerEntry{SHA256: sha256Sum, Removed: true}); err != nil {
+		return err
+	}
+	delete(l.entries, sha256Sum)
+	return nil
+}
+
+// Entries returns all entries ordered by upload time.
+func (l *Ledger) Entries() []LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]LedgerEntry, 0, len(l.entries))
+	for _, entry := range l.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].UploadedAt.Equal(entries[j].UploadedAt) {
+			return entries[i].SHA256 < entries[j].SHA256
+		}
+		return entries[i].UploadedAt.Before(entries[j].UploadedAt)
+	})
+
+	return entries
+}
+
+// Len returns the number of entries.
+func (l *Ledger) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.entries)
+}
+
+// Close closes the journal file.
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.journal.Close()
+}
+
+// fileSHA256 returns the hex encoded SHA-256 of the file's content.
+func fileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
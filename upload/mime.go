@@ -0,0 +1,72 @@
+package upload
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+const (
+	// MaxPhotoSize is the largest photo the library accepts.
+	MaxPhotoSize int64 = 200 << 20
+	// MaxVideoSize is the largest video the library accepts.
+	MaxVideoSize int64 = 20 << 30
+)
+
+// mimeTypes maps the extensions of supported file types to their mime
+// type, see https://support.google.com/googlephotos/answer/6193313.
+var mimeTypes = map[string]string{
+	".avif": "image/avif",
+	".bmp":  "image/bmp",
+	".gif":  "image/gif",
+	".heic": "image/heic",
+	".heif": "image/heif",
+	".ico":  "image/x-icon",
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".webp": "image/webp",
+	".arw":  "image/x-sony-arw",
+	".cr2":  "image/x-canon-cr2",
+	".dng":  "image/x-adobe-dng",
+	".nef":  "image/x-nikon-nef",
+	".orf":  "image/x-olympus-orf",
+	".raf":  "image/x-fuji-raf",
+	".rw2":  "image/x-panasonic-rw2",
+
+	".3g2":  "video/3gpp2",
+	".3gp":  "video/3gpp",
+	".asf":  "video/x-ms-asf",
+	".avi":  "video/x-msvideo",
+	".divx": "video/divx",
+	".m2t":  "video/mp2t",
+	".m2ts": "video/mp2t",
+	".m4v":  "video/x-m4v",
+	".mkv":  "video/x-matroska",
+	".mmv":  "video/x-mmv",
+	".mod":  "video/mpeg",
+	".mov":  "video/quicktime",
+	".mp4":  "video/mp4",
+	".mpg":  "video/mpeg",
+	".mpeg": "video/mpeg",
+	".mts":  "video/mp2t",
+	".tod":  "video/mpeg",
+	".wmv":  "video/x-ms-wmv",
+}
+
+// MimeType returns the mime type of a supported file, or "" when the
+// library does not accept its type.
+func MimeType(name string) string {
+	return mimeTypes[strings.ToLower(filepath.Ext(name))]
+}
+
+// maxSize returns the size limit of the mime type.
+func maxSize(cfg *Config, mimeType string) int64 {
+	if strings.HasPrefix(mimeType, mediaitems.VideoMimeTypePrefix) {
+		return cfg.maxVideoSize
+	}
+	return cfg.maxPhotoSize
+}
@@ -0,0 +1,76 @@
+package upload
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+
+	"golang.org/x/exp/slog"
+)
+
+type ReconcileConfig struct {
+	prune bool
+}
+
+type ReconcileOption func(*ReconcileConfig)
+
+// WithPrune removes the entries of deleted media items from the ledger, so
+// their content is uploaded again on the next run.
+func WithPrune() ReconcileOption {
+	return func(c *ReconcileConfig) {
+		c.prune = true
+	}
+}
+
+// ReconcileReport summarizes a reconciliation.
+type ReconcileReport struct {
+	Checked  int
+	Verified int
+	// Missing are the entries whose media item no longer exists.
+	Missing []LedgerEntry
+	// Pruned is the number of missing entries removed with WithPrune.
+	Pruned int
+}
+
+// Reconcile verifies that the media item of every ledger entry still exists.
+// The media items of the ledger are looked up one by one with mediaitems.Get,
+// an error other than not found stops the reconciliation.
+func Reconcile(ctx context.Context, client *http.Client, ledger *Ledger, opts ...ReconcileOption) (ReconcileReport, error) {
+	cfg := &ReconcileConfig{}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var report ReconcileReport
+
+	for _, entry := range ledger.Entries() {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.Checked++
+
+		_, err := mediaitems.Get(ctx, client, mediaitems.GetMediaItemRequest{MediaItemID: entry.MediaItemID})
+		if err == nil {
+			report.Verified++
+			continue
+		}
+		if !api.IsNotFound(err) {
+			return report, err
+		}
+
+		slog.DebugContext(ctx, "media item of ledger entry not found", "mediaItemId", entry.MediaItemID, "path", entry.Path)
+		report.Missing = append(report.Missing, entry)
+
+		if cfg.prune {
+			if err := ledger.Remove(entry.SHA256); err != nil {
+				return report, err
+			}
+			report.Pruned++
+		}
+	}
+
+	return report, nil
+}
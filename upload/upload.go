@@ -0,0 +1,723 @@
+// Package upload pushes local directory trees into the library.
+//
+// Every supported file below the root is uploaded as a new media item, and
+// every folder becomes an album of the same name, created when the app has
+// no album with that title yet.
+package upload
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/hooks"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+
+	"golang.org/x/exp/slog"
+)
+
+const DefaultConcurrency = 4
+
+type Config struct {
+	dryRun       bool
+	concurrency  int
+	maxPhotoSize int64
+	maxVideoSize int64
+	albumTitleFn func(dir string) string
+	ledger       *Ledger
+	beforeUpload []hooks.BeforeUploadHook
+	afterUpload  []hooks.AfterUploadHook
+	onError      []hooks.ErrorHook
+}
+
+type Option func(*Config)
+
+// WithDryRun reports the planned uploads and albums without changing the library.
+func WithDryRun() Option {
+	return func(c *Config) {
+		c.dryRun = true
+	}
+}
+
+// WithConcurrency sets the number of parallel uploads.
+func WithConcurrency(n int) Option {
+	return func(c *Config) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// WithMaxSize skips photos and videos larger than the limits, which default
+// to MaxPhotoSize and MaxVideoSize. Zero keeps a limit unchanged.
+func WithMaxSize(photo, video int64) Option {
+	return func(c *Config) {
+		if photo > 0 {
+			c.maxPhotoSize = photo
+		}
+		if video > 0 {
+			c.maxVideoSize = video
+		}
+	}
+}
+
+// WithAlbumTitle sets the album of the files in each folder, given its slash
+// separated path relative to the root. An empty title adds no album.
+// DefaultAlbumTitle is used when unset.
+func WithAlbumTitle(fn func(dir string) string) Option {
+	return func(c *Config) {
+		c.albumTitleFn = fn
+	}
+}
+
+// WithLedger skips files whose content the ledger records as uploaded, adding
+// their media item to the folder's album when it is not in it yet, and
+// records the files which are uploaded.
+func WithLedger(l *Ledger) Option {
+	return func(c *Config) {
+		c.ledger = l
+	}
+}
+
+// WithBeforeUpload runs h before every upload, it may veto the file or
+// replace the bytes uploaded. Hooks are not run for dry runs.
+func WithBeforeUpload(h hooks.BeforeUploadHook) Option {
+	return func(c *Config) {
+		c.beforeUpload = append(c.beforeUpload, h)
+	}
+}
+
+// WithAfterUpload runs h for every created media item.
+func WithAfterUpload(h hooks.AfterUploadHook) Option {
+	return func(c *Config) {
+		c.afterUpload = append(c.afterUpload, h)
+	}
+}
+
+// WithErrorHook tells h about every failed file.
+func WithErrorHook(h hooks.ErrorHook) Option {
+	return func(c *Config) {
+		c.onError = append(c.onError, h)
+	}
+}
+
+// DefaultAlbumTitle names albums after the folder's path below the root, so
+// 2019/Trip becomes "2019/Trip". Files directly in the root are in no album.
+func DefaultAlbumTitle(dir string) string {
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// Status is the outcome of a single file.
+type Status string
+
+const (
+	StatusCreated Status = "created"
+	StatusSkipped Status = "skipped"
+	StatusFailed  Status = "failed"
+	StatusPlanned Status = "planned" // would be uploaded, only for dry runs
+	// StatusDuplicate is content which was uploaded before, with WithLedger.
+	StatusDuplicate Status = "duplicate"
+	// StatusLinked is content which was uploaded before and whose media item
+	// was added to the folder's album, with WithLedger.
+	StatusLinked Status = "linked"
+)
+
+// Result is the outcome of a single file.
+type Result struct {
+	Path        string `json:"path"` // slash separated, relative to the root
+	Size        int64  `json:"size"`
+	MimeType    string `json:"mimeType,omitempty"`
+	SHA256      string `json:"sha256,omitempty"` // only hashed with WithLedger
+	Album       string `json:"album,omitempty"`
+	AlbumID     string `json:"albumId,omitempty"`
+	MediaItemID string `json:"mediaItemId,omitempty"`
+	Status      Status `json:"status"`
+	Message     string `json:"message,omitempty"`
+}
+
+// Report summarizes a run.
+type Report struct {
+	Created    int
+	Duplicates int
+	Linked     int
+	Skipped    int
+	Failed     int
+	Bytes      int64 // of the created media items
+
+	// AlbumsCreated are the titles of the new albums.
+	AlbumsCreated []string
+	// Results has an entry for every file below the root, ordered by path.
+	// Files not reached before ctx is done are missing.
+	Results []Result
+}
+
+type file struct {
+	Result
+	name string // path on disk
+}
+
+// Run uploads the files below root. Failed files are listed in the report,
+// the returned error is only set when walking root, resolving albums or ctx fails.
+func Run(ctx context.Context, client *http.Client, root string, opts ...Option) (Report, error) {
+	cfg := &Config{
+		concurrency:  DefaultConcurrency,
+		maxPhotoSize: MaxPhotoSize,
+		maxVideoSize: MaxVideoSize,
+		albumTitleFn: DefaultAlbumTitle,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var report Report
+
+	files, skipped, err := scan(root, cfg)
+	if err != nil {
+		return report, err
+	}
+	results := skipped
+
+	albumIDs, created, err := resolveAlbums(ctx, client, files, cfg.dryRun)
+	if err != nil {
+		return report, err
+	}
+	report.AlbumsCreated = created
+	for i := range files {
+		files[i].AlbumID = albumIDs[files[i].Album]
+	}
+
+	if cfg.dryRun {
+		d := newDeduper(cfg.ledger)
+		firstAlbums := make(map[string]string) // sha256 to album of the first file
+		for _, f := range files {
+			f, existing := d.check(f)
+			if f.Status == "" {
+				firstAlbums[f.SHA256] = f.Album
+			}
+			switch {
+			case f.Status == StatusDuplicate && f.Album != "" && f.Album != firstAlbums[f.SHA256]:
+				f.Status, f.Message = StatusPlanned, "add media item of the same content to album"
+			case f.Status != "":
+			case existing == nil:
+				f.Status = StatusPlanned
+			case f.AlbumID != "" && !existing.InAlbum(f.AlbumID) || f.Album != "" && f.AlbumID == "":
+				f.Status, f.Message = StatusPlanned, "add uploaded media item to album"
+			default:
+				f.Status = StatusDuplicate
+			}
+			results = append(results, f.Result)
+		}
+	} else {
+		results = append(results, uploadFiles(ctx, client, cfg, files)...)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Path < results[j].Path
+	})
+	for _, r := range results {
+		switch r.Status {
+		case StatusCreated:
+			report.Created++
+			report.Bytes += r.Size
+		case StatusDuplicate:
+			report.Duplicates++
+		case StatusLinked:
+			report.Linked++
+		case StatusSkipped:
+			report.Skipped++
+		case StatusFailed:
+			report.Failed++
+		}
+	}
+	report.Results = results
+
+	return report, ctx.Err()
+}
+
+// scan walks root, returning the files to upload and the results of the
+// files which are skipped. Hidden files and folders are ignored.
+func scan(root string, cfg *Config) (files []file, skipped []Result, err error) {
+	err = filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		f := file{
+			Result: Result{
+				Path:     rel,
+				MimeType: MimeType(name),
+				Album:    cfg.albumTitleFn(path.Dir(rel)),
+			},
+			name: name,
+		}
+
+		if !d.Type().IsRegular() {
+			f.Status, f.Message = StatusSkipped, "not a regular file"
+			skipped = append(skipped, f.Result)
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f.Size = info.Size()
+
+		switch {
+		case f.MimeType == "":
+			f.Status, f.Message = StatusSkipped, "unsupported file type"
+		case f.Size == 0:
+			f.Status, f.Message = StatusSkipped, "empty file"
+		case f.Size > maxSize(cfg, f.MimeType):
+			f.Status, f.Message = StatusSkipped, "file too large"
+		}
+		if f.Status == StatusSkipped {
+			skipped = append(skipped, f.Result)
+			return nil
+		}
+
+		files = append(files, f)
+		return nil
+	})
+
+	return files, skipped, err
+}
+
+// resolveAlbums returns the id of the album of every title used by files.
+func resolveAlbums(ctx context.Context, client *http.Client, files []file, dryRun bool) (albumIDs map[string]string, created []string, err error) {
+	var titles []string
+	seen := make(map[string]bool)
+	for _, f := range files {
+		if f.Album != "" && !seen[f.Album] {
+			seen[f.Album] = true
+			titles = append(titles, f.Album)
+		}
+	}
+
+	return EnsureAlbums(ctx, client, titles, dryRun)
+}
+
+// EnsureAlbums returns the id of the album of every title, creating the
+// albums the app has not created yet in title order. Only app created albums
+// are considered, media items cannot be added to other albums. With dryRun
+// no album is created and the titles which would be created are returned
+// without an id.
+func EnsureAlbums(ctx context.Context, client *http.Client, titles []string, dryRun bool) (albumIDs map[string]string, created []string, err error) {
+	if len(titles) == 0 {
+		return nil, nil, nil
+	}
+
+	wanted := make(map[string]bool, len(titles))
+	for _, title := range titles {
+		wanted[title] = true
+	}
+
+	albumIDs = make(map[string]string)
+
+	albumCh, errCh := albums.List(ctx, client, albums.ListAlbumsRequest{
+		PageSize:                 api.MaxPageSize,
+		ExcludeNonAppCreatedData: true,
+	})
+	for album := range albumCh {
+		if _, ok := albumIDs[album.Title]; !ok && wanted[album.Title] {
+			albumIDs[album.Title] = album.ID
+		}
+	}
+	select {
+	case err := <-errCh:
+		return nil, nil, err
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	missing := make([]string, 0, len(wanted))
+	for title := range wanted {
+		if _, ok := albumIDs[title]; !ok {
+			missing = append(missing, title)
+		}
+	}
+	sort.Strings(missing)
+
+	for _, title := range missing {
+		created = append(created, title)
+		if dryRun {
+			continue
+		}
+
+		album, err := albums.Create(ctx, client, albums.CreateAlbumRequest{Album: albums.Album{Title: title}})
+		if err != nil {
+			return nil, nil, err
+		}
+		slog.DebugContext(ctx, "created album", "title", title, "id", album.ID)
+		albumIDs[title] = album.ID
+	}
+
+	return albumIDs, created, nil
+}
+
+// uploadFiles uploads the files concurrently and creates their media items
+// in batches of api.MaxBatchCreateSize per album.
+func uploadFiles(ctx context.Context, client *http.Client, cfg *Config, files []file) []Result {
+	type uploaded struct {
+		file
+		upload      hooks.Upload
+		uploadToken string
+		existing    *LedgerEntry
+	}
+
+	d := newDeduper(cfg.ledger)
+
+	fileCh := make(chan file)
+	uploadedCh := make(chan uploaded)
+
+	var wg gosync.WaitGroup
+	for i := 0; i < cfg.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range fileCh {
+				f, existing := d.check(f)
+				if f.Status != "" || existing != nil {
+					uploadedCh <- uploaded{file: f, existing: existing}
+					continue
+				}
+
+				upload := hooks.Upload{Path: f.name, MimeType: f.MimeType, Filename: path.Base(f.Path)}
+				if err := beforeUpload(ctx, cfg, &upload); err != nil {
+					f.Status, f.Message = StatusFailed, err.Error()
+					if errors.Is(err, hooks.ErrSkip) {
+						f.Status = StatusSkipped
+					}
+					uploadedCh <- uploaded{file: f}
+					continue
+				}
+
+				uploadToken, err := uploadFile(ctx, client, f.Path, upload)
+				if err != nil {
+					f.Status, f.Message = StatusFailed, err.Error()
+				}
+				uploadedCh <- uploaded{file: f, upload: upload, uploadToken: uploadToken}
+			}
+		}()
+	}
+
+	go func() {
+		defer func() {
+			close(fileCh)
+			wg.Wait()
+			close(uploadedCh)
+		}()
+
+		for _, f := range files {
+			select {
+			case fileCh <- f:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var results []Result
+	done := func(f file) {
+		if f.Status == StatusFailed {
+			for _, h := range cfg.onError {
+				h.OnError(ctx, mediaitems.MediaItem{ID: f.MediaItemID}, f.name, errors.New(f.Message))
+			}
+		}
+		results = append(results, f.Result)
+	}
+
+	pending := make(map[string][]uploaded) // album id to uploads awaiting creation
+	linking := make(map[string][]uploaded) // album id to uploaded before, awaiting adding
+
+	create := func(albumID string) {
+		batch := pending[albumID]
+		delete(pending, albumID)
+
+		// media items are appended to the album in batch order
+		sort.Slice(batch, func(i, j int) bool {
+			return batch[i].Path < batch[j].Path
+		})
+
+		req := mediaitems.BatchCreateMediaItemsRequest{AlbumID: albumID}
+		byToken := make(map[string]file, len(batch))
+		for _, u := range batch {
+			req.NewMediaItems = append(req.NewMediaItems, mediaitems.NewMediaItem{
+				Description: u.upload.Description,
+				SimpleMediaItem: mediaitems.SimpleMediaItem{
+					UploadToken: u.uploadToken,
+					FileName:    u.upload.Filename,
+				},
+			})
+			byToken[u.uploadToken] = u.file
+		}
+
+		resp, err := mediaitems.BatchCreate(ctx, client, req)
+		if err != nil {
+			slog.DebugContext(ctx, "failed creating media items", "albumId", albumID, "error", err)
+			for _, u := range batch {
+				u.Status, u.Message = StatusFailed, err.Error()
+				done(u.file)
+			}
+			return
+		}
+
+		for _, r := range resp.NewMediaItemResults {
+			f, ok := byToken[r.UploadToken]
+			if !ok {
+				continue
+			}
+			delete(byToken, r.UploadToken)
+
+			if r.Succeeded() {
+				f.Status, f.MediaItemID = StatusCreated, r.MediaItem.ID
+				if err := record(cfg.ledger, f, albumID); err != nil {
+					f.Message = "not recorded in ledger: " + err.Error()
+				}
+				for _, h := range cfg.afterUpload {
+					if err := h.AfterUpload(ctx, r.MediaItem, f.name); err != nil {
+						f.Message = "after upload hook: " + err.Error()
+					}
+				}
+			} else {
+				f.Status, f.Message = StatusFailed, r.Status.Message
+			}
+			done(f)
+		}
+		for _, f := range byToken {
+			f.Status, f.Message = StatusFailed, "missing from batch create response"
+			done(f)
+		}
+	}
+
+	link := func(albumID string) {
+		batch := linking[albumID]
+		delete(linking, albumID)
+
+		req := albums.BatchAddMediaItemsRequest{AlbumID: albumID}
+		for _, u := range batch {
+			req.MediaItemIDs = append(req.MediaItemIDs, u.existing.MediaItemID)
+		}
+
+		err := albums.BatchAddMediaItems(ctx, client, req)
+		for _, u := range batch {
+			u.MediaItemID = u.existing.MediaItemID
+			if err != nil {
+				u.Status, u.Message = StatusFailed, err.Error()
+				done(u.file)
+				continue
+			}
+
+			u.Status = StatusLinked
+			if err := record(cfg.ledger, u.file, albumID); err != nil {
+				u.Message = "not recorded in ledger: " + err.Error()
+			}
+			done(u.file)
+		}
+	}
+
+	var sameRun []uploaded // duplicates of another file of the run
+
+	for u := range uploadedCh {
+		switch {
+		case u.Status == StatusDuplicate:
+			sameRun = append(sameRun, u)
+		case u.Status != "":
+			done(u.file)
+		case u.existing == nil:
+			pending[u.AlbumID] = append(pending[u.AlbumID], u)
+			if len(pending[u.AlbumID]) == api.MaxBatchCreateSize {
+				create(u.AlbumID)
+			}
+		case u.AlbumID == "" || u.existing.InAlbum(u.AlbumID):
+			u.Status, u.MediaItemID = StatusDuplicate, u.existing.MediaItemID
+			done(u.file)
+		default:
+			linking[u.AlbumID] = append(linking[u.AlbumID], u)
+			if len(linking[u.AlbumID]) == api.MaxBatchAddMediaItemsSize {
+				link(u.AlbumID)
+			}
+		}
+	}
+
+	for _, albumID := range sortedKeys(pending) {
+		if ctx.Err() != nil {
+			break
+		}
+		create(albumID)
+	}
+	linkAll := func() {
+		for _, albumID := range sortedKeys(linking) {
+			if ctx.Err() != nil {
+				break
+			}
+			link(albumID)
+		}
+	}
+	linkAll()
+
+	// the media items of the first files are recorded now, add them to the
+	// albums of their duplicates which they are not in
+	for _, u := range sameRun {
+		if ctx.Err() != nil {
+			break
+		}
+		entry, ok := cfg.ledger.Get(u.SHA256)
+		switch {
+		case !ok:
+			u.Status, u.Message = StatusSkipped, u.Message+", which was not uploaded"
+			done(u.file)
+		case u.AlbumID == "" || entry.InAlbum(u.AlbumID):
+			u.MediaItemID = entry.MediaItemID
+			done(u.file)
+		default:
+			u.existing = &entry
+			linking[u.AlbumID] = append(linking[u.AlbumID], u)
+			if len(linking[u.AlbumID]) == api.MaxBatchAddMediaItemsSize {
+				link(u.AlbumID)
+			}
+		}
+	}
+	linkAll()
+
+	return results
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// deduper finds files whose content was uploaded before, or is uploaded by
+// another file of the same run. It is safe for concurrent use.
+type deduper struct {
+	ledger *Ledger
+
+	mu   gosync.Mutex
+	seen map[string]string // sha256 to path of the first file
+}
+
+func newDeduper(ledger *Ledger) *deduper {
+	return &deduper{ledger: ledger, seen: make(map[string]string)}
+}
+
+// check hashes f when there is a ledger. The returned file has a status when
+// it is done: it failed, or duplicates another file of the run. Otherwise
+// the ledger entry of its content is returned, if any.
+func (d *deduper) check(f file) (file, *LedgerEntry) {
+	if d.ledger == nil {
+		return f, nil
+	}
+
+	sum, err := fileSHA256(f.name)
+	if err != nil {
+		f.Status, f.Message = StatusFailed, err.Error()
+		return f, nil
+	}
+	f.SHA256 = sum
+
+	d.mu.Lock()
+	first, ok := d.seen[sum]
+	if !ok {
+		d.seen[sum] = f.Path
+	}
+	d.mu.Unlock()
+
+	if ok {
+		f.Status, f.Message = StatusDuplicate, "same content as "+first
+		return f, nil
+	}
+
+	if entry, ok := d.ledger.Get(sum); ok {
+		return f, &entry
+	}
+	return f, nil
+}
+
+// record adds the media item of f, which is in the album, to the ledger.
+func record(ledger *Ledger, f file, albumID string) error {
+	if ledger == nil {
+		return nil
+	}
+
+	entry, ok := ledger.Get(f.SHA256)
+	if !ok {
+		entry = LedgerEntry{
+			SHA256:      f.SHA256,
+			Size:        f.Size,
+			Path:        f.name,
+			MediaItemID: f.MediaItemID,
+			UploadedAt:  time.Now().UTC(),
+		}
+	}
+	if albumID != "" && !entry.InAlbum(albumID) {
+		entry.AlbumIDs = append(entry.AlbumIDs, albumID)
+	}
+
+	return ledger.Add(entry)
+}
+
+// beforeUpload runs the BeforeUpload hooks in order, stopping at the first error.
+func beforeUpload(ctx context.Context, cfg *Config, upload *hooks.Upload) error {
+	for _, h := range cfg.beforeUpload {
+		if err := h.BeforeUpload(ctx, upload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadFile uploads the bytes of the upload of the file at rel, returning
+// the upload token.
+func uploadFile(ctx context.Context, client *http.Client, rel string, upload hooks.Upload) (string, error) {
+	r, err := os.Open(upload.Path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	uploadToken, err := mediaitems.Upload(ctx, client, mediaitems.UploadRequest{
+		Filename: rel,
+		MimeType: upload.MimeType,
+		Content:  r,
+	})
+	if err == nil && uploadToken == "" {
+		err = errors.New("empty upload token")
+	}
+	return uploadToken, err
+}
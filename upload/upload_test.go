@@ -0,0 +1,409 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+	"testing"
+
+	"github.com/dlph/go-photoslibrary/albums"
+	"github.com/dlph/go-photoslibrary/hooks"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+var _ http.RoundTripper = mockRoundTripper{}
+
+type mockRoundTripper struct {
+	roundTripperFn func(*http.Request) (*http.Response, error)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (mock mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return mock.roundTripperFn(req)
+}
+
+// mockLibrary serves albums.list, albums.create, uploads and mediaItems.batchCreate.
+type mockLibrary struct {
+	mu          gosync.Mutex
+	albums      []albums.Album
+	batches     []mediaitems.BatchCreateMediaItemsRequest
+	uploads     int
+	failUploads map[string]bool     // content to reject
+	added       map[string][]string // album id to media item ids added with batchAddMediaItems
+	deleted     map[string]bool     // media item ids not found
+}
+
+func (lib *mockLibrary) client() *http.Client {
+	return &http.Client{Transport: mockRoundTripper{roundTripperFn: func(req *http.Request) (*http.Response, error) {
+		lib.mu.Lock()
+		defer lib.mu.Unlock()
+
+		var resp any
+		route := req.Method + " " + req.URL.Path
+		switch {
+		case strings.HasPrefix(route, "GET /v1/mediaItems/"):
+			id := strings.TrimPrefix(req.URL.Path, "/v1/mediaItems/")
+			if lib.deleted[id] {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Header:     map[string][]string{},
+					Body:       io.NopCloser(bytes.NewReader([]byte(`{"error":{"code":404,"message":"not found","status":"NOT_FOUND"}}`))),
+					Request:    req,
+				}, nil
+			}
+			resp = &mediaitems.MediaItem{ID: id}
+		case strings.HasSuffix(route, ":batchAddMediaItems"):
+			var addReq albums.BatchAddMediaItemsRequest
+			if err := json.NewDecoder(req.Body).Decode(&addReq); err != nil {
+				return nil, err
+			}
+			albumID := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/v1/albums/"), ":batchAddMediaItems")
+			if lib.added == nil {
+				lib.added = make(map[string][]string)
+			}
+			lib.added[albumID] = append(lib.added[albumID], addReq.MediaItemIDs...)
+			resp = struct{}{}
+		case route == "GET /v1/albums":
+			resp = &albums.ListAlbumsResponse{Albums: lib.albums}
+		case route == "POST /v1/albums":
+			var createReq albums.CreateAlbumRequest
+			if err := json.NewDecoder(req.Body).Decode(&createReq); err != nil {
+				return nil, err
+			}
+			album := createReq.Album
+			album.ID = fmt.Sprintf("album-%d", len(lib.albums)+1)
+			lib.albums = append(lib.albums, album)
+			resp = &album
+		case route == "POST /v1/uploads":
+			content, err := io.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			if lib.failUploads[string(content)] {
+				return &http.Response{
+					StatusCode: http.StatusBadRequest,
+					Header:     map[string][]string{},
+					Body:       io.NopCloser(bytes.NewReader([]byte(`{"error":{"code":400,"message":"bad upload"}}`))),
+					Request:    req,
+				}, nil
+			}
+			lib.uploads++
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     map[string][]string{},
+				Body:       io.NopCloser(bytes.NewReader([]byte("token:" + string(content)))),
+				Request:    req,
+			}, nil
+		case route == "POST /v1/mediaItems:batchCreate":
+			var batchReq mediaitems.BatchCreateMediaItemsRequest
+			if err := json.NewDecoder(req.Body).Decode(&batchReq); err != nil {
+				return nil, err
+			}
+			lib.batches = append(lib.batches, batchReq)
+			batchResp := &mediaitems.BatchCreateMediaItemsResponse{}
+			for _, newItem := range batchReq.NewMediaItems {
+				batchResp.NewMediaItemResults = append(batchResp.NewMediaItemResults, mediaitems.NewMediaItemResult{
+					UploadToken: newItem.SimpleMediaItem.UploadToken,
+					MediaItem:   mediaitems.MediaItem{ID: "item:" + newItem.SimpleMediaItem.UploadToken},
+				})
+			}
+			resp = batchResp
+		default:
+			return nil, fmt.Errorf("unexpected request %s %s", req.Method, req.URL)
+		}
+
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     map[string][]string{},
+			Body:       io.NopCloser(bytes.NewReader(data)),
+			Request:    req,
+		}, nil
+	}}}
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "root.jpg"), "root")
+	writeFile(t, filepath.Join(root, "notes.txt"), "notes")
+	writeFile(t, filepath.Join(root, "big.png"), "this file is too large")
+	writeFile(t, filepath.Join(root, "broken.jpg"), "broken")
+	writeFile(t, filepath.Join(root, ".hidden", "a.jpg"), "hidden")
+	writeFile(t, filepath.Join(root, "Existing", "a.jpg"), "existing a")
+	for i := 0; i < 55; i++ {
+		writeFile(t, filepath.Join(root, "2019", "Trip", fmt.Sprintf("%02d.JPG", i)), fmt.Sprintf("trip %d", i))
+	}
+
+	lib := &mockLibrary{
+		albums:      []albums.Album{{ID: "existing", Title: "Existing"}},
+		failUploads: map[string]bool{"broken": true},
+	}
+
+	report, err := Run(ctx, lib.client(), root, WithDryRun(), WithMaxSize(16, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lib.uploads != 0 || len(lib.albums) != 1 {
+		t.Fatalf("dry run changed the library")
+	}
+	if len(report.AlbumsCreated) != 1 || report.AlbumsCreated[0] != "2019/Trip" || report.Skipped != 2 {
+		t.Errorf("dry run report %+v not expected", report)
+	}
+
+	report, err = Run(ctx, lib.client(), root, WithMaxSize(16, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 57 || report.Skipped != 2 || report.Failed != 1 || len(report.Results) != 60 {
+		t.Errorf("report counts %d created, %d skipped, %d failed, %d results not expected",
+			report.Created, report.Skipped, report.Failed, len(report.Results))
+	}
+
+	byAlbum := make(map[string]int)
+	for _, batch := range lib.batches {
+		if len(batch.NewMediaItems) > 50 {
+			t.Errorf("batch of %d media items", len(batch.NewMediaItems))
+		}
+		byAlbum[batch.AlbumID] += len(batch.NewMediaItems)
+	}
+	if byAlbum["existing"] != 1 || byAlbum["album-2"] != 55 || byAlbum[""] != 1 {
+		t.Errorf("media items per album %v not expected", byAlbum)
+	}
+
+	statuses := make(map[string]Status)
+	for _, r := range report.Results {
+		statuses[r.Path] = r.Status
+		if r.Status == StatusCreated && r.MediaItemID == "" {
+			t.Errorf("created result %+v without media item id", r)
+		}
+	}
+	for p, want := range map[string]Status{
+		"root.jpg":         StatusCreated,
+		"notes.txt":        StatusSkipped,
+		"big.png":          StatusSkipped,
+		"broken.jpg":       StatusFailed,
+		"2019/Trip/00.JPG": StatusCreated,
+		"Existing/a.jpg":   StatusCreated,
+		".hidden/a.jpg":    "",
+	} {
+		if statuses[p] != want {
+			t.Errorf("status of %s %q, want %q", p, statuses[p], want)
+		}
+	}
+}
+
+func TestRunLedger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.jpg"), "a")
+	writeFile(t, filepath.Join(root, "copy-of-a.jpg"), "a")
+	writeFile(t, filepath.Join(root, "Album", "b.jpg"), "b")
+
+	lib := &mockLibrary{}
+	ledgerPath := filepath.Join(root, LedgerFileName)
+	ledger, err := OpenLedger(ledgerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(ctx, lib.client(), root, WithLedger(ledger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 2 || report.Duplicates != 1 || ledger.Len() != 2 {
+		t.Fatalf("first run report %+v with %d ledger entries not expected", report, ledger.Len())
+	}
+	ledger.Close()
+
+	// a later run of a reorganized tree uploads nothing
+	writeFile(t, filepath.Join(root, "Album", "a.jpg"), "a")
+	writeFile(t, filepath.Join(root, "c.jpg"), "c")
+
+	ledger, err = OpenLedger(ledgerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	lib.uploads = 0
+	report, err = Run(ctx, lib.client(), root, WithLedger(ledger), WithConcurrency(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 1 || report.Linked != 1 || report.Duplicates != 3 || lib.uploads != 1 {
+		t.Errorf("second run report %+v with %d uploads not expected", report, lib.uploads)
+	}
+	entry, ok := ledger.Get(report.Results[0].SHA256) // Album/a.jpg
+	if !ok || !entry.InAlbum("album-1") || len(lib.added["album-1"]) != 1 {
+		t.Errorf("ledger entry %+v of linked media item not expected", entry)
+	}
+
+	lib.deleted = map[string]bool{entry.MediaItemID: true}
+	reconcileReport, err := Reconcile(ctx, lib.client(), ledger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reconcileReport.Checked != 3 || reconcileReport.Verified != 2 || len(reconcileReport.Missing) != 1 || ledger.Len() != 3 {
+		t.Errorf("reconcile report %+v not expected", reconcileReport)
+	}
+
+	reconcileReport, err = Reconcile(ctx, lib.client(), ledger, WithPrune())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reconcileReport.Pruned != 1 || ledger.Len() != 2 {
+		t.Errorf("prune report %+v with %d ledger entries not expected", reconcileReport, ledger.Len())
+	}
+
+	reopened, err := OpenLedger(ledgerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reopened.Get(entry.SHA256); ok || reopened.Len() != 2 {
+		t.Errorf("pruned entry still in reopened ledger of %d entries", reopened.Len())
+	}
+}
+
+func TestRunLedgerSameRunAlbums(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "Party", "a.jpg"), "a")
+	writeFile(t, filepath.Join(root, "Trip", "a.jpg"), "a")
+	writeFile(t, filepath.Join(root, "a.jpg"), "a")
+
+	ledger, err := OpenLedger(filepath.Join(root, LedgerFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	lib := &mockLibrary{}
+	report, err := Run(ctx, lib.client(), root, WithLedger(ledger), WithDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if planned := report.Results[1]; planned.Status != StatusPlanned || report.Results[2].Status != StatusDuplicate {
+		t.Errorf("dry run results %+v not expected", report.Results)
+	}
+
+	report, err = Run(ctx, lib.client(), root, WithLedger(ledger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 1 || report.Linked != 1 || report.Duplicates != 1 || lib.uploads != 1 {
+		t.Fatalf("report %+v with %d uploads not expected", report, lib.uploads)
+	}
+	entry, ok := ledger.Get(report.Results[0].SHA256)
+	if !ok || len(entry.AlbumIDs) != 2 {
+		t.Errorf("ledger entry %+v not in both albums", entry)
+	}
+	for _, r := range report.Results {
+		if r.MediaItemID != entry.MediaItemID {
+			t.Errorf("result %+v not of media item %s", r, entry.MediaItemID)
+		}
+	}
+	var added []string
+	for _, ids := range lib.added {
+		added = append(added, ids...)
+	}
+	if len(added) != 1 || added[0] != entry.MediaItemID {
+		t.Errorf("added %v to albums, want the media item of the first file", lib.added)
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.jpg"), "a")
+	writeFile(t, filepath.Join(root, "infected.jpg"), "virus")
+	writeFile(t, filepath.Join(root, "broken.jpg"), "broken")
+	stripped := filepath.Join(t.TempDir(), "a.jpg")
+
+	lib := &mockLibrary{failUploads: map[string]bool{"broken": true}}
+
+	var (
+		mu       gosync.Mutex
+		uploaded = make(map[string]string) // path to media item id
+		failed   []string
+	)
+	report, err := Run(ctx, lib.client(), root,
+		WithBeforeUpload(hooks.BeforeUploadFunc(func(ctx context.Context, upload *hooks.Upload) error {
+			data, err := os.ReadFile(upload.Path)
+			switch {
+			case err != nil:
+				return err
+			case string(data) == "virus":
+				return fmt.Errorf("virus found: %w", hooks.ErrSkip)
+			case string(data) == "a":
+				upload.Path, upload.Filename, upload.Description = stripped, "a-stripped.jpg", "no location"
+				return os.WriteFile(stripped, []byte("stripped a"), 0o644)
+			}
+			return nil
+		})),
+		WithAfterUpload(hooks.AfterUploadFunc(func(ctx context.Context, item mediaitems.MediaItem, path string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			uploaded[path] = item.ID
+			return nil
+		})),
+		WithErrorHook(hooks.ErrorFunc(func(ctx context.Context, item mediaitems.MediaItem, path string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, path)
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 1 || report.Skipped != 1 || report.Failed != 1 {
+		t.Errorf("report %+v not expected", report)
+	}
+
+	for _, r := range report.Results {
+		if r.Path == "infected.jpg" && (r.Status != StatusSkipped || !strings.Contains(r.Message, "virus found")) {
+			t.Errorf("vetoed result %+v", r)
+		}
+	}
+	if len(lib.batches) != 1 || len(lib.batches[0].NewMediaItems) != 1 {
+		t.Fatalf("batches %+v not expected", lib.batches)
+	}
+	if newItem := lib.batches[0].NewMediaItems[0]; newItem.SimpleMediaItem.UploadToken != "token:stripped a" ||
+		newItem.SimpleMediaItem.FileName != "a-stripped.jpg" || newItem.Description != "no location" {
+		t.Errorf("transformed media item %+v not expected", newItem)
+	}
+	if id := uploaded[filepath.Join(root, "a.jpg")]; id != "item:token:stripped a" || len(uploaded) != 1 {
+		t.Errorf("after upload hook called with %v", uploaded)
+	}
+	if len(failed) != 1 || failed[0] != filepath.Join(root, "broken.jpg") {
+		t.Errorf("error hook called with %v", failed)
+	}
+}
@@ -0,0 +1,400 @@
+// Package watch detects media items added to a library by polling.
+//
+// The API has no notifications. A Watcher searches for media items created
+// since its high-water mark, the latest creation time seen, less a lookback
+// window, and emits the items whose ids it has not seen. The window catches
+// items which reach the library late, e.g. uploaded after a newer one, as
+// long as they were created within it; items with older creation times,
+// such as scans, are not detected.
+package watch
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	gosync "sync"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/api"
+	"github.com/dlph/go-photoslibrary/mediaitems"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	DefaultInterval = time.Minute
+	DefaultLookback = 24 * time.Hour
+)
+
+// dateSlack widens the date filter, the API matches dates in an unknown
+// time zone.
+const dateSlack = 24 * time.Hour
+
+type Config struct {
+	interval time.Duration
+	lookback time.Duration
+	since    time.Time
+	state    *State
+	onError  func(error)
+}
+
+type Option func(*Config)
+
+// WithInterval sets the time between polls, DefaultInterval when unset.
+func WithInterval(d time.Duration) Option {
+	return func(c *Config) {
+		if d > 0 {
+			c.interval = d
+		}
+	}
+}
+
+// WithLookback sets how far before the high-water mark late items are
+// looked for, DefaultLookback when unset.
+func WithLookback(d time.Duration) Option {
+	return func(c *Config) {
+		if d >= 0 {
+			c.lookback = d
+		}
+	}
+}
+
+// WithSince emits the items created at or after t on the first poll. By
+// default the first poll only records the library as seen.
+func WithSince(t time.Time) Option {
+	return func(c *Config) {
+		c.since = t
+	}
+}
+
+// WithState resumes from the state of an earlier watcher.
+func WithState(state State) Option {
+	return func(c *Config) {
+		c.state = &state
+	}
+}
+
+// WithErrorHandler is called with the errors of failed polls, Run keeps
+// polling after them.
+func WithErrorHandler(fn func(error)) Option {
+	return func(c *Config) {
+		c.onError = fn
+	}
+}
+
+// NewItem is the event of a media item found by a poll.
+type NewItem struct {
+	Item       mediaitems.MediaItem
+	DetectedAt time.Time
+}
+
+// State is what a watcher knows about the library, to resume watching
+// after a restart without missing or repeating items.
+type State struct {
+	// Started is set once the library was first polled.
+	Started bool `json:"started"`
+	// HighWaterMark is the latest creation time seen.
+	HighWaterMark time.Time `json:"highWaterMark"`
+	// Seen maps the ids of the items in the lookback window to their creation time.
+	Seen map[string]time.Time `json:"seen"`
+}
+
+// Watcher polls a library for new media items.
+type Watcher struct {
+	client *http.Client
+	cfg    *Config
+
+	// pollMu serializes polls, the only writers of state, so a poll reads
+	// state without mu and holds mu only to update it
+	pollMu gosync.Mutex
+
+	mu          gosync.Mutex
+	state       State
+	callbacks   []func(context.Context, NewItem)
+	polled      []func(context.Context)
+	subscribers []chan NewItem
+}
+
+// New returns a watcher of the library of client.
+func New(client *http.Client, opts ...Option) *Watcher {
+	cfg := &Config{
+		interval: DefaultInterval,
+		lookback: DefaultLookback,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	w := &Watcher{client: client, cfg: cfg}
+	if cfg.state != nil {
+		w.state = *cfg.state
+	}
+	if w.state.Seen == nil {
+		w.state.Seen = make(map[string]time.Time)
+	}
+	if !cfg.since.IsZero() && !w.state.Started {
+		w.state.Started = true
+		w.state.HighWaterMark = cfg.since.Add(cfg.lookback)
+	}
+
+	return w
+}
+
+// OnNewItem registers fn, called with every new item in creation order.
+// Callbacks run on the goroutine of Run, slow ones delay the next poll.
+func (w *Watcher) OnNewItem(fn func(context.Context, NewItem)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callbacks = append(w.callbacks, fn)
+}
+
+// OnPolled registers fn, called after the new items of every successful
+// poll of Run were emitted, e.g. to persist the state.
+func (w *Watcher) OnPolled(fn func(context.Context)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.polled = append(w.polled, fn)
+}
+
+// Subscribe returns a channel receiving every new item in creation order,
+// closed when Run returns. Run waits for subscribers to receive each item,
+// the buffer absorbs bursts.
+func (w *Watcher) Subscribe(buffer int) <-chan NewItem {
+	ch := make(chan NewItem, buffer)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, ch)
+	return ch
+}
+
+// State returns a copy of the state, e.g. to persist it.
+func (w *Watcher) State() State {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	state := w.state
+	state.Seen = make(map[string]time.Time, len(w.state.Seen))
+	for id, created := range w.state.Seen {
+		state.Seen[id] = created
+	}
+	return state
+}
+
+// Run polls until ctx is done, emitting new items to the callbacks and
+// subscribers. Failed polls are retried on the next interval.
+func (w *Watcher) Run(ctx context.Context) error {
+	defer func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for _, ch := range w.subscribers {
+			close(ch)
+		}
+		w.subscribers = nil
+	}()
+
+	ticker := time.NewTicker(w.cfg.interval)
+	defer ticker.Stop()
+
+	for {
+		items, err := w.Poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.DebugContext(ctx, "failed polling for new media items", "error", err)
+			if w.cfg.onError != nil {
+				w.cfg.onError(err)
+			}
+		}
+
+		if err := w.emit(ctx, items); err != nil {
+			return err
+		}
+		if err == nil {
+			w.mu.Lock()
+			polled := append([]func(context.Context){}, w.polled...)
+			w.mu.Unlock()
+			for _, fn := range polled {
+				fn(ctx)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Watcher) emit(ctx context.Context, items []NewItem) error {
+	w.mu.Lock()
+	callbacks := append([]func(context.Context, NewItem){}, w.callbacks...)
+	subscribers := append([]chan NewItem{}, w.subscribers...)
+	w.mu.Unlock()
+
+	for _, item := range items {
+		for _, fn := range callbacks {
+			fn(ctx, item)
+		}
+		for _, ch := range subscribers {
+			select {
+			case ch <- item:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// Poll searches the library once and returns the new items in creation
+// order, advancing the state. It is used by Run and for polling on a
+// schedule of its own, such as cron. The first poll without WithSince or
+// WithState records the library as seen and returns nothing.
+func (w *Watcher) Poll(ctx context.Context) ([]NewItem, error) {
+	w.pollMu.Lock()
+	defer w.pollMu.Unlock()
+
+	if !w.state.Started {
+		return nil, w.baseline(ctx)
+	}
+
+	start := w.windowStart()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var found []mediaitems.MediaItem
+	itemCh, errCh := mediaitems.Search(ctx, w.client, w.searchRequest(start, mediaitems.OrderByCreationTime))
+	for item := range itemCh {
+		created := creationTime(item)
+		if created.Before(start) {
+			continue // within the date slack, or pruned from the seen ids
+		}
+		if _, ok := w.state.Seen[item.ID]; ok {
+			continue
+		}
+		found = append(found, item)
+	}
+	select {
+	case err := <-errCh:
+		return nil, err // the state is unchanged, the next poll finds the items again
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return creationTime(found[i]).Before(creationTime(found[j]))
+	})
+
+	now := time.Now()
+	items := make([]NewItem, 0, len(found))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, item := range found {
+		w.see(item)
+		items = append(items, NewItem{Item: item, DetectedAt: now})
+	}
+	w.prune()
+
+	return items, nil
+}
+
+// baseline records the items of the lookback window before the latest
+// creation time as seen.
+func (w *Watcher) baseline(ctx context.Context) error {
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		seen    []mediaitems.MediaItem
+		stopped bool
+	)
+	itemCh, errCh := mediaitems.Search(searchCtx, w.client, w.searchRequest(time.Time{}, mediaitems.OrderByCreationTimeDesc))
+	for item := range itemCh {
+		if len(seen) > 0 && creationTime(item).Before(creationTime(seen[0]).Add(-w.cfg.lookback)) {
+			cancel() // older than the window, stop searching
+			stopped = true
+			break
+		}
+		seen = append(seen, item)
+	}
+	for range itemCh {
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case err := <-errCh:
+		if !stopped {
+			return err
+		}
+	default:
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, item := range seen {
+		w.see(item)
+	}
+	w.state.Started = true
+
+	return nil
+}
+
+func (w *Watcher) see(item mediaitems.MediaItem) {
+	created := creationTime(item)
+	w.state.Seen[item.ID] = created
+	if created.After(w.state.HighWaterMark) {
+		w.state.HighWaterMark = created
+	}
+}
+
+// prune forgets the ids of items created before the window.
+func (w *Watcher) prune() {
+	start := w.windowStart()
+	for id, created := range w.state.Seen {
+		if created.Before(start) {
+			delete(w.state.Seen, id)
+		}
+	}
+}
+
+// windowStart is the creation time from which items are looked for.
+func (w *Watcher) windowStart() time.Time {
+	if w.state.HighWaterMark.IsZero() {
+		return time.Time{} // an empty library, every item is new
+	}
+	return w.state.HighWaterMark.Add(-w.cfg.lookback)
+}
+
+// searchRequest searches for items created from start on, ordering
+// requires a date filter.
+func (w *Watcher) searchRequest(start time.Time, orderBy string) mediaitems.SearchMediaItemRequest {
+	from := mediaitems.Date{Year: 1, Month: 1, Day: 1}
+	if !start.IsZero() {
+		from = mediaitems.NewDate(start.UTC().Add(-dateSlack))
+	}
+
+	filters := &mediaitems.Filters{
+		DateFilter: &mediaitems.DateFilter{
+			Ranges: []mediaitems.DateRange{{StartDate: from, EndDate: mediaitems.Date{Year: 9999, Month: 12, Day: 31}}},
+		},
+	}
+
+	return mediaitems.SearchMediaItemRequest{
+		PageSize: api.MaxPageSize,
+		Filters:  filters,
+		OrderBy:  orderBy,
+	}
+}
+
+func creationTime(item mediaitems.MediaItem) time.Time {
+	if item.MediaMetadata == nil {
+		return time.Time{}
+	}
+	return item.MediaMetadata.CreationTime
+}
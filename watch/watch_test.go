@@ -0,0 +1,205 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+var _ http.RoundTripper = mockRoundTripper{}
+
+type mockRoundTripper struct {
+	roundTripperFn func(*http.Request) (*http.Response, error)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (mock mockRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return mock.roundTripperFn(req)
+}
+
+func newItem(id string, created time.Time) mediaitems.MediaItem {
+	return mediaitems.MediaItem{ID: id, MediaMetadata: &mediaitems.MediaMetadata{CreationTime: created}}
+}
+
+// newTestClient serves the items of library newest first or oldest first
+// as the search orders, failing with a server error while fail is set.
+func newTestClient(t *testing.T, library *[]mediaitems.MediaItem, fail *bool) *http.Client {
+	return &http.Client{Transport: mockRoundTripper{roundTripperFn: func(req *http.Request) (*http.Response, error) {
+		var search mediaitems.SearchMediaItemRequest
+		if err := json.NewDecoder(req.Body).Decode(&search); err != nil {
+			t.Fatal(err)
+		}
+		if search.Filters == nil || search.Filters.DateFilter == nil || len(search.Filters.DateFilter.Ranges) != 1 {
+			t.Errorf("search without date range: %+v", search.Filters)
+		}
+
+		if *fail {
+			return &http.Response{
+				StatusCode: http.StatusInternalServerError,
+				Body:       io.NopCloser(bytes.NewReader([]byte(`{"error":{"code":500,"message":"backend error"}}`))),
+				Request:    req,
+			}, nil
+		}
+
+		start := search.Filters.DateFilter.Ranges[0].StartDate
+		from := time.Date(start.Year, time.Month(start.Month), start.Day, 0, 0, 0, 0, time.UTC)
+
+		var items []mediaitems.MediaItem
+		for _, item := range *library {
+			if !item.MediaMetadata.CreationTime.Before(from) {
+				items = append(items, item)
+			}
+		}
+		switch search.OrderBy {
+		case mediaitems.OrderByCreationTimeDesc:
+			for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+				items[i], items[j] = items[j], items[i]
+			}
+		case mediaitems.OrderByCreationTime:
+		default:
+			t.Errorf("search order %q", search.OrderBy)
+		}
+
+		body, _ := json.Marshal(mediaitems.SearchMediaItemResponse{MediaItems: items})
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(bytes.NewReader(body)),
+			Request:    req,
+		}, nil
+	}}}
+}
+
+func ids(items []NewItem) []string {
+	var s []string
+	for _, item := range items {
+		s = append(s, item.Item.ID)
+	}
+	return s
+}
+
+func TestPoll(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, time.June, 10, 12, 0, 0, 0, time.UTC)
+
+	// ordered by creation time, as the server orders them
+	library := []mediaitems.MediaItem{
+		newItem("old", now.Add(-30*24*time.Hour)),
+		newItem("recent", now.Add(-time.Hour)),
+	}
+	fail := false
+	w := New(newTestClient(t, &library, &fail), WithLookback(24*time.Hour))
+
+	items, err := w.Poll(ctx)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("baseline poll %v, %v", ids(items), err)
+	}
+
+	library = []mediaitems.MediaItem{
+		library[0],
+		newItem("late", now.Add(-2*time.Hour)), // uploaded after recent
+		library[1],
+		newItem("new", now),
+	}
+	items, err = w.Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(items); len(got) != 2 || got[0] != "late" || got[1] != "new" {
+		t.Errorf("poll %v, want [late new]", got)
+	}
+
+	fail = true
+	library = append(library, newItem("newer", now.Add(time.Minute)))
+	if _, err := w.Poll(ctx); err == nil {
+		t.Error("poll of a failing server succeeded")
+	}
+	fail = false
+
+	state := w.State()
+	if !state.HighWaterMark.Equal(now) {
+		t.Errorf("high-water mark %v, want %v", state.HighWaterMark, now)
+	}
+	if _, ok := state.Seen["old"]; ok {
+		t.Error("seen ids kept an item before the window")
+	}
+
+	// resuming from the state finds what the failed poll missed
+	resumed := New(newTestClient(t, &library, &fail), WithState(state))
+	items, err = resumed.Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(items); len(got) != 1 || got[0] != "newer" {
+		t.Errorf("resumed poll %v, want [newer]", got)
+	}
+}
+
+func TestPollSince(t *testing.T) {
+	now := time.Date(2023, time.June, 10, 12, 0, 0, 0, time.UTC)
+	library := []mediaitems.MediaItem{
+		newItem("before", now.Add(-48*time.Hour)),
+		newItem("after", now.Add(-time.Hour)),
+	}
+	fail := false
+	w := New(newTestClient(t, &library, &fail), WithSince(now.Add(-2*time.Hour)))
+
+	items, err := w.Poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(items); len(got) != 1 || got[0] != "after" {
+		t.Errorf("poll %v, want [after]", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	now := time.Now().UTC()
+	library := []mediaitems.MediaItem{newItem("a", now.Add(-time.Hour))}
+	fail := false
+	w := New(newTestClient(t, &library, &fail), WithSince(now.Add(-2*time.Hour)), WithInterval(time.Millisecond))
+
+	var called []string
+	w.OnNewItem(func(_ context.Context, item NewItem) {
+		called = append(called, item.Item.ID)
+	})
+	var polls atomic.Int32
+	w.OnPolled(func(context.Context) {
+		polls.Add(1)
+	})
+	ch := w.Subscribe(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- w.Run(ctx)
+	}()
+
+	select {
+	case item := <-ch:
+		if item.Item.ID != "a" || item.DetectedAt.IsZero() {
+			t.Errorf("received %+v", item)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no item received")
+	}
+	cancel()
+
+	for range ch {
+	}
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("Run returned %v", err)
+	}
+	if len(called) != 1 || called[0] != "a" {
+		t.Errorf("callback called with %v", called)
+	}
+	if polls.Load() == 0 {
+		t.Error("poll callback not called")
+	}
+}
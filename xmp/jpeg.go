@@ -0,0 +1,335 @@
+package xmp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// JPEG markers.
+const (
+	markerSOI  = 0xd8
+	markerEOI  = 0xd9
+	markerSOS  = 0xda
+	markerAPP0 = 0xe0
+	markerAPP1 = 0xe1
+	markerTEM  = 0x01
+	markerRST0 = 0xd0
+	markerRST7 = 0xd7
+)
+
+// APP1 segment identifiers.
+var (
+	exifHeader        = []byte("Exif\x00\x00")
+	xmpHeader         = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtendedHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+)
+
+// maxSegmentSize is the largest payload of a segment, its length field
+// counting itself.
+const maxSegmentSize = 0xffff - 2
+
+// ErrNotJPEG is returned when embedding into anything but a JPEG.
+var ErrNotJPEG = errors.New("xmp: not a JPEG")
+
+type segment struct {
+	marker  byte
+	payload []byte
+}
+
+func (s segment) is(marker byte, header []byte) bool {
+	return s.marker == marker && bytes.HasPrefix(s.payload, header)
+}
+
+// EmbedJPEG copies the JPEG from r to w with the metadata in an XMP segment,
+// replacing any XMP it had. An EXIF segment with the description and
+// creation time is added when the JPEG has none; an existing one is kept
+// as is, as it may hold maker notes which break when rewritten; the XMP
+// carries the metadata regardless.
+func EmbedJPEG(w io.Writer, r io.Reader, m Metadata) error {
+	br := bufio.NewReader(r)
+
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi[0] != 0xff || soi[1] != markerSOI {
+		return ErrNotJPEG
+	}
+
+	segments, sos, err := readSegments(br)
+	if err != nil {
+		return err
+	}
+
+	packet := append(append([]byte{}, xmpHeader...), m.Marshal()...)
+	if len(packet) > maxSegmentSize {
+		return fmt.Errorf("xmp: packet of %d bytes exceeds a JPEG segment", len(packet))
+	}
+
+	// APP0 stays first for JFIF readers, EXIF follows, then XMP.
+	var app0, exif, rest []segment
+	for _, s := range segments {
+		switch {
+		case s.marker == markerAPP0:
+			app0 = append(app0, s)
+		case s.is(markerAPP1, exifHeader):
+			exif = append(exif, s)
+		case s.is(markerAPP1, xmpHeader), s.is(markerAPP1, xmpExtendedHeader):
+			// replaced
+		default:
+			rest = append(rest, s)
+		}
+	}
+
+	if len(exif) == 0 {
+		payload := exifSegment(m)
+		if len(payload) > maxSegmentSize {
+			return fmt.Errorf("xmp: EXIF of %d bytes exceeds a JPEG segment", len(payload))
+		}
+		exif = append(exif, segment{marker: markerAPP1, payload: payload})
+	}
+
+	out := append(app0, exif...)
+	out = append(out, segment{marker: markerAPP1, payload: packet})
+	out = append(out, rest...)
+
+	bw := bufio.NewWriter(w)
+	bw.Write(soi[:])
+	for _, s := range out {
+		bw.Write([]byte{0xff, s.marker})
+		binary.Write(bw, binary.BigEndian, uint16(len(s.payload)+2))
+		bw.Write(s.payload)
+	}
+	if sos != nil {
+		bw.Write([]byte{0xff, markerSOS})
+		bw.Write(sos)
+		if _, err := io.Copy(bw, br); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// EmbedFile embeds the metadata into the JPEG file at name, replacing it
+// only once the embedded copy is complete.
+func EmbedFile(name string, m Metadata) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(dst.Name())
+		}
+	}()
+
+	if err := EmbedJPEG(dst, src, m); err != nil {
+		return err
+	}
+	if err := dst.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	src.Close()
+
+	return os.Rename(dst.Name(), name)
+}
+
+// readSegments reads the segments up to the start of scan, returning the
+// start of scan segment's length and payload. The scan data after it is
+// left in r.
+func readSegments(r *bufio.Reader) ([]segment, []byte, error) {
+	var segments []segment
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, unexpected(err)
+		}
+		if b != 0xff {
+			return nil, nil, fmt.Errorf("xmp: malformed JPEG, want marker, got %#x", b)
+		}
+
+		marker, err := r.ReadByte()
+		for err == nil && marker == 0xff { // fill bytes
+			marker, err = r.ReadByte()
+		}
+		if err != nil {
+			return nil, nil, unexpected(err)
+		}
+
+		switch {
+		case marker == markerEOI:
+			return segments, nil, nil
+		case marker == markerTEM, marker >= markerRST0 && marker <= markerRST7:
+			continue
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			return nil, nil, unexpected(err)
+		}
+		n := int(binary.BigEndian.Uint16(length[:]))
+		if n < 2 {
+			return nil, nil, fmt.Errorf("xmp: malformed JPEG, segment length %d", n)
+		}
+
+		payload := make([]byte, n-2)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, nil, unexpected(err)
+		}
+
+		if marker == markerSOS {
+			return segments, append(length[:], payload...), nil
+		}
+		segments = append(segments, segment{marker: marker, payload: payload})
+	}
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// TIFF tags and types written to EXIF.
+const (
+	tagImageDescription   = 0x010e
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+
+	typeASCII = 2
+	typeLong  = 4
+)
+
+// exifTimeLayout is how EXIF formats dates, without a zone.
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	value []byte // ASCII including the terminating NUL, or a big endian LONG
+}
+
+// exifSegment returns the payload of an EXIF segment with the description
+// in IFD0 and the creation time, in UTC, in the EXIF IFD.
+func exifSegment(m Metadata) []byte {
+	var ifd0, exifIFD []ifdEntry
+
+	if m.Description != "" {
+		ifd0 = append(ifd0, ascii(tagImageDescription, m.Description))
+	}
+	if !m.CreationTime.IsZero() {
+		created := m.CreationTime.UTC().Format(exifTimeLayout)
+		ifd0 = append(ifd0, ascii(tagDateTime, created))
+		exifIFD = append(exifIFD,
+			ascii(tagDateTimeOriginal, created),
+			ascii(tagOffsetTimeOriginal, "+00:00"),
+		)
+	}
+
+	const tiffHeaderSize = 8
+
+	// IFD0 is followed by its values, then the EXIF IFD and its values.
+	n := len(ifd0)
+	if len(exifIFD) > 0 {
+		n++
+	}
+	exifOffset := tiffHeaderSize + ifdSize(n) + valuesSize(ifd0)
+	if len(exifIFD) > 0 {
+		ifd0 = append(ifd0, ifdEntry{tag: tagExifIFD, typ: typeLong, value: binary.BigEndian.AppendUint32(nil, uint32(exifOffset))})
+	}
+
+	var b bytes.Buffer
+	b.Write(exifHeader)
+	b.WriteString("MM\x00\x2a")
+	binary.Write(&b, binary.BigEndian, uint32(tiffHeaderSize))
+	writeIFD(&b, ifd0, tiffHeaderSize)
+	if len(exifIFD) > 0 {
+		writeIFD(&b, exifIFD, exifOffset)
+	}
+	return b.Bytes()
+}
+
+func ascii(tag uint16, value string) ifdEntry {
+	return ifdEntry{tag: tag, typ: typeASCII, value: append([]byte(value), 0)}
+}
+
+// ifdSize is the size of an IFD of n entries: the count, 12 bytes per entry
+// and the offset of the next IFD.
+func ifdSize(n int) int {
+	return 2 + 12*n + 4
+}
+
+// valuesSize is the size of the values which do not fit an entry, padded to
+// even offsets.
+func valuesSize(entries []ifdEntry) int {
+	size := 0
+	for _, e := range entries {
+		if len(e.value) > 4 {
+			size += len(e.value) + len(e.value)%2
+		}
+	}
+	return size
+}
+
+// writeIFD writes the entries, which must be sorted by tag, at offset from
+// the start of the TIFF header, followed by their values.
+func writeIFD(b *bytes.Buffer, entries []ifdEntry, offset int) {
+	valueOffset := offset + ifdSize(len(entries))
+
+	var values bytes.Buffer
+	binary.Write(b, binary.BigEndian, uint16(len(entries)))
+	for _, e := range entries {
+		count := len(e.value)
+		if e.typ == typeLong {
+			count /= 4
+		}
+		binary.Write(b, binary.BigEndian, e.tag)
+		binary.Write(b, binary.BigEndian, e.typ)
+		binary.Write(b, binary.BigEndian, uint32(count))
+
+		if len(e.value) <= 4 {
+			var inline [4]byte
+			copy(inline[:], e.value)
+			b.Write(inline[:])
+			continue
+		}
+
+		binary.Write(b, binary.BigEndian, uint32(valueOffset+values.Len()))
+		values.Write(e.value)
+		if len(e.value)%2 == 1 {
+			values.WriteByte(0)
+		}
+	}
+	binary.Write(b, binary.BigEndian, uint32(0)) // no next IFD
+	b.Write(values.Bytes())
+}
+
+// EmbedsJPEG reports whether EmbedJPEG handles the mime type.
+func EmbedsJPEG(mimeType string) bool {
+	return mimeType == "image/jpeg"
+}
@@ -0,0 +1,106 @@
+// Package xmp writes media item metadata which the downloaded bytes lack,
+// such as the description, into XMP sidecar files and JPEG segments.
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+// SidecarExt is appended to the name of a media file to name its sidecar,
+// IMG.JPG has IMG.JPG.xmp, so a photo and a video sharing a base name do
+// not share a sidecar.
+const SidecarExt = ".xmp"
+
+// Metadata is what is written about a media item.
+type Metadata struct {
+	Description  string
+	CreationTime time.Time
+	CameraMake   string
+	CameraModel  string
+	// Albums are written as keywords.
+	Albums []string
+}
+
+// FromMediaItem returns the metadata of the media item in the albums.
+func FromMediaItem(item mediaitems.MediaItem, albums []string) Metadata {
+	m := Metadata{
+		Description: item.Description,
+		Albums:      albums,
+	}
+
+	if metadata := item.MediaMetadata; metadata != nil {
+		m.CreationTime = metadata.CreationTime
+		switch {
+		case metadata.Photo != nil:
+			m.CameraMake, m.CameraModel = metadata.Photo.CameraMake, metadata.Photo.CameraModel
+		case metadata.Video != nil:
+			m.CameraMake, m.CameraModel = metadata.Video.CameraMake, metadata.Video.CameraModel
+		}
+	}
+
+	return m
+}
+
+// Marshal returns the metadata as an XMP packet.
+func (m Metadata) Marshal() []byte {
+	var b bytes.Buffer
+
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">` + "\n")
+	b.WriteString(` <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	b.WriteString(`  <rdf:Description rdf:about=""` + "\n" +
+		`    xmlns:dc="http://purl.org/dc/elements/1.1/"` + "\n" +
+		`    xmlns:xmp="http://ns.adobe.com/xap/1.0/"` + "\n" +
+		`    xmlns:exif="http://ns.adobe.com/exif/1.0/"` + "\n" +
+		`    xmlns:tiff="http://ns.adobe.com/tiff/1.0/"` + "\n" +
+		`    xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/">` + "\n")
+
+	if m.Description != "" {
+		b.WriteString(`   <dc:description><rdf:Alt><rdf:li xml:lang="x-default">`)
+		xml.EscapeText(&b, []byte(m.Description))
+		b.WriteString("</rdf:li></rdf:Alt></dc:description>\n")
+	}
+	if len(m.Albums) > 0 {
+		b.WriteString("   <dc:subject><rdf:Bag>")
+		for _, album := range m.Albums {
+			b.WriteString("<rdf:li>")
+			xml.EscapeText(&b, []byte(album))
+			b.WriteString("</rdf:li>")
+		}
+		b.WriteString("</rdf:Bag></dc:subject>\n")
+	}
+	if !m.CreationTime.IsZero() {
+		created := m.CreationTime.Format(time.RFC3339)
+		writeProperty(&b, "xmp:CreateDate", created)
+		writeProperty(&b, "exif:DateTimeOriginal", created)
+		writeProperty(&b, "photoshop:DateCreated", created)
+	}
+	writeProperty(&b, "tiff:Make", m.CameraMake)
+	writeProperty(&b, "tiff:Model", m.CameraModel)
+
+	b.WriteString("  </rdf:Description>\n")
+	b.WriteString(" </rdf:RDF>\n")
+	b.WriteString("</x:xmpmeta>\n")
+	b.WriteString(`<?xpacket end="w"?>`)
+
+	return b.Bytes()
+}
+
+func writeProperty(b *bytes.Buffer, name, value string) {
+	if value == "" {
+		return
+	}
+	b.WriteString("   <" + name + ">")
+	xml.EscapeText(b, []byte(value))
+	b.WriteString("</" + name + ">\n")
+}
+
+// WriteSidecar writes the metadata next to the media file at name.
+func WriteSidecar(name string, m Metadata) error {
+	return os.WriteFile(name+SidecarExt, m.Marshal(), 0o644)
+}
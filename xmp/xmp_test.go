@@ -0,0 +1,208 @@
+package xmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlph/go-photoslibrary/mediaitems"
+)
+
+func TestMarshal(t *testing.T) {
+	item := mediaitems.MediaItem{
+		ID:          "1",
+		Description: `Fish & "chips" <3`,
+		MediaMetadata: &mediaitems.MediaMetadata{
+			CreationTime: time.Date(2023, 5, 1, 12, 30, 0, 0, time.UTC),
+			Photo:        &mediaitems.Photo{CameraMake: "Google", CameraModel: "Pixel 7"},
+		},
+	}
+
+	got := string(FromMediaItem(item, []string{"Trips", "Food"}).Marshal())
+
+	for _, want := range []string{
+		`<?xpacket begin="` + "\ufeff" + `"`,
+		`<rdf:li xml:lang="x-default">Fish &amp; &#34;chips&#34; &lt;3</rdf:li>`,
+		`<dc:subject><rdf:Bag><rdf:li>Trips</rdf:li><rdf:li>Food</rdf:li></rdf:Bag></dc:subject>`,
+		`<xmp:CreateDate>2023-05-01T12:30:00Z</xmp:CreateDate>`,
+		`<exif:DateTimeOriginal>2023-05-01T12:30:00Z</exif:DateTimeOriginal>`,
+		`<tiff:Make>Google</tiff:Make>`,
+		`<tiff:Model>Pixel 7</tiff:Model>`,
+		`<?xpacket end="w"?>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("packet lacks %s:\n%s", want, got)
+		}
+	}
+
+	empty := string(Metadata{}.Marshal())
+	for _, unwanted := range []string{"dc:description", "dc:subject", "xmp:CreateDate", "tiff:Make"} {
+		if strings.Contains(empty, "<"+unwanted) {
+			t.Errorf("empty packet has %s", unwanted)
+		}
+	}
+}
+
+func TestWriteSidecar(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "IMG_1.JPG")
+
+	if err := WriteSidecar(name, Metadata{Description: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(name + ".xmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(got, []byte(">hello<")) {
+		t.Errorf("sidecar = %s", got)
+	}
+}
+
+func TestEmbedJPEG(t *testing.T) {
+	var src bytes.Buffer
+	if err := jpeg.Encode(&src, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	m := Metadata{
+		Description:  "first",
+		CreationTime: time.Date(2023, 5, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60)),
+	}
+
+	var once bytes.Buffer
+	if err := EmbedJPEG(&once, bytes.NewReader(src.Bytes()), m); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(once.Bytes())); err != nil {
+		t.Fatalf("decode embedded: %v", err)
+	}
+
+	segments := parse(t, once.Bytes())
+	exif := find(segments, exifHeader)
+	if len(exif) != 1 {
+		t.Fatalf("got %d EXIF segments, want 1", len(exif))
+	}
+	tiff := exif[0][len(exifHeader):]
+	if got := asciiTag(t, tiff, tagImageDescription); got != "first" {
+		t.Errorf("ImageDescription = %q, want first", got)
+	}
+	if got := asciiTag(t, tiff, tagDateTime); got != "2023:05:01 10:30:00" {
+		t.Errorf("DateTime = %q", got)
+	}
+
+	// Embedding again replaces the XMP and keeps the EXIF.
+	m.Description = "second"
+	var twice bytes.Buffer
+	if err := EmbedJPEG(&twice, bytes.NewReader(once.Bytes()), m); err != nil {
+		t.Fatal(err)
+	}
+
+	segments = parse(t, twice.Bytes())
+	packets := find(segments, xmpHeader)
+	if len(packets) != 1 {
+		t.Fatalf("got %d XMP segments, want 1", len(packets))
+	}
+	if !bytes.Contains(packets[0], []byte(">second<")) {
+		t.Errorf("XMP = %s", packets[0])
+	}
+	if exif := find(segments, exifHeader); len(exif) != 1 || !bytes.Equal(exif[0][len(exifHeader):], tiff) {
+		t.Error("EXIF changed")
+	}
+
+	if err := EmbedJPEG(&bytes.Buffer{}, strings.NewReader("GIF89a"), m); err != ErrNotJPEG {
+		t.Errorf("embed into GIF: got %v, want ErrNotJPEG", err)
+	}
+}
+
+// parse returns the APP1 payloads before the start of scan.
+func parse(t *testing.T, b []byte) [][]byte {
+	t.Helper()
+
+	var app1 [][]byte
+	for i := 2; i+4 <= len(b) && b[i+1] != markerSOS; {
+		n := int(binary.BigEndian.Uint16(b[i+2:]))
+		if b[i+1] == markerAPP1 {
+			app1 = append(app1, b[i+4:i+2+n])
+		}
+		i += 2 + n
+	}
+	return app1
+}
+
+func find(segments [][]byte, header []byte) [][]byte {
+	var found [][]byte
+	for _, s := range segments {
+		if bytes.HasPrefix(s, header) {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+// asciiTag reads an ASCII tag of IFD0 of a big endian TIFF.
+func asciiTag(t *testing.T, tiff []byte, tag uint16) string {
+	t.Helper()
+
+	ifd := binary.BigEndian.Uint32(tiff[4:])
+	n := int(binary.BigEndian.Uint16(tiff[ifd:]))
+	for i := 0; i < n; i++ {
+		e := tiff[int(ifd)+2+12*i:]
+		if binary.BigEndian.Uint16(e) != tag {
+			continue
+		}
+		count := binary.BigEndian.Uint32(e[4:])
+		offset := binary.BigEndian.Uint32(e[8:])
+		return string(tiff[offset : offset+count-1])
+	}
+	t.Fatalf("no tag %#x", tag)
+	return ""
+}
+
+func TestEmbedFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "IMG_1.jpg")
+
+	var src bytes.Buffer
+	if err := jpeg.Encode(&src, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, src.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EmbedFile(name, Metadata{Description: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packets := find(parse(t, got), xmpHeader); len(packets) != 1 || !bytes.Contains(packets[0], []byte(">hello<")) {
+		t.Errorf("XMP = %q", packets)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files, want the JPEG only", len(entries))
+	}
+
+	if err := os.WriteFile(name, []byte("not a jpeg"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := EmbedFile(name, Metadata{}); err != ErrNotJPEG {
+		t.Errorf("embed into text: got %v, want ErrNotJPEG", err)
+	}
+	if got, _ := os.ReadFile(name); string(got) != "not a jpeg" {
+		t.Errorf("failed embed changed the file to %q", got)
+	}
+}